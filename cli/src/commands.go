@@ -0,0 +1,731 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/diagnostics"
+	"github.com/mininghq/miner/helper/install"
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/miner/helper/state"
+	"github.com/mininghq/miner/helper/timeseries"
+	"github.com/mininghq/rpcproto/rpcproto"
+	homedir "github.com/mitchellh/go-homedir"
+	"google.golang.org/grpc"
+)
+
+const (
+	// requestTimeout limits how long we wait for the miner controller
+	requestTimeout = time.Second * 10
+	// followInterval is how often new logs are fetched with logs -follow
+	followInterval = time.Second * 2
+)
+
+// command is a subcommand for managing an installed rig
+type command struct {
+	// description is shown in the usage
+	description string
+	// run runs the command with its arguments and returns the exit code
+	run func(args []string) int
+}
+
+// commands are the subcommands, running without a subcommand installs
+var commands = map[string]command{
+	"status":      {"Show the state, hashrate and shares of this rig", runStatus},
+	"stats":       {"Show the stats of every miner", runStats},
+	"logs":        {"Show the miner logs, -follow keeps showing new lines", runLogs},
+	"pause":       {"Pause mining", runPause},
+	"resume":      {"Resume mining", runResume},
+	"info":        {"Show the rig and installation details", runInfo},
+	"history":     {"Show or export the hashrate and share history, -csv exports CSV", runHistory},
+	"uninstall":   {"Uninstall MiningHQ", runUninstall},
+	"upgrade":     {"Upgrade the installation, -repair replaces all files", runUpgrade},
+	"diagnostics": {"Save the system info, installation details and logs for support to a zip", runDiagnostics},
+}
+
+// commandUsage prints the usage of the installer and its subcommands
+func commandUsage() {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [install flags]\n", name)
+	fmt.Fprintf(os.Stderr, "       %s <command> [-output text|json] [flags]\n\n", name)
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writer := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "  install\tInstall MiningHQ, the default\n")
+	for _, name := range names {
+		fmt.Fprintf(writer, "  %s\t%s\n", name, commands[name].description)
+	}
+	writer.Flush()
+	fmt.Fprintf(os.Stderr, "\nInstall flags:\n")
+	flag.PrintDefaults()
+}
+
+// commandContext holds what every subcommand needs
+type commandContext struct {
+	// name of the subcommand
+	name string
+	// flags of the subcommand, the common flags are added
+	flags *flag.FlagSet
+	// output is the output format, helper.OutputText or helper.OutputJSON
+	output *string
+	// address is the address of the miner controller's manager API
+	address *string
+}
+
+// newCommandContext creates the flags for the subcommand
+func newCommandContext(name string) *commandContext {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	return &commandContext{
+		name:    name,
+		flags:   flags,
+		output:  flags.String("output", helper.OutputText, "Output format, 'text' or 'json'"),
+		address: flags.String("address", helper.ControllerAddress(), "Address of the miner controller"),
+	}
+}
+
+// parse parses the arguments, it returns false if they are invalid
+func (ctx *commandContext) parse(args []string) bool {
+	err := ctx.flags.Parse(args)
+	if err != nil {
+		return false
+	}
+	if *ctx.output != helper.OutputText && *ctx.output != helper.OutputJSON {
+		fmt.Fprintf(os.Stderr, "Output may only be '%s' or '%s'\n", helper.OutputText, helper.OutputJSON)
+		return false
+	}
+	return true
+}
+
+// json returns true if the output is JSON
+func (ctx *commandContext) json() bool {
+	return *ctx.output == helper.OutputJSON
+}
+
+// write outputs the result as JSON, or as text using writeText
+func (ctx *commandContext) write(result interface{}, writeText func(writer io.Writer)) int {
+	if ctx.json() {
+		json.NewEncoder(os.Stdout).Encode(result)
+		return ExitOK
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	writeText(writer)
+	writer.Flush()
+	return ExitOK
+}
+
+// fail reports the error and returns the exit code for it
+func (ctx *commandContext) fail(err error, hint string) int {
+	if ctx.json() {
+		json.NewEncoder(os.Stdout).Encode(map[string]string{
+			"status": helper.StepFailed,
+			"error":  err.Error(),
+			"hint":   strings.TrimSpace(hint),
+		})
+		return ExitFailed
+	}
+	fmt.Fprintf(os.Stderr, "Unable to %s: %s\n", ctx.name, err)
+	if hint != "" {
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(hint))
+	}
+	return ExitFailed
+}
+
+// client connects to the miner controller with the installation's
+// credentials. The connection is made lazily, a controller that isn't
+// running fails the first request
+func (ctx *commandContext) client() (rpcproto.ManagerServiceClient, *grpc.ClientConn, error) {
+	// Without an installation there are no credentials to present
+	installPath := ""
+	homeDir, err := homedir.Dir()
+	if err == nil {
+		record, err := state.Load(homeDir)
+		if err == nil {
+			installPath = record.InstallPath
+		}
+	}
+	conn, err := managerapi.Dial(installPath, *ctx.address)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rpcproto.NewManagerServiceClient(conn), conn, nil
+}
+
+// request returns a context for a single request to the controller
+func request() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), requestTimeout)
+}
+
+// controllerHint is shown when the controller can't be reached
+const controllerHint = `
+Please ensure the MiningHQ Miner service is running. It is started
+automatically when you log in, or start it from your installation directory.`
+
+// MinerStatsResult holds the stats of a single miner
+type MinerStatsResult struct {
+	// Miner is the key of the miner
+	Miner string `json:"miner"`
+	// Hashrate is the hashrate in hashes per second
+	Hashrate float64 `json:"hashrate"`
+	// TotalShares is the number of shares submitted
+	TotalShares int64 `json:"total_shares"`
+	// AcceptedShares is the number of shares accepted by the pool
+	AcceptedShares int64 `json:"accepted_shares"`
+	// RejectedShares is the number of shares rejected by the pool
+	RejectedShares int64 `json:"rejected_shares"`
+	// RejectionRate is the percentage of the shares that were rejected
+	RejectionRate float64 `json:"rejection_rate"`
+}
+
+// StatusResult is the output of the status command
+type StatusResult struct {
+	// Name is the name of the rig on MiningHQ
+	Name string `json:"name"`
+	// Link is the rig's page on MiningHQ
+	Link string `json:"link"`
+	// State is the mining state
+	State string `json:"state"`
+	// Total combines the stats of all miners
+	Total MinerStatsResult `json:"total"`
+}
+
+// InfoResult is the output of the info command
+type InfoResult struct {
+	// Name is the name of the rig on MiningHQ, empty if the controller
+	// isn't running
+	Name string `json:"name"`
+	// Link is the rig's page on MiningHQ
+	Link string `json:"link"`
+	// Installation is the installation record
+	Installation *state.Record `json:"installation"`
+	// RecordPath is where the installation record is stored
+	RecordPath string `json:"record_path"`
+}
+
+// DiagnosticsResult is the output of the diagnostics command
+type DiagnosticsResult struct {
+	// Status is 'ok' once the bundle was saved
+	Status string `json:"status"`
+	// Path is where the bundle was saved
+	Path string `json:"path"`
+	// Problems lists what couldn't be collected
+	Problems []string `json:"problems"`
+}
+
+// LogLine is output for every log line in JSON mode
+type LogLine struct {
+	// Miner is the key of the miner that logged the line
+	Miner string `json:"miner"`
+	// Line is the logged line
+	Line string `json:"line"`
+}
+
+// runStatus shows the state, hashrate and shares of the rig
+func runStatus(args []string) int {
+	ctx := newCommandContext("status")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	client, conn, err := ctx.client()
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+	defer conn.Close()
+
+	reqCtx, cancel := request()
+	defer cancel()
+	info, err := client.GetInfo(reqCtx, &rpcproto.RigInfoRequest{})
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+	stateResponse, err := client.GetState(reqCtx, &rpcproto.StateRequest{})
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+	stats, err := minerStats(reqCtx, client)
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+
+	result := StatusResult{
+		Name:  info.Name,
+		Link:  info.Link,
+		State: stateResponse.State.String(),
+		Total: totalStats(stats),
+	}
+	return ctx.write(&result, func(writer io.Writer) {
+		fmt.Fprintf(writer, "Rig\t%s\n", result.Name)
+		fmt.Fprintf(writer, "Link\t%s\n", result.Link)
+		fmt.Fprintf(writer, "State\t%s\n", result.State)
+		fmt.Fprintf(writer, "Hashrate\t%.2f H/s\n", result.Total.Hashrate)
+		fmt.Fprintf(writer, "Shares\t%d accepted, %d rejected (%.1f%%), %d total\n",
+			result.Total.AcceptedShares,
+			result.Total.RejectedShares,
+			result.Total.RejectionRate,
+			result.Total.TotalShares)
+	})
+}
+
+// runStats shows the stats of every miner
+func runStats(args []string) int {
+	ctx := newCommandContext("stats")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	client, conn, err := ctx.client()
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+	defer conn.Close()
+
+	reqCtx, cancel := request()
+	defer cancel()
+	stats, err := minerStats(reqCtx, client)
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+
+	total := totalStats(stats)
+	return ctx.write(map[string]interface{}{
+		"miners": stats,
+		"total":  total,
+	}, func(writer io.Writer) {
+		fmt.Fprintf(writer, "MINER\tHASHRATE\tACCEPTED\tREJECTED\tREJECTION RATE\tTOTAL\n")
+		for _, miner := range append(stats, total) {
+			fmt.Fprintf(writer, "%s\t%.2f H/s\t%d\t%d\t%.1f%%\t%d\n",
+				miner.Miner,
+				miner.Hashrate,
+				miner.AcceptedShares,
+				miner.RejectedShares,
+				miner.RejectionRate,
+				miner.TotalShares)
+		}
+	})
+}
+
+// runLogs shows the miner logs. With -follow new lines are shown until
+// the command is interrupted
+func runLogs(args []string) int {
+	ctx := newCommandContext("logs")
+	lines := ctx.flags.Int("lines", 100, "Number of lines to show per miner")
+	follow := ctx.flags.Bool("follow", false, "Keep showing new log lines")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	client, conn, err := ctx.client()
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+	defer conn.Close()
+
+	encoder := json.NewEncoder(os.Stdout)
+	tail := helper.NewLogTail()
+	for {
+		reqCtx, cancel := request()
+		logsResponse, err := client.GetLogs(reqCtx, &rpcproto.LogsRequest{
+			MaxLines: int32(*lines),
+		})
+		cancel()
+		if err != nil {
+			return ctx.fail(err, controllerHint)
+		}
+		for _, minerLog := range logsResponse.MinerLogs {
+			for _, line := range tail.Next(minerLog.Key, minerLog.Logs) {
+				if ctx.json() {
+					encoder.Encode(LogLine{Miner: minerLog.Key, Line: line})
+					continue
+				}
+				fmt.Printf("[%s] %s\n", minerLog.Key, line)
+			}
+		}
+		if *follow == false {
+			return ExitOK
+		}
+		time.Sleep(followInterval)
+	}
+}
+
+// runPause pauses mining
+func runPause(args []string) int {
+	return setState("pause", rpcproto.MinerState_PauseMining, "Mining has been paused", args)
+}
+
+// runResume resumes mining
+func runResume(args []string) int {
+	return setState("resume", rpcproto.MinerState_ResumeMining, "Mining has been resumed", args)
+}
+
+// setState changes the mining state
+func setState(name string, minerState rpcproto.MinerState, message string, args []string) int {
+	ctx := newCommandContext(name)
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	client, conn, err := ctx.client()
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+	defer conn.Close()
+
+	reqCtx, cancel := request()
+	defer cancel()
+	stateResponse, err := client.SetState(reqCtx, &rpcproto.StateRequest{
+		State: minerState,
+	})
+	if err != nil {
+		return ctx.fail(err, controllerHint)
+	}
+	return ctx.write(map[string]string{
+		"status": helper.StepOK,
+		"state":  stateResponse.State.String(),
+	}, func(writer io.Writer) {
+		fmt.Fprintln(writer, message)
+	})
+}
+
+// runInfo shows the rig and installation details. The installation is
+// shown even if the controller isn't running
+func runInfo(args []string) int {
+	ctx := newCommandContext("info")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	record, code := loadRecord(ctx)
+	if record == nil {
+		return code
+	}
+
+	result := InfoResult{
+		Installation: record,
+		RecordPath:   record.Path(),
+	}
+	client, conn, err := ctx.client()
+	if err == nil {
+		defer conn.Close()
+		reqCtx, cancel := request()
+		defer cancel()
+		info, err := client.GetInfo(reqCtx, &rpcproto.RigInfoRequest{})
+		if err == nil {
+			result.Name = info.Name
+			result.Link = info.Link
+		}
+	}
+
+	return ctx.write(&result, func(writer io.Writer) {
+		if result.Name == "" {
+			fmt.Fprintf(writer, "Rig\tunknown, the MiningHQ Miner service is not running\n")
+		} else {
+			fmt.Fprintf(writer, "Rig\t%s\n", result.Name)
+			fmt.Fprintf(writer, "Link\t%s\n", result.Link)
+		}
+		fmt.Fprintf(writer, "Rig ID\t%s\n", record.RigID)
+		fmt.Fprintf(writer, "Installed in\t%s\n", record.InstallPath)
+		fmt.Fprintf(writer, "Version\t%s\n", record.Version)
+		fmt.Fprintf(writer, "Installed at\t%s\n", record.InstalledAt.Format(time.RFC1123))
+		fmt.Fprintf(writer, "System-wide\t%t\n", record.SystemWide)
+		fmt.Fprintf(writer, "Components\t%s\n", strings.Join(record.Components, ", "))
+		fmt.Fprintf(writer, "Record\t%s\n", result.RecordPath)
+	})
+}
+
+// runHistory shows the recorded hashrate and shares of the rig. The
+// history is read from the installation directory, the controller doesn't
+// need to be running
+func runHistory(args []string) int {
+	ctx := newCommandContext("history")
+	periodValue := ctx.flags.String("range", "1h", "Period to show, such as '1h', '24h' or '30d'")
+	exportCSV := ctx.flags.Bool("csv", false, "Export the history as CSV")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	period, err := timeseries.ParsePeriod(*periodValue)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitInvalidOptions
+	}
+	record, code := loadRecord(ctx)
+	if record == nil {
+		return code
+	}
+
+	points, resolution, err := timeseries.Query(filepath.Join(record.InstallPath, timeseries.Filename), period)
+	if err != nil {
+		return ctx.fail(err, "")
+	}
+
+	if *exportCSV {
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"time", "hashrate", "total_shares", "accepted_shares", "rejected_shares"})
+		for _, point := range points {
+			writer.Write([]string{
+				point.Time.Format(time.RFC3339),
+				strconv.FormatFloat(point.Hashrate, 'f', 2, 64),
+				strconv.FormatInt(point.TotalShares, 10),
+				strconv.FormatInt(point.AcceptedShares, 10),
+				strconv.FormatInt(point.RejectedShares, 10),
+			})
+		}
+		writer.Flush()
+		if writer.Error() != nil {
+			return ctx.fail(writer.Error(), "")
+		}
+		return ExitOK
+	}
+
+	return ctx.write(points, func(writer io.Writer) {
+		if len(points) == 0 {
+			fmt.Fprintf(writer, "No stats have been recorded in the last %s\n", *periodValue)
+			return
+		}
+		fmt.Fprintf(writer, "Every %s over the last %s\n", resolution.Step, *periodValue)
+		fmt.Fprintf(writer, "TIME\tHASHRATE\tACCEPTED\tREJECTED\tREJECTION RATE\n")
+		for _, point := range points {
+			fmt.Fprintf(writer, "%s\t%.2f H/s\t%d\t%d\t%.1f%%\n",
+				point.Time.Format("2006-01-02 15:04:05"),
+				point.Hashrate,
+				point.AcceptedShares,
+				point.RejectedShares,
+				helper.RejectionRate(point.AcceptedShares, point.RejectedShares))
+		}
+	})
+}
+
+// runDiagnostics saves a diagnostics bundle to attach to support requests.
+// It works without an installation or a running controller, whatever can't
+// be collected is listed in the bundle
+func runDiagnostics(args []string) int {
+	ctx := newCommandContext("diagnostics")
+	bundlePath := ctx.flags.String(
+		"file",
+		fmt.Sprintf("mininghq-diagnostics-%s.zip", time.Now().Format("20060102-150405")),
+		"Path to save the diagnostics bundle to")
+	lines := ctx.flags.Int("lines", 500, "Number of log lines to include per miner")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return ctx.fail(err, "")
+	}
+
+	bundle := diagnostics.Collect(homeDir)
+	client, conn, err := ctx.client()
+	if err == nil {
+		defer conn.Close()
+		reqCtx, cancel := request()
+		defer cancel()
+		var logsResponse *rpcproto.LogsResponse
+		logsResponse, err = client.GetLogs(reqCtx, &rpcproto.LogsRequest{
+			MaxLines: int32(*lines),
+		})
+		if err == nil {
+			for _, minerLog := range logsResponse.MinerLogs {
+				bundle.AddMinerLog(minerLog.Key, minerLog.Logs)
+			}
+		}
+	}
+	if err != nil {
+		bundle.Problem("Unable to get the miner logs from the miner controller: %s", err)
+	}
+
+	err = bundle.Write(*bundlePath)
+	if err != nil {
+		return ctx.fail(err, "")
+	}
+	absolutePath, err := filepath.Abs(*bundlePath)
+	if err != nil {
+		absolutePath = *bundlePath
+	}
+	result := DiagnosticsResult{
+		Status:   helper.StepOK,
+		Path:     absolutePath,
+		Problems: append([]string{}, bundle.Problems()...),
+	}
+	return ctx.write(&result, func(writer io.Writer) {
+		fmt.Fprintf(writer, "Diagnostics saved to %s\n", result.Path)
+		if len(result.Problems) > 0 {
+			fmt.Fprintf(writer, "Some details could not be collected:\n")
+		}
+		for _, problem := range result.Problems {
+			fmt.Fprintf(writer, "  %s\n", problem)
+		}
+		fmt.Fprintf(writer, "Attach the file to your report, your mining key and other secrets have been removed.\n")
+	})
+}
+
+// runUninstall runs the installed uninstaller
+func runUninstall(args []string) int {
+	ctx := newCommandContext("uninstall")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+	record, code := loadRecord(ctx)
+	if record == nil {
+		return code
+	}
+
+	uninstaller := "uninstall-mininghq"
+	if strings.ToLower(runtime.GOOS) == "windows" {
+		uninstaller = "uninstall-mininghq.exe"
+	}
+	cmd := exec.Command(filepath.Join(record.InstallPath, uninstaller), "-output", *ctx.output)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// The uninstaller has reported the failure itself
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+		return ExitFailed
+	}
+	if err != nil {
+		return ctx.fail(err, fmt.Sprintf(`
+We were unable to run the uninstaller, please run '%s' from your installation
+directory.`, uninstaller))
+	}
+	return ExitOK
+}
+
+// runUpgrade upgrades or repairs the installation with the files of the
+// package the installer is run from
+func runUpgrade(args []string) int {
+	ctx := newCommandContext("upgrade")
+	repair := ctx.flags.Bool("repair", false, "Replace all files, not only those that changed")
+	miningKey := ctx.flags.String("mining-key", "", "Your mining key, only needed if the installed mining key file is missing")
+	miningKeyFile := ctx.flags.String("mining-key-file", "", "Path to the file containing your mining key (default \"mining_key\")")
+	if ctx.parse(args) == false {
+		return ExitInvalidOptions
+	}
+
+	options := InstallOptions{
+		MiningKey:     *miningKey,
+		MiningKeyFile: *miningKeyFile,
+	}
+	err := options.Validate()
+	if err != nil {
+		return ctx.fail(err, "")
+	}
+	mode := install.ModeUpgrade
+	if *repair {
+		mode = install.ModeRepair
+	}
+
+	progress, err := helper.NewProgress(*ctx.output)
+	if err != nil {
+		return ctx.fail(err, "")
+	}
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return ctx.fail(err, "")
+	}
+	mhqInstaller, err := NewInstaller(homeDir, runtime.GOOS, apiEndpoint)
+	if err != nil {
+		return ctx.fail(err, "")
+	}
+	err = mhqInstaller.Upgrade(options, mode, progress)
+	progress.Finish(exitCodeFor(err), err)
+	return exitCodeFor(err)
+}
+
+// loadRecord loads the installation record. If MiningHQ isn't installed,
+// the failure is reported and the exit code returned
+func loadRecord(ctx *commandContext) (*state.Record, int) {
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return nil, ctx.fail(err, "")
+	}
+	record, err := state.Load(homeDir)
+	if err == nil && record.Installed() == false {
+		err = fmt.Errorf("The installation directory '%s' does not exist", record.InstallPath)
+	}
+	if err != nil {
+		return nil, ctx.fail(err, "Run the installer without a command to install MiningHQ.")
+	}
+	return record, ExitOK
+}
+
+// minerStats returns the stats of every miner
+func minerStats(
+	ctx context.Context,
+	client rpcproto.ManagerServiceClient) ([]MinerStatsResult, error) {
+
+	statsResponse, err := client.GetStats(ctx, &rpcproto.StatsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if statsResponse == nil {
+		return nil, errors.New("The controller returned no stats")
+	}
+	stats := []MinerStatsResult{}
+	for _, minerStats := range statsResponse.Stats {
+		stats = append(stats, MinerStatsResult{
+			Miner:          minerStats.Key,
+			Hashrate:       minerStats.Hashrate,
+			TotalShares:    minerStats.TotalShares,
+			AcceptedShares: minerStats.AcceptedShares,
+			RejectedShares: minerStats.RejectedShares,
+			RejectionRate:  helper.RejectionRate(minerStats.AcceptedShares, minerStats.RejectedShares),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Miner < stats[j].Miner
+	})
+	return stats, nil
+}
+
+// totalStats combines the stats of all miners into one
+func totalStats(stats []MinerStatsResult) MinerStatsResult {
+	total := MinerStatsResult{
+		Miner: "total",
+	}
+	for _, miner := range stats {
+		total.Hashrate += miner.Hashrate
+		total.TotalShares += miner.TotalShares
+		total.AcceptedShares += miner.AcceptedShares
+		total.RejectedShares += miner.RejectedShares
+	}
+	total.RejectionRate = helper.RejectionRate(total.AcceptedShares, total.RejectedShares)
+	return total
+}
@@ -24,7 +24,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -35,7 +34,8 @@ import (
 	"github.com/fatih/color"
 	"github.com/mininghq/miner-controller/src/mhq"
 	"github.com/mininghq/miner/helper"
-	"github.com/otiai10/copy"
+	"github.com/mininghq/miner/helper/install"
+	"github.com/mininghq/miner/helper/state"
 	input "github.com/tcnksm/go-input"
 )
 
@@ -86,14 +86,20 @@ func NewInstaller(homeDir string, os string, mhqEndpoint string) (*Installer, er
 }
 
 // Install the miner manager using a synchronous process,
-// no feedback is given to the caller via channels
-func (installer *Installer) Install() error {
+// no feedback is given to the caller via channels. Questions answered in
+// options are not asked, with options.AssumeYes set the installation runs
+// without any prompts. The result of every step is reported to progress,
+// failures are returned as an *InstallError
+func (installer *Installer) Install(options InstallOptions, progress *helper.Progress) error {
 
 	// Note: This will not be the prettiest code you'll ever see :)
 	// If anyone has some good advice in controlling the output for this process,
 	// feel free to let me know
 
-	fmt.Println(`
+	// In JSON mode stdout is reserved for the progress events
+	out := progress.Output()
+
+	fmt.Fprint(out, `
     __  ____      _           __ ______
    /  |/  (_)__  (_)__  ___ _/ // / __ \
   / /|_/ / / _ \/ / _ \/ _ '/ _  / /_/ /
@@ -108,104 +114,255 @@ and see this rig's stats - all from your dashboard.
 Let's set up this rig.
 
 We refer to any computer used to mine cryptocurrencies as a rig.
+
 `)
 
-	ui := &input.UI{}
-	installDir := filepath.Join(installer.homeDir, "MiningHQ")
-	rigName := "My first rig"
+	ui := &input.UI{Writer: out}
+	defaultInstallDir := filepath.Join(installer.homeDir, "MiningHQ")
+	if options.SystemWide {
+		defaultInstallDir = state.SystemInstallPath()
+	}
+	defaultRigName := "My first rig"
 
 	hostName, err := os.Hostname()
 	if err == nil {
-		rigName = fmt.Sprintf("%s Rig", hostName)
-	}
-	rigName = strings.Title(strings.ToLower(rigName))
-
-	question := "\nWhere should the services be installed to? "
-	response, _ := ui.Ask(question, &input.Options{
-		Default:  installDir,
-		Required: true,
-		Loop:     true,
-	})
-	installDir = response
-
-	question = "\nWhat would you like to name this rig? "
-	response, _ = ui.Ask(question, &input.Options{
-		Default:  rigName,
-		Required: true,
-		Loop:     true,
-	})
-	rigName = response
-
-	color.Yellow(`
+		defaultRigName = fmt.Sprintf("%s Rig", hostName)
+	}
+	defaultRigName = strings.Title(strings.ToLower(defaultRigName))
+
+	// The mining key is needed to register the rig, and to deregister it
+	// again if the installation fails
+	miningKeyPath := options.MiningKeyFile
+	miningKeySource := fmt.Sprintf("the file '%s' contains", miningKeyPath)
+	if options.MiningKey != "" {
+		miningKeySource = "the mining key you provided is"
+	}
+	apiCreateError := fmt.Sprintf(`
+We were unable to connect to the MiningHQ API to register your rig.
+Please check that the file '%s' is present in the same directory you are
+running the installer from. If not, please download the Miner Manager again
+from https://www.mininghq.io/rigs
+`,
+		miningKeyPath)
+
+	// A mining key given directly takes the place of the mining key file
+	miningKey := options.MiningKey
+	if miningKey == "" {
+		progress.Start("load_mining_key", "")
+		miningKey, err = helper.GetMiningKeyFromFile(miningKeyPath)
+		if err != nil {
+			progress.Fail(err, apiCreateError)
+			return newInstallError(ExitRegisterFailed, err)
+		}
+		progress.OK("")
+	}
+
+	// The installer is moved to the installation path as the Miner Manager
+	managerBinaryPath, err := os.Executable()
+	if err != nil {
+		progress.Start("install_manager", "")
+		progress.Fail(err, `
+We were unable to find the miner manager to copy to your installation path.
+`)
+		return newInstallError(ExitInstallFailed, err)
+	}
+
+	// hints tell the user how to resolve a failed step, they are set once
+	// the installation directory is known
+	var hints map[string]string
+	var tx *install.Transaction
+	report := func(stepID string, status string, err error) {
+		label := fmt.Sprintf("%-40s", installLabels[stepID])
+		switch status {
+		case install.StatusStarted:
+			progress.Start(stepID, label)
+		case install.StatusDone:
+			if stepID == install.StepRegisterRig {
+				progress.OK(fmt.Sprintf("Rig ID '%s'", tx.Value(install.ValueRigID)))
+				return
+			}
+			progress.OK("")
+		case install.StatusResumed:
+			progress.Start(stepID, label)
+			progress.OK("Completed by the interrupted installation")
+		case install.StatusFailed:
+			progress.Fail(err, hints[stepID])
+		case install.StatusUndone:
+			progress.Start("undo_"+stepID, fmt.Sprintf("%-40s", "Undo: "+installLabels[stepID]))
+			progress.OK("")
+		case install.StatusUndoFailed:
+			progress.Start("undo_"+stepID, fmt.Sprintf("%-40s", "Undo: "+installLabels[stepID]))
+			progress.Fail(err, `
+We were unable to undo this step. Run the installer again to resume the
+installation, or uninstall MiningHQ to remove it.
+`)
+		}
+	}
+
+	journalPath := filepath.Join(installer.homeDir, install.JournalFilename)
+	tx, err = install.Open(journalPath, "", report)
+	if err != nil {
+		progress.Start("open_journal", "")
+		progress.Fail(err, fmt.Sprintf(`
+Remove the file '%s' and run the installer again.
+`, journalPath))
+		return newInstallError(ExitFailed, err)
+	}
+
+	// An interrupted installation is resumed, unless another installation
+	// directory was asked for. Then the interrupted installation is undone
+	if tx.Resumed() && options.InstallDir != "" && options.InstallDir != tx.InstallPath() {
+		color.New(color.FgYellow).Fprintf(out, "\nUndoing the interrupted installation to '%s'\n", tx.InstallPath())
+		_, interruptedSteps := installer.installation(tx.InstallPath(), miningKey, managerBinaryPath, options.SystemWide, options.ManagerTLS)
+		err = tx.Rollback(interruptedSteps)
+		if err != nil {
+			return newInstallError(ExitRollbackFailed, err)
+		}
+	}
+
+	// Questions answered by flags, the environment or an answers file are
+	// not asked. When running unattended, the defaults are used instead
+	installDir := options.InstallDir
+	if tx.Resumed() {
+		installDir = tx.InstallPath()
+		color.New(color.FgYellow).Fprintf(out, "\nResuming the interrupted installation to '%s'\n", installDir)
+	}
+	if installDir == "" && options.AssumeYes {
+		installDir = defaultInstallDir
+	}
+	if installDir == "" {
+		question := "\nWhere should the services be installed to? "
+		installDir, _ = ui.Ask(question, &input.Options{
+			Default:  defaultInstallDir,
+			Required: true,
+			Loop:     true,
+		})
+	}
+
+	rigName := options.RigName
+	if rigName == "" && options.AssumeYes {
+		rigName = defaultRigName
+	}
+	if rigName == "" {
+		question := "\nWhat would you like to name this rig? "
+		rigName, _ = ui.Ask(question, &input.Options{
+			Default:  defaultRigName,
+			Required: true,
+			Loop:     true,
+		})
+	}
+
+	color.New(color.FgYellow).Fprintf(out, `
 The MiningHQ Miner Manager will now download and install the
 required services, please verify the installation details below
 `)
 
-	fmt.Println()
-	fmt.Printf("Installation directory: '%s'\n", installDir)
-	fmt.Printf("Rig name: \t\t'%s'\n", rigName)
-	fmt.Println()
-
-	question = "\nDo you want to continue? [Y/yes/N/no]"
-	response, _ = ui.Ask(question, &input.Options{
-		Required: true,
-		Loop:     true,
-		ValidateFunc: func(s string) error {
-			validConfirmations := map[string]bool{
-				"y":   true,
-				"yes": true,
-				"n":   true,
-				"no":  true,
-			}
-			answer := strings.ToLower(s)
-			if _, ok := validConfirmations[answer]; !ok {
-				return fmt.Errorf(
-					"Answer '%s' is invalid. Must be 'y', 'yes', 'n' or 'no'", s)
-			}
-			return nil
-		},
-	})
-	allowContinue := strings.ToLower(response)
-	if allowContinue == "n" || allowContinue == "no" {
-		color.HiRed("***************************************")
-		color.HiRed("* The installation has been cancelled *")
-		color.HiRed("***************************************")
-		color.HiYellow(`
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Installation directory: '%s'\n", installDir)
+	fmt.Fprintf(out, "Rig name: \t\t'%s'\n", rigName)
+	fmt.Fprintln(out)
+
+	if options.AssumeYes == false {
+		question := "\nDo you want to continue? [Y/yes/N/no]"
+		response, _ := ui.Ask(question, &input.Options{
+			Required: true,
+			Loop:     true,
+			ValidateFunc: func(s string) error {
+				validConfirmations := map[string]bool{
+					"y":   true,
+					"yes": true,
+					"n":   true,
+					"no":  true,
+				}
+				answer := strings.ToLower(s)
+				if _, ok := validConfirmations[answer]; !ok {
+					return fmt.Errorf(
+						"Answer '%s' is invalid. Must be 'y', 'yes', 'n' or 'no'", s)
+				}
+				return nil
+			},
+		})
+		allowContinue := strings.ToLower(response)
+		if allowContinue == "n" || allowContinue == "no" {
+			color.New(color.FgHiRed).Fprintln(out, "***************************************")
+			color.New(color.FgHiRed).Fprintln(out, "* The installation has been cancelled *")
+			color.New(color.FgHiRed).Fprintln(out, "***************************************")
+			color.New(color.FgHiYellow).Fprint(out, `
 Something wrong? If so, please let us know by getting in contact
 via our help channels listed at https://www.mininghq.io/connect
 `)
-		os.Exit(0)
+			return newInstallError(ExitCancelled, errors.New("The installation has been cancelled"))
+		}
 	}
 
-	// Create the installation directory
-	fmt.Print("Creating installation directory\t\t")
-	avExcludeDirectory, err := helper.CreateInstallDirectories(installDir)
-	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
+	hints = map[string]string{
+		install.StepCreateDirectories: fmt.Sprintf(`
 We could not create one or more of the installation directories. Please
 ensure you have sufficient permissions (like Administrator or root) access
 to create directories in '%s'.
 `,
-			installDir)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
+			installDir),
+		install.StepRegisterRig: fmt.Sprintf(`
+We were unable to register your rig with MiningHQ. Please ensure that
+you are connected to the internet and that %s the same
+mining key that you can find under 'Mining' in your settings available at
+https://www.mininghq.io/user/settings
+
+If you are sure everything is in order, please contact support to resolve
+the issue. Support can be contacted via our help channels listed at
+https://www.mininghq.io/connect
+`,
+			miningKeySource),
+		install.StepCreateConfig: `
+We were unable to create the new rig files for your installation.
+`,
+		install.StepInstallFiles: fmt.Sprintf(`
+We were unable to install the service files. Please ensure you have write
+permissions to the directory '%s'
+`,
+			installDir),
+		install.StepEnableAutostart: `
+We were unable to set the miner service to autostart.
+`,
+		install.StepInstallManager: `
+We were unable to copy the miner manager to your installation path.
+
+Please ensure you have the correct permissions to write to your install directory.
+`,
+		install.StepRecordInstallPath: `
+We were unable to save the installation record. This
+will cause MiningHQ services to be unable to detect the installation.
+
+Please ensure you have the correct permissions to write to your configuration directory.
+`,
 	}
-	// Installation directory created
-	color.HiGreen("OK")
+
+	// Every step that changes the system is run through the transaction,
+	// if one fails the steps before it are undone
+	installation, steps := installer.installation(installDir, miningKey, managerBinaryPath, options.SystemWide, options.ManagerTLS)
+	err = tx.SetInstallPath(installDir)
+	if err != nil {
+		progress.Start("open_journal", "")
+		progress.Fail(err, fmt.Sprintf(`
+Remove the file '%s' and run the installer again.
+`, journalPath))
+		return newInstallError(ExitFailed, err)
+	}
+	err = tx.Run(steps[:1])
+	if err != nil {
+		return installStepError(err)
+	}
+	avExcludeDirectory := tx.Value(install.ValueAVExcludeDirectory)
 
 	blinking := color.New(color.BlinkSlow, color.FgHiYellow)
-	fmt.Println()
-	fmt.Println("***************************************")
-	fmt.Println("*   A note about antivirus software   *")
-	fmt.Print("*")
-	blinking.Print("         action required             ")
-	fmt.Print("*\n")
-	fmt.Println("***************************************")
-	fmt.Printf(`
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "***************************************")
+	fmt.Fprintln(out, "*   A note about antivirus software   *")
+	fmt.Fprint(out, "*")
+	blinking.Fprint(out, "         action required             ")
+	fmt.Fprint(out, "*\n")
+	fmt.Fprintln(out, "***************************************")
+	fmt.Fprintf(out, `
 Cryptocurrency miners are detected by most antivirus
 software and removed even though they don't contain any
 viruses. To use this computer to mine cryptocurrencies you
@@ -224,45 +381,65 @@ You can follow the following instructions on how to exclude the directory: %s
 		helper.GetOSAVGuides(),
 	)
 
-	fmt.Println()
-	bold := color.New(color.Bold, color.Underline)
-	bold.Println("Please exclude the directory from your antivirus now")
-	question = "\nHave you excluded the directory? [Y/yes/N/no]"
-	response, _ = ui.Ask(question, &input.Options{
-		Required: true,
-		Loop:     true,
-		ValidateFunc: func(s string) error {
-			validConfirmations := map[string]bool{
-				"y":   true,
-				"yes": true,
-				"n":   true,
-				"no":  true,
-			}
-			answer := strings.ToLower(s)
-			if _, ok := validConfirmations[answer]; !ok {
-				return fmt.Errorf(
-					"Answer '%s' is invalid. Must be 'y', 'yes', 'n' or 'no'", s)
-			}
-			return nil
-		},
-	})
-	allowContinue = strings.ToLower(response)
-	if allowContinue == "n" || allowContinue == "no" {
-		color.HiRed("****************************************")
-		color.HiRed("* You must exclude the miner directory *")
-		color.HiRed("****************************************")
-		color.HiYellow(`
+	fmt.Fprintln(out)
+	progress.Start("av_exclusion", "")
+	excluded := options.AcceptAVExclusion
+	if excluded == false && options.AssumeYes == false {
+		bold := color.New(color.Bold, color.Underline)
+		bold.Fprintln(out, "Please exclude the directory from your antivirus now")
+		question := "\nHave you excluded the directory? [Y/yes/N/no]"
+		response, _ := ui.Ask(question, &input.Options{
+			Required: true,
+			Loop:     true,
+			ValidateFunc: func(s string) error {
+				validConfirmations := map[string]bool{
+					"y":   true,
+					"yes": true,
+					"n":   true,
+					"no":  true,
+				}
+				answer := strings.ToLower(s)
+				if _, ok := validConfirmations[answer]; !ok {
+					return fmt.Errorf(
+						"Answer '%s' is invalid. Must be 'y', 'yes', 'n' or 'no'", s)
+				}
+				return nil
+			},
+		})
+		allowContinue := strings.ToLower(response)
+		excluded = allowContinue == "y" || allowContinue == "yes"
+	}
+	if excluded == false {
+		color.New(color.FgHiRed).Fprintln(out, "****************************************")
+		color.New(color.FgHiRed).Fprintln(out, "* You must exclude the miner directory *")
+		color.New(color.FgHiRed).Fprintln(out, "****************************************")
+		hint := fmt.Sprintf(`
+Exclude the directory '%s' from your antivirus and run the installer again.
+
 Something wrong? If so, please let us know by getting in contact
 via our help channels listed at https://www.mininghq.io/connect
-`)
-		os.Exit(0)
+`, avExcludeDirectory)
+		if options.AssumeYes {
+			// Unattended installs can't be asked, the exclusion must be
+			// confirmed up front
+			hint = fmt.Sprintf(`
+Exclude the directory '%s' from your antivirus and confirm it by
+passing -accept-av-exclusion or setting MHQ_ACCEPT_AV_EXCLUSION=true
+`, avExcludeDirectory)
+		}
+		err = fmt.Errorf("The directory '%s' has not been excluded from antivirus scanning", avExcludeDirectory)
+		progress.Fail(err, hint)
+		if rollbackErr := tx.Rollback(steps); rollbackErr != nil {
+			return newInstallError(ExitRollbackFailed, rollbackErr)
+		}
+		return newInstallError(ExitAVNotExcluded, err)
 	}
+	progress.OK(avExcludeDirectory)
 
-	fmt.Print("Gather rig capabilities\t\t\t")
+	progress.Start("gather_capabilities", fmt.Sprintf("%-40s", "Gather rig capabilities"))
 	systemInfo, err := caps.GetSystemInfo()
 	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
+		progress.Fail(err, `
 We were unable to determine the capabilities of this rig. Please ensure you
 have sufficient permissions to check installed hardware on this system.
 
@@ -270,277 +447,32 @@ If you are sure you have the permissions, please contact support to resolve
 the issue. Support can be contacted via our help channels listed at
 https://www.mininghq.io/connect
 `)
-		fmt.Printf(color.HiRedString(
-			"Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
-	}
-	// Installation directory created
-	color.HiGreen("OK")
-
-	// Register this rig with MiningHQ
-	miningKeyPath := "mining_key"
-	fmt.Print("Register rig with MiningHQ\t\t")
-	apiCreateError := fmt.Sprintf(`
-We were unable to connect to the MiningHQ API to register your rig.
-Please check that the file '%s' is present in the same directory you are
-running the installer from. If not, please download the Miner Manager again
-from https://www.mininghq.io/rigs
-`,
-		miningKeyPath)
-
-	miningKey, err := helper.GetMiningKeyFromFile(miningKeyPath)
-	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Println(apiCreateError)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
-	}
-
-	apiClient, err := mhq.NewClient(miningKey, installer.mhqEndpoint)
-	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Println(apiCreateError)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
+		if rollbackErr := tx.Rollback(steps); rollbackErr != nil {
+			return newInstallError(ExitRollbackFailed, rollbackErr)
+		}
+		return newInstallError(ExitCapabilitiesFailed, err)
 	}
+	// Capabilities gathered
+	progress.OK("")
 
-	registerRequest := mhq.RegisterRigRequest{
+	installation.Register = mhq.RegisterRigRequest{
 		Name: rigName,
 		Caps: systemInfo,
 	}
-	rigID, err := apiClient.RegisterRig(registerRequest)
-	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
-We were unable to register your rig with MiningHQ. Please ensure that
-you are connected to the internet and that the file '%s' contains the same
-mining key that you can find under 'Mining' in your settings available at
-https://www.mininghq.io/user/settings
-
-If you are sure everything is in order, please contact support to resolve
-the issue. Support can be contacted via our help channels listed at
-https://www.mininghq.io/connect
-`,
-			miningKeyPath)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
-	}
-	// Rig registered
-	color.HiGreen("OK")
-
-	// To create the config files we need to do two things
-	// 1. Copy the mining_key to the installation directory
-	// 2. Create a rig_id file in the installation directory
-	fmt.Print("Create config files\t\t\t")
-	err = copy.Copy(
-		miningKeyPath,
-		filepath.Join(installDir, "miner-controller", filepath.Base(miningKeyPath)))
-	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
-We were unable to copy your mining key to your installation.
-`)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
-	}
-
-	err = ioutil.WriteFile(
-		filepath.Join(installDir, "miner-controller", "rig_id"),
-		[]byte(rigID),
-		0644)
-	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
-We were unable to create the new rig files for your installation.
-`)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
-	}
-
-	// Config files created
-	color.HiGreen("OK")
-
-	// We package a bunch of helper applications with the download. It needs
-	// to be moved to the installation directory
-	fmt.Print("Installing MiningHQ Miner\n")
-
-	installFiles := map[string]string{
-		"miner-service": "miner-service",
-		//"service-installer": "install-service",
-		"uninstaller": "uninstall-mininghq",
-	}
-
-	for _, src := range installFiles {
-		err = helper.CopyFile(filepath.Join("tools", src), filepath.Join(installDir, src))
-		if err != nil {
-			color.HiRed("FAIL")
-			fmt.Printf(`
-We were unable to install the service files. Please ensure you have write
-permissions to the directory '%s'
-		`, installDir)
-			fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-			fmt.Println()
-			fmt.Println()
-			color.Unset()
-			os.Exit(1)
-		}
-	}
-
-	// NOTE We are no longer installing as a service. On Windows too many issues
-	// are casued by the multi-fork/update process. No we install an autostart
-	// file that starts the services on boot. It has the nice side effect
-	// of not needing sudo rights
-	//
-	// Install mininghq-miner as a service
-	// We do this using a separate executable so that only the service install
-	// requires Administrator/sudo rights and not the entire installer
-	// out, err := exec.Command(
-	// 	"sudo",
-	// 	filepath.Join(installDir, installFiles["service-installer"]),
-	// 	"-op", "install",
-	// 	"-serviceName", installer.serviceName,
-	// 	"-serviceDisplayName", installer.serviceDisplayName,
-	// 	"-serviceDescription", installer.serviceDescription,
-	// 	"-installedPath", installDir,
-	// 	"-serviceFilename", installFiles["miner-service"],
-	// 	"-username", currentUser.Username,
-	// ).CombinedOutput()
-	// if err != nil {
-	// 	color.HiRed("FAIL")
-	// 	fmt.Println("We were unable to install the miner service.")
-	// 	fmt.Printf(color.HiRedString("Include the following error in your report '%s', %s"), err.Error(), out)
-	// 	fmt.Println()
-	// 	fmt.Println()
-	// 	color.Unset()
-	// 	os.Exit(1)
-	// }
-	// END NOTE
-
-	// Install mininhq-miner as an autostart
-	app := &autostart.App{
-		Name:        installer.serviceName,
-		DisplayName: installer.serviceDisplayName,
-		Exec:        []string{filepath.Join(installDir, installFiles["miner-service"])},
-	}
-	if app.IsEnabled(false) == false {
-		err = app.Enable(false)
-		if err != nil {
-			color.HiRed("FAIL")
-			fmt.Println("We were unable to set the miner service to autostart.")
-			fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-			fmt.Println()
-			fmt.Println()
-			color.Unset()
-			os.Exit(1)
-		}
-	}
-
-	installedCheckfilePath := filepath.Join(installer.homeDir, ".mhqpath")
-	installedCheckfile, err := os.OpenFile(
-		installedCheckfilePath,
-		os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
-		0644)
-	if err != nil {
-		fmt.Printf(`
-We were unable to create the installer check file in ~/.mhqpath. This
-will cause MiningHQ services to be unable to detect the installation.
-
-Please ensure you have the correct permissions to write to your home directory.
-`)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-	}
-	defer installedCheckfile.Close()
-
-	_, err = installedCheckfile.WriteString(installDir)
+	err = tx.Run(steps)
 	if err != nil {
-		fmt.Printf(`
-We were unable to write to the installer check file in ~/.mhqpath. This
-will cause MiningHQ services to be unable to detect the installation.
-
-Please ensure you have the correct permissions to write to your home directory.
-`)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		os.Exit(0)
+		return installStepError(err)
 	}
-
-	// Copy the manager
-	managerBinaryPath, err := os.Executable()
+	err = tx.Commit()
 	if err != nil {
-		fmt.Printf(`
-We were unable to copy the miner manager to your installation path.
-
-Please ensure you have the correct permissions to write to your install directory.
-	`)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		os.Exit(0)
-	}
-
-	managerName := filepath.Base(managerBinaryPath)
-	err = os.Rename(managerBinaryPath, filepath.Join(installDir, managerName))
-	if err != nil {
-		fmt.Printf(`
-We were unable to copy the miner manager to your installation path.
-
-Please ensure you have the correct permissions to write to your home directory.
-	`)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		os.Exit(0)
+		// The installation is complete, a stale journal is only resumed
+		// if MiningHQ is uninstalled again
+		fmt.Fprintf(out, "Unable to remove the installation journal '%s': %s\n", journalPath, err)
 	}
 
-	// Service installed
-	color.HiGreen("OK")
-
-	// NOTE We no longer run MiningHQ as a service, just a background process
-	// Start the mininghq-miner service
-	// We do this using a separate executable so that only the service install
-	// requires Administrator/sudo rights and not the entire installer
-	// 	out, err = exec.Command(
-	// 		"sudo",
-	// 		filepath.Join(installDir, installFiles["service-installer"]),
-	// 		"-op", "start",
-	// 		"-serviceName", installer.serviceName,
-	// 		"-serviceDisplayName", installer.serviceDisplayName,
-	// 		"-serviceDescription", installer.serviceDescription,
-	// 		"-installedPath", installDir,
-	// 		"-serviceFilename", installFiles["miner-service"],
-	// 	).CombinedOutput()
-	// 	if err != nil {
-	// 		fmt.Printf(`
-	// Unable to start the MiningHQ service, please start the 'MiningHQ-Miner' service manually. Reason: %s, %s
-	// 		`, err.Error(), out)
-	// 	}
-	// END NOTE
-	cmd := exec.Command(filepath.Join(installDir, installFiles["miner-service"]))
-	err = cmd.Start()
-	if err != nil {
-		fmt.Printf(`
-Unable to start the MiningHQ service, please start the 'MiningHQ-Miner' service manually. Reason: %s
-		 `, err.Error())
-	}
+	installer.startService(installDir, progress)
 
-	fmt.Printf(`
+	fmt.Fprintf(out, `
 
 
 *************************
@@ -562,7 +494,98 @@ Let's mine!
 The MiningHQ Team
 	`, installDir)
 
-	fmt.Println()
-	fmt.Println()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
 	return nil
 }
+
+// startService starts the installed service
+func (installer *Installer) startService(installDir string, progress *helper.Progress) {
+	// NOTE We no longer run MiningHQ as a service, just a background process
+	// started by the autostart entry
+	progress.Start("start_service", "")
+	cmd := exec.Command(filepath.Join(installDir, installFiles["miner-service"]))
+	err := cmd.Start()
+	if err != nil {
+		progress.Notice(err, `
+Unable to start the MiningHQ service, please start the 'MiningHQ-Miner' service manually.`)
+	} else {
+		progress.OK("")
+	}
+}
+
+// installFiles maps the services to the files installed from the
+// tools directory
+var installFiles = map[string]string{
+	"miner-service": "miner-service",
+	"uninstaller":   "uninstall-mininghq",
+}
+
+// installLabels are shown for the installation steps
+var installLabels = map[string]string{
+	install.StepCreateDirectories: "Creating installation directory",
+	install.StepRegisterRig:       "Register rig with MiningHQ",
+	install.StepCreateConfig:      "Create config files",
+	install.StepInstallFiles:      "Installing MiningHQ Miner",
+	install.StepEnableAutostart:   "Enable automatic start",
+	install.StepInstallManager:    "Installing Miner Manager",
+	install.StepRecordInstallPath: "Record installation path",
+}
+
+// installation describes the installation to installDir for the shared
+// installation steps
+func (installer *Installer) installation(
+	installDir string,
+	miningKey string,
+	managerBinaryPath string,
+	systemWide bool,
+	managerTLS bool) (*install.Installation, []install.Step) {
+
+	var files []string
+	for _, filename := range installFiles {
+		files = append(files, filename)
+	}
+	installation := install.Installation{
+		HomeDir:     installer.homeDir,
+		InstallPath: installDir,
+		MiningKey:   miningKey,
+		APIEndpoint: installer.mhqEndpoint,
+		ToolsPath:   "tools",
+		Files:       files,
+		// We no longer install as a service. On Windows too many issues are
+		// caused by the multi-fork/update process. Now we install an autostart
+		// file that starts the services on boot. It has the nice side effect
+		// of not needing sudo rights
+		Autostart: &autostart.App{
+			Name:        installer.serviceName,
+			DisplayName: installer.serviceDisplayName,
+			Exec:        []string{filepath.Join(installDir, installFiles["miner-service"])},
+		},
+		ManagerPath: managerBinaryPath,
+		ManagerName: filepath.Base(managerBinaryPath),
+		SystemWide:  systemWide,
+		ManagerTLS:  managerTLS,
+	}
+	return &installation, install.Steps(&installation)
+}
+
+// installStepError converts an error from the installation transaction to
+// an *InstallError with the exit code of the failed step
+func installStepError(err error) error {
+	stepErr, ok := err.(*install.StepError)
+	if ok == false {
+		return newInstallError(ExitFailed, err)
+	}
+	if stepErr.RollbackErr != nil {
+		return newInstallError(ExitRollbackFailed, err)
+	}
+	switch stepErr.StepID {
+	case install.StepCreateDirectories:
+		return newInstallError(ExitDirectoryFailed, err)
+	case install.StepRegisterRig:
+		return newInstallError(ExitRegisterFailed, err)
+	case install.StepCreateConfig:
+		return newInstallError(ExitConfigFailed, err)
+	}
+	return newInstallError(ExitInstallFailed, err)
+}
@@ -32,12 +32,15 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"runtime"
 
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/install"
+	"github.com/mininghq/miner/helper/state"
 	homedir "github.com/mitchellh/go-homedir"
 )
 
@@ -50,64 +53,139 @@ const (
 // main is the main runnable of the application
 func main() {
 
-	homeDir, err := homedir.Dir()
-	if err != nil {
-		fmt.Printf("Unable to get user home directory: %s\n", err)
+	// An installed rig is managed with subcommands, without one the
+	// installer runs
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command.run(os.Args[2:]))
+		}
+		if os.Args[1] == "install" {
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
 	}
-
-	mhqInstaller, err := NewInstaller(homeDir, runtime.GOOS, apiEndpoint)
+	flag.Usage = commandUsage
+
+	// Answers are read from the answers file first, then overridden by
+	// the environment and finally by any flags given on the command line
+	answersPath := flag.String("answers", "", "Path to a JSON answers file for unattended installs")
+	installDir := flag.String("install-dir", "", "Directory to install the services to")
+	rigName := flag.String("rig-name", "", "Name of this rig on MiningHQ")
+	miningKey := flag.String("mining-key", "", "Your mining key, instead of reading it from the mining key file")
+	miningKeyFile := flag.String("mining-key-file", "", "Path to the file containing your mining key (default \"mining_key\")")
+	acceptAVExclusion := flag.Bool("accept-av-exclusion", false, "Confirm the miner directory is excluded from antivirus scanning")
+	assumeYes := flag.Bool("yes", false, "Install without any prompts, using the defaults for unanswered questions")
+	upgrade := flag.Bool("upgrade", false, "Upgrade an existing installation, replacing the files that changed")
+	repair := flag.Bool("repair", false, "Repair an existing installation, replacing all files and restoring missing ones")
+	systemWide := flag.Bool("system-wide", false, "Install for all users, this usually requires root or Administrator access")
+	managerTLS := flag.Bool("manager-tls", false, "Secure the miner controller's manager API with a self-signed certificate")
+	output := flag.String("output", helper.OutputText, "Output format, 'text' or 'json' for one JSON event per step")
+	flag.Parse()
+
+	progress, err := helper.NewProgress(*output)
 	if err != nil {
-		fmt.Printf("Unable to create installer: %s\n", err)
-		return
+		fmt.Println(err)
+		os.Exit(ExitInvalidOptions)
+	}
+	// exit reports the final result and exits with its code
+	exit := func(exitCode int, err error) {
+		progress.Finish(exitCode, err)
+		os.Exit(exitCode)
+	}
+	// invalidOptions reports a problem with the answers given
+	invalidOptions := func(err error) {
+		progress.Start("load_options", "")
+		progress.Fail(err, "Please correct the flags, environment or answers file and try again.")
+		exit(ExitInvalidOptions, err)
 	}
 
-	if isInstalled() {
-		fmt.Println("MiningHQ is already installed.")
-		return
-
+	var options InstallOptions
+	if *answersPath != "" {
+		options, err = LoadAnswersFile(*answersPath)
+		if err != nil {
+			invalidOptions(err)
+		}
 	}
-	err = mhqInstaller.Install()
+	err = options.ApplyEnvironment()
 	if err != nil {
-		fmt.Println("ERR", err)
+		invalidOptions(err)
 	}
-	return
-
-}
-
-// isInstalled checks if the Miner Manager has been installed already.
-//
-// The Miner Manager acts as both installer and manager. We need to decide
-// which one to execute based on the installed services
-func isInstalled() bool {
-	// We created a file $USERHOME/.mhqpath containing the installation dir
-	// If the path exists in .mhqpath then the services are installed
-	homeDir, err := homedir.Dir()
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "install-dir":
+			options.InstallDir = *installDir
+		case "rig-name":
+			options.RigName = *rigName
+		case "mining-key":
+			options.MiningKey = *miningKey
+		case "mining-key-file":
+			options.MiningKeyFile = *miningKeyFile
+		case "accept-av-exclusion":
+			options.AcceptAVExclusion = *acceptAVExclusion
+		case "yes":
+			options.AssumeYes = *assumeYes
+		case "system-wide":
+			options.SystemWide = *systemWide
+		case "manager-tls":
+			options.ManagerTLS = *managerTLS
+		}
+	})
+	err = options.Validate()
 	if err != nil {
-		fmt.Printf(
-			`Unable to find your home directory: %s\n
-
-Please contact our support via our help channels listed at https://www.mininghq.io/help
-`, err)
-		os.Exit(1)
+		invalidOptions(err)
 	}
 
-	installedCheckfilePath := filepath.Join(homeDir, ".mhqpath")
-	installedPath, err := ioutil.ReadFile(installedCheckfilePath)
+	homeDir, err := homedir.Dir()
 	if err != nil {
-		// if the mhqpath file doesn't exist, nothing is installed
-		return false
+		fmt.Fprintf(progress.Output(), "Unable to get user home directory: %s\n", err)
 	}
 
-	// Check if installedPath exists
-	info, err := os.Stat(string(installedPath))
+	mhqInstaller, err := NewInstaller(homeDir, runtime.GOOS, apiEndpoint)
 	if err != nil {
-		return false
+		fmt.Fprintf(progress.Output(), "Unable to create installer: %s\n", err)
+		exit(ExitFailed, err)
 	}
 
-	// If it is a directory, then the services should be installed
-	if info.IsDir() {
-		return true
+	// The Miner Manager acts as both installer and manager, the installation
+	// record tells us which one to run
+	mode := ""
+	if *upgrade {
+		mode = install.ModeUpgrade
+	}
+	if *repair {
+		mode = install.ModeRepair
+	}
+	if *upgrade && *repair {
+		invalidOptions(errors.New("Only one of -upgrade or -repair may be given"))
 	}
 
-	return false
+	installed, err := state.IsInstalled(homeDir)
+	if err != nil {
+		// Installing again would register the rig a second time
+		progress.Start("find_installation", "")
+		progress.Fail(err, `
+We were unable to read the record of your existing installation. Restore the
+file from a backup or correct it, then run the installer again. Remove it
+only if you want to install MiningHQ again.`)
+		exit(ExitFailed, err)
+	}
+	if installed {
+		if mode == "" {
+			fmt.Fprintln(progress.Output(), `MiningHQ is already installed. Run the installer with -upgrade or -repair
+to update it, or with a command like 'status' to manage this rig. Run with
+-help to see all commands.`)
+			exit(ExitOK, nil)
+		}
+		err = mhqInstaller.Upgrade(options, mode, progress)
+		exit(exitCodeFor(err), err)
+	}
+	if mode != "" {
+		err = errors.New("MiningHQ is not installed")
+		progress.Start("find_installation", "")
+		progress.Fail(err, "Run the installer without -upgrade or -repair to install MiningHQ.")
+		exit(ExitUpgradeFailed, err)
+	}
+	// The installer reports failures to the user itself, we only need to
+	// exit with the code of the step that failed
+	err = mhqInstaller.Install(options, progress)
+	exit(exitCodeFor(err), err)
 }
@@ -0,0 +1,225 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes returned by the installer so that provisioning tools can tell
+// what went wrong without parsing the output
+const (
+	// ExitOK is returned when the installation completed
+	ExitOK = 0
+	// ExitFailed is returned for failures not covered by another code
+	ExitFailed = 1
+	// ExitCancelled is returned when the user cancelled the installation
+	ExitCancelled = 2
+	// ExitInvalidOptions is returned when the flags, environment or answers
+	// file are invalid
+	ExitInvalidOptions = 3
+	// ExitDirectoryFailed is returned when the installation directories
+	// could not be created
+	ExitDirectoryFailed = 10
+	// ExitAVNotExcluded is returned when the miner directory was not
+	// excluded from antivirus scanning
+	ExitAVNotExcluded = 11
+	// ExitCapabilitiesFailed is returned when the rig capabilities could
+	// not be determined
+	ExitCapabilitiesFailed = 12
+	// ExitRegisterFailed is returned when the rig could not be registered
+	// with MiningHQ
+	ExitRegisterFailed = 13
+	// ExitConfigFailed is returned when the config files could not be created
+	ExitConfigFailed = 14
+	// ExitInstallFailed is returned when the services could not be installed
+	ExitInstallFailed = 15
+	// ExitRollbackFailed is returned when the installation failed and the
+	// completed steps could not all be undone. Running the installer again
+	// resumes the installation
+	ExitRollbackFailed = 16
+	// ExitUpgradeFailed is returned when an upgrade or repair failed
+	ExitUpgradeFailed = 17
+)
+
+// Environment variables that can be used instead of flags
+const (
+	// EnvInstallDir sets the installation directory
+	EnvInstallDir = "MHQ_INSTALL_DIR"
+	// EnvRigName sets the name of the rig
+	EnvRigName = "MHQ_RIG_NAME"
+	// EnvMiningKey sets the mining key
+	EnvMiningKey = "MHQ_MINING_KEY"
+	// EnvMiningKeyFile sets the path to the file containing the mining key
+	EnvMiningKeyFile = "MHQ_MINING_KEY_FILE"
+	// EnvAcceptAVExclusion confirms the miner directory is excluded from
+	// antivirus scanning
+	EnvAcceptAVExclusion = "MHQ_ACCEPT_AV_EXCLUSION"
+	// EnvAssumeYes answers yes to the installation confirmation
+	EnvAssumeYes = "MHQ_ASSUME_YES"
+	// EnvSystemWide installs for all users
+	EnvSystemWide = "MHQ_SYSTEM_WIDE"
+	// EnvManagerTLS secures the manager API with a self-signed certificate
+	EnvManagerTLS = "MHQ_MANAGER_TLS"
+)
+
+// InstallError is returned when the installation fails, it carries the
+// exit code for the failed step
+type InstallError struct {
+	// ExitCode is the process exit code for this failure
+	ExitCode int
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements error
+func (err *InstallError) Error() string {
+	return err.Err.Error()
+}
+
+// newInstallError creates a new InstallError
+func newInstallError(exitCode int, err error) *InstallError {
+	return &InstallError{
+		ExitCode: exitCode,
+		Err:      err,
+	}
+}
+
+// exitCodeFor returns the process exit code for an error returned
+// by the installer
+func exitCodeFor(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if installErr, ok := err.(*InstallError); ok {
+		return installErr.ExitCode
+	}
+	return ExitFailed
+}
+
+// InstallOptions holds the answers to the installer's questions. Any
+// answer that is set is not asked for
+type InstallOptions struct {
+	// InstallDir is the directory to install the services to
+	InstallDir string `json:"install_dir"`
+	// RigName is the name of the rig on MiningHQ
+	RigName string `json:"rig_name"`
+	// MiningKey is the user's mining key. When empty, the key is read
+	// from MiningKeyFile
+	MiningKey string `json:"mining_key"`
+	// MiningKeyFile is the file containing the user's mining key
+	MiningKeyFile string `json:"mining_key_file"`
+	// AcceptAVExclusion confirms the miner directory has been excluded from
+	// antivirus scanning
+	AcceptAVExclusion bool `json:"accept_av_exclusion"`
+	// AssumeYes answers yes to the installation confirmation. Questions
+	// without an answer use their defaults instead of prompting
+	AssumeYes bool `json:"yes"`
+	// SystemWide installs for all users. The installation record is saved
+	// in the system configuration directory instead of the user's
+	SystemWide bool `json:"system_wide"`
+	// ManagerTLS generates a self-signed certificate the miner controller's
+	// manager API is secured with
+	ManagerTLS bool `json:"manager_tls"`
+}
+
+// LoadAnswersFile reads install options from a JSON answers file
+func LoadAnswersFile(path string) (InstallOptions, error) {
+	var options InstallOptions
+	answersBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return options, fmt.Errorf("Unable to read answers file '%s': %s", path, err)
+	}
+	err = json.Unmarshal(answersBytes, &options)
+	if err != nil {
+		return options, fmt.Errorf("Answers file '%s' is malformed: %s", path, err)
+	}
+	return options, nil
+}
+
+// ApplyEnvironment overrides the options with the values of any of the
+// MHQ_* environment variables that are set
+func (options *InstallOptions) ApplyEnvironment() error {
+	if value, ok := os.LookupEnv(EnvInstallDir); ok {
+		options.InstallDir = value
+	}
+	if value, ok := os.LookupEnv(EnvRigName); ok {
+		options.RigName = value
+	}
+	if value, ok := os.LookupEnv(EnvMiningKey); ok {
+		options.MiningKey = value
+	}
+	if value, ok := os.LookupEnv(EnvMiningKeyFile); ok {
+		options.MiningKeyFile = value
+	}
+	if value, ok := os.LookupEnv(EnvAcceptAVExclusion); ok {
+		accept, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %s", EnvAcceptAVExclusion, err)
+		}
+		options.AcceptAVExclusion = accept
+	}
+	if value, ok := os.LookupEnv(EnvAssumeYes); ok {
+		yes, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %s", EnvAssumeYes, err)
+		}
+		options.AssumeYes = yes
+	}
+	if value, ok := os.LookupEnv(EnvSystemWide); ok {
+		systemWide, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %s", EnvSystemWide, err)
+		}
+		options.SystemWide = systemWide
+	}
+	if value, ok := os.LookupEnv(EnvManagerTLS); ok {
+		managerTLS, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %s", EnvManagerTLS, err)
+		}
+		options.ManagerTLS = managerTLS
+	}
+	return nil
+}
+
+// Validate checks that the options can be used to install
+func (options *InstallOptions) Validate() error {
+	options.InstallDir = strings.TrimSpace(options.InstallDir)
+	options.RigName = strings.TrimSpace(options.RigName)
+	options.MiningKey = strings.TrimSpace(options.MiningKey)
+	options.MiningKeyFile = strings.TrimSpace(options.MiningKeyFile)
+
+	if options.MiningKey != "" && options.MiningKeyFile != "" {
+		return errors.New("Only one of the mining key or the mining key file may be set")
+	}
+	if options.MiningKey == "" && options.MiningKeyFile == "" {
+		options.MiningKeyFile = "mining_key"
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/install"
+	"github.com/mininghq/miner/helper/state"
+)
+
+// upgradeLabels are shown for the upgrade steps
+var upgradeLabels = map[string]string{
+	install.StepStopServices:      "Stopping services",
+	install.StepRepairDirectories: "Repair installation directories",
+	install.StepRepairConfig:      "Repair config files",
+	install.StepReplaceComponents: "Replace MiningHQ Miner files",
+	install.StepUpdateRecord:      "Update installation record",
+}
+
+// Upgrade upgrades or repairs the existing installation with the files
+// of this package. In install.ModeUpgrade only the components that differ
+// are replaced, install.ModeRepair replaces all of them. The rig is not
+// registered again. Failures are returned as an *InstallError
+func (installer *Installer) Upgrade(
+	options InstallOptions,
+	mode string,
+	progress *helper.Progress) error {
+
+	progress.Start("find_installation", "")
+	record, err := state.Load(installer.homeDir)
+	if err != nil {
+		progress.Fail(err, `
+We were unable to find the existing installation. Run the installer without
+-upgrade or -repair to install MiningHQ.`)
+		return newInstallError(ExitUpgradeFailed, err)
+	}
+	progress.OK(record.InstallPath)
+
+	out := progress.Output()
+	fmt.Fprintf(out, `
+    __  ____      _           __ ______
+   /  |/  (_)__  (_)__  ___ _/ // / __ \
+  / /|_/ / / _ \/ / _ \/ _ '/ _  / /_/ /
+ /_/  /_/_/_//_/_/_//_/\_, /_//_/\___\_\
+                     /___/ Miner Installer
+                           www.mininghq.io
+
+This will %s the MiningHQ Miner installed in '%s'.
+Your rig stays registered, the MiningHQ services are stopped while the
+files are replaced.
+
+`, mode, record.InstallPath)
+
+	// The mining key is only needed if the mining key file of the
+	// installation is missing
+	miningKey := options.MiningKey
+	if miningKey == "" {
+		miningKey, _ = helper.GetMiningKeyFromFile(options.MiningKeyFile)
+	}
+	// The installer replaces the installed Miner Manager
+	managerBinaryPath, _ := os.Executable()
+	installation, _ := installer.installation(
+		record.InstallPath,
+		miningKey,
+		managerBinaryPath,
+		record.SystemWide,
+		false)
+
+	hints := map[string]string{
+		install.StepStopServices: `
+We were unable to stop the MiningHQ services. Please stop the services
+manually and try again.`,
+		install.StepRepairDirectories: fmt.Sprintf(`
+We could not create one or more of the installation directories. Please
+ensure you have sufficient permissions to create directories in '%s'.`,
+			record.InstallPath),
+		install.StepRepairConfig: fmt.Sprintf(`
+We were unable to restore the config files of your installation. If the mining
+key file is missing, place your mining key in the file '%s' and try again.`,
+			options.MiningKeyFile),
+		install.StepReplaceComponents: fmt.Sprintf(`
+We were unable to replace the MiningHQ files. Please ensure you are running
+the installer from the extracted package and have write permissions to the
+directory '%s'. The files replaced so far are restored, your installation
+has not been changed unless restoring them failed.`,
+			record.InstallPath),
+		install.StepUpdateRecord: `
+We were unable to save the installation record. Please ensure you have the
+correct permissions to write to your configuration directory.`,
+	}
+	report := func(stepID string, status string, err error) {
+		switch status {
+		case install.StatusStarted:
+			progress.Start(stepID, fmt.Sprintf("%-40s", upgradeLabels[stepID]))
+		case install.StatusDone:
+			progress.OK("")
+		case install.StatusFailed:
+			progress.Fail(err, hints[stepID])
+		case install.StatusUndone:
+			progress.Start("undo_"+stepID, fmt.Sprintf("%-40s", "Restore previous MiningHQ Miner files"))
+			progress.OK("Your installation has not been changed")
+		case install.StatusUndoFailed:
+			progress.Start("undo_"+stepID, fmt.Sprintf("%-40s", "Restore previous MiningHQ Miner files"))
+			progress.Fail(err, fmt.Sprintf(`
+We were unable to restore the MiningHQ files replaced so far, your
+installation may be incomplete. Run the installer with -repair to replace
+all files in '%s'.`,
+				record.InstallPath))
+		}
+	}
+
+	result, err := install.Upgrade(installation, record, mode, report)
+	if result != nil && len(result.Replaced) > 0 {
+		fmt.Fprintf(out, "Replaced %s\n", strings.Join(result.Replaced, ", "))
+	}
+	// The stopped services are started again, with the restored files if
+	// the upgrade failed
+	if result != nil && result.ServicesStopped {
+		installer.startService(record.InstallPath, progress)
+	}
+	if err != nil {
+		return newInstallError(ExitUpgradeFailed, err)
+	}
+
+	version := result.ToVersion
+	if result.FromVersion != "" && result.FromVersion != result.ToVersion {
+		version = fmt.Sprintf("%s (from %s)", result.ToVersion, result.FromVersion)
+	}
+	fmt.Fprintf(out, `
+
+MiningHQ Miner %s is installed in '%s'.
+%d files replaced, %d files unchanged.
+
+`, version, record.InstallPath, len(result.Replaced), len(result.Unchanged))
+	return nil
+}
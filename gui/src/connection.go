@@ -0,0 +1,172 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/rpcproto/rpcproto"
+	"google.golang.org/grpc"
+)
+
+const (
+	// requestTimeout limits how long a request to the controller may take
+	// before the controller is considered unavailable
+	requestTimeout = time.Second * 10
+	// connectTimeout limits how long a reconnect attempt may take
+	connectTimeout = time.Second * 5
+	// minReconnectDelay is the wait before the first reconnect attempt, it
+	// doubles after every failed attempt
+	minReconnectDelay = time.Second
+	// maxReconnectDelay is the longest wait between reconnect attempts
+	maxReconnectDelay = time.Second * 30
+)
+
+// States of the connection to the miner controller sent to Electron
+const (
+	// connectionConnected means the controller is responding
+	connectionConnected = "connected"
+	// connectionReconnecting means the controller is unavailable and the
+	// manager is waiting to reconnect
+	connectionReconnecting = "reconnecting"
+)
+
+// connectionUpdate is sent to Electron when the connection to the miner
+// controller changes
+type connectionUpdate struct {
+	// State is connectionConnected or connectionReconnecting
+	State string `json:"state"`
+	// Address is the address of the controller
+	Address string `json:"address"`
+	// Error is why the controller is unavailable
+	Error string `json:"error,omitempty"`
+	// RetryIn is the number of seconds until the next reconnect attempt
+	RetryIn int `json:"retry_in,omitempty"`
+}
+
+// client returns the client to the miner controller's manager API
+func (gui *Manager) client() rpcproto.ManagerServiceClient {
+	gui.connMutex.Lock()
+	defer gui.connMutex.Unlock()
+	return gui.managerClient
+}
+
+// setup sends the rig's name and link to Electron, it is the first request
+// made once the controller is available
+func (gui *Manager) setup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	response, err := gui.client().GetInfo(ctx, &rpcproto.RigInfoRequest{})
+	if err != nil {
+		gui.logger.WithField(
+			"method", "setup",
+		).Errorf("Unable to query miner controller: %s", err)
+		return err
+	}
+
+	gui.updateTrayLink(response.Link)
+
+	// This includes a link to the rig on MiningHQ as well as the
+	// rig name. This is injected into the frontend for display purposes
+	err = gui.sendElectronCommand("setup", map[string]string{
+		"name": response.Name,
+		"link": response.Link,
+	})
+	if err != nil {
+		gui.logger.WithField(
+			"method", "setup",
+		).Errorf("Unable to send setup to Electron: %s", err)
+	}
+	gui.sendConnectionState(connectionUpdate{
+		State:   connectionConnected,
+		Address: gui.address,
+	})
+	return nil
+}
+
+// reconnect connects to the controller again after it became unavailable
+// with cause. It waits between attempts, doubling the wait every time, and
+// returns once the controller responds and the page is set up again. A
+// refresh request attempts to reconnect immediately
+func (gui *Manager) reconnect(cause error) {
+	delay := minReconnectDelay
+	for {
+		gui.logger.Warnf("Miner controller unavailable, reconnecting in %s: %s", delay, cause)
+		gui.sendConnectionState(connectionUpdate{
+			State:   connectionReconnecting,
+			Address: gui.address,
+			Error:   cause.Error(),
+			RetryIn: int(delay.Seconds()),
+		})
+
+		select {
+		case <-time.After(delay):
+		case <-gui.refresh:
+		}
+
+		cause = gui.connect()
+		if cause == nil {
+			cause = gui.setup()
+		}
+		if cause == nil {
+			gui.logger.Info("Reconnected to miner controller")
+			return
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// connect replaces the connection to the controller, waiting until the
+// new connection is established
+func (gui *Manager) connect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	conn, err := managerapi.DialContext(ctx, gui.installPath, gui.address, grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+
+	gui.connMutex.Lock()
+	previous := gui.conn
+	gui.conn = conn
+	gui.managerClient = rpcproto.NewManagerServiceClient(conn)
+	gui.connMutex.Unlock()
+	previous.Close()
+	return nil
+}
+
+// sendConnectionState sends the connection state to Electron and the tray
+func (gui *Manager) sendConnectionState(update connectionUpdate) {
+	gui.updateTrayConnection(update)
+	err := gui.sendElectronCommand("connection", update)
+	if err != nil {
+		gui.logger.WithField(
+			"method", "connection",
+		).Errorf("Unable to send connection state to Electron: %s", err)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mininghq/miner/helper/diagnostics"
+	"github.com/mininghq/miner/helper/logstore"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// debugLogFilename is the log written when running with debug enabled
+const debugLogFilename = "mininghq_debug.log"
+
+// debugLogPath returns the path of the debug log, next to the executable
+// or in the temp directory if the executable can't be found
+func debugLogPath() string {
+	executable, err := os.Executable()
+	if err != nil {
+		return filepath.Join(os.TempDir(), debugLogFilename)
+	}
+	return filepath.Join(filepath.Dir(executable), debugLogFilename)
+}
+
+// saveDiagnostics writes a diagnostics bundle for support to path. The
+// bundle includes the debug log, of this or an earlier run, and the miner
+// logs kept by the manager. The bundle is returned to report its problems
+func saveDiagnostics(path string, minerLogs []logstore.Entry) (*diagnostics.Bundle, error) {
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+	bundle := diagnostics.Collect(homeDir)
+	bundle.AddFile("logs/manager-debug.log", debugLogPath())
+
+	lines := make(map[string][]string)
+	for _, entry := range minerLogs {
+		lines[entry.Miner] = append(lines[entry.Miner], entry.Text)
+	}
+	var miners []string
+	for miner := range lines {
+		miners = append(miners, miner)
+	}
+	sort.Strings(miners)
+	for _, miner := range miners {
+		bundle.AddMinerLog(miner, lines[miner])
+	}
+	return bundle, bundle.Write(path)
+}
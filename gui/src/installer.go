@@ -38,7 +38,7 @@ import (
 	"github.com/donovansolms/mininghq-spec/spec/caps"
 	"github.com/mininghq/miner-controller/src/mhq"
 	"github.com/mininghq/miner/helper"
-	"github.com/otiai10/copy"
+	"github.com/mininghq/miner/helper/install"
 	"github.com/sirupsen/logrus"
 )
 
@@ -78,6 +78,17 @@ type Installer struct {
 	// Rig related information
 	rigName     string
 	installPath string
+
+	// transaction records the installation steps so that they can be
+	// undone if the installation fails
+	transaction *install.Transaction
+	// installationInfo describes the installation for the steps
+	installationInfo *install.Installation
+	// installSteps are the steps of the installation
+	installSteps []install.Step
+	// installFiles maps the services to the files installed from the
+	// tools directory
+	installFiles map[string]string
 }
 
 // NewInstaller creates a new instance of the graphical installer
@@ -97,6 +108,17 @@ func NewInstaller(
 		homeDir:            homeDir,
 		os:                 systemOS,
 		mhqEndpoint:        apiEndpoint,
+		installFiles: map[string]string{
+			"miner-service": "miner-service",
+			"uninstaller":   "uninstall-mininghq",
+		},
+	}
+	if strings.ToLower(runtime.GOOS) == Windows {
+		gui.installFiles = map[string]string{
+			"miner-service": "miner-service.exe",
+			"runner":        "run-as-service.bat",
+			"uninstaller":   "uninstall-mininghq.exe",
+		}
 	}
 
 	// If no config is specified then this is the first run
@@ -127,15 +149,9 @@ func NewInstaller(
 	if isDebug {
 		logrus.SetLevel(logrus.DebugLevel)
 
-		// Get current path
-		debugLogPath := filepath.Join(os.TempDir(), "mininghq_debug.log")
-		executable, err := os.Executable()
-		if err == nil {
-			debugLogPath = filepath.Join(filepath.Dir(executable), "mininghq_debug.log")
-		}
-
+		var err error
 		gui.debugLog, err = os.OpenFile(
-			debugLogPath,
+			debugLogPath(),
 			os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
 			0644)
 		if err != nil {
@@ -246,9 +262,15 @@ func (gui *Installer) handleElectronCommands(
 	switch command.Name {
 
 	case "get-defaults":
+		// An interrupted installation is resumed in the same directory
+		defaultPath := filepath.Join(gui.homeDir, "MiningHQ")
+		tx, err := install.Open(filepath.Join(gui.homeDir, install.JournalFilename), defaultPath, nil)
+		if err == nil && tx.Resumed() {
+			defaultPath = tx.InstallPath()
+		}
 		return map[string]string{
 			"status":  "ok",
-			"message": filepath.Join(gui.homeDir, "MiningHQ"),
+			"message": defaultPath,
 		}, nil
 
 	case "install":
@@ -277,59 +299,6 @@ func (gui *Installer) handleElectronCommands(
 		gui.rigName = strings.TrimSpace(payload["rigName"])
 		gui.installPath = strings.TrimSpace(payload["installPath"])
 
-		// Send message to electron we're installing
-
-		avExcludeDirectory, err := helper.CreateInstallDirectories(gui.installPath)
-		if err != nil {
-			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-We could not create one or more of the installation directories. Please
-ensure you have sufficient permissions (like Administrator or root) access
-to create directories in '%s'.
-
-Include the following error in your report: %s
-`, gui.installPath, err.Error()),
-			}, nil
-		}
-		// Return the exclude directory for antivirus
-		// and then wait for the confirmation to be sent to us to continue
-		return map[string]string{
-			"status":  "confirm-av",
-			"message": avExcludeDirectory,
-		}, nil
-
-	// Sent after the user confirmed the exclude of the miner path, we can
-	// continue with the install
-	case "confirmed-av":
-
-		// We need to know about the base system specs
-		systemInfo, err := caps.GetSystemInfo()
-		if err != nil {
-
-			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-We were unable to determine the capabilities of this rig. Please ensure you
-have sufficient permissions to check installed hardware on this system.
-</p>
-<p>
-If you are sure you have the permissions, please contact support to resolve
-the issue. Support can be contacted via our help channels listed at
-https://www.mininghq.io/connect
-</p>
-<p>
-Include the following error in your report '%s'"), err.Error())
-</p>`, err.Error()),
-			}, nil
-		}
-
-		_ = gui.sendElectronCommand("install_progress", map[string]string{
-			"status":  "ok",
-			"message": "Gather rig capabilities",
-		})
-
 		miningKeyPath := "mining_key"
 		apiCreateError := fmt.Sprintf(`
 We were unable to connect to the MiningHQ API to register your rig.
@@ -339,7 +308,8 @@ from <a href="https://www.mininghq.io/rigs">https://www.mininghq.io/rigs</a>
 		`,
 			miningKeyPath)
 
-		// Get the mining key for the user
+		// Get the mining key for the user, it is needed to register the rig
+		// and to deregister it again if the installation fails
 		miningKey, err := helper.GetMiningKeyFromFile(miningKeyPath)
 		if err != nil {
 			return map[string]string{
@@ -348,327 +318,110 @@ from <a href="https://www.mininghq.io/rigs">https://www.mininghq.io/rigs</a>
 			}, nil
 		}
 
-		apiClient, err := mhq.NewClient(miningKey, gui.mhqEndpoint)
+		// Every step that changes the system is run through the transaction,
+		// if one fails the steps before it are undone
+		gui.transaction, err = install.Open(
+			filepath.Join(gui.homeDir, install.JournalFilename),
+			gui.installPath,
+			gui.reportInstallStep)
 		if err != nil {
 			return map[string]string{
 				"status":  "error",
-				"message": fmt.Sprintf("%s<br/>Include the following error in your report: %s", apiCreateError, err.Error()),
-			}, nil
-		}
-
-		registerRequest := mhq.RegisterRigRequest{
-			Name: gui.rigName,
-			Caps: systemInfo,
-		}
-		rigID, err := apiClient.RegisterRig(registerRequest)
-		if err != nil {
-
-			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-We were unable to register your rig with MiningHQ. Please ensure that
-you are connected to the internet and that the file '%s' contains the same
-mining key that you can find under 'Mining' in your settings available at
-https://www.mininghq.io/user/settings
-</p>
-<p>
-If you are sure everything is in order, please contact support to resolve
-the issue. Support can be contacted via our help channels listed at
-<a href="https://www.mininghq.io/connect">https://www.mininghq.io/connect</a>
-</p>
-<p>
-Include the following error in your report '%s'
-</p>
-				`, miningKeyPath, err.Error()),
-			}, nil
-		}
-
-		_ = gui.sendElectronCommand("install_progress", map[string]string{
-			"status":  "ok",
-			"message": "Register rig with MiningHQ",
-		})
-
-		// Creating files and copying
-		err = copy.Copy(
-			miningKeyPath,
-			filepath.Join(gui.installPath, "miner-controller", filepath.Base(miningKeyPath)))
-		if err != nil {
-
-			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-We were unable to copy your mining key to your installation.
-</p>
-<p>
-Include the following error in your report '%s'
-</p>
-				`, err.Error()),
-			}, nil
-		}
-
-		err = ioutil.WriteFile(
-			filepath.Join(gui.installPath, "miner-controller", "rig_id"),
-			[]byte(rigID),
-			0644)
-		if err != nil {
-
-			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-We were unable to create the new rig files for your installation.
-</p>
-<p>
-Include the following error in your report '%s'
-</p>
-				`, err.Error()),
+				"message": fmt.Sprintf("Unable to resume the previous installation: %s", err.Error()),
 			}, nil
 		}
-
-		_ = gui.sendElectronCommand("install_progress", map[string]string{
-			"status":  "ok",
-			"message": "Create config files",
-		})
-
-		// Copy installation files
-		installFiles := map[string]string{
-			"miner-service": "miner-service",
-			//"service-installer": "install-service",
-			"uninstaller": "uninstall-mininghq",
-		}
-		if strings.ToLower(runtime.GOOS) == Windows {
-			installFiles = map[string]string{
-				"miner-service": "miner-service.exe",
-				"runner":        "run-as-service.bat",
-				//"service-installer": "install-service.exe",
-				"uninstaller": "uninstall-mininghq.exe",
-			}
-		}
-
-		for _, src := range installFiles {
-			err = helper.CopyFile(filepath.Join("tools", src), filepath.Join(gui.installPath, src))
+		if gui.transaction.Resumed() && gui.transaction.InstallPath() != gui.installPath {
+			// A different directory was chosen, the interrupted installation
+			// is undone first
+			_, interruptedSteps := gui.installation(gui.transaction.InstallPath(), miningKey)
+			err = gui.transaction.Rollback(interruptedSteps)
 			if err != nil {
 				return map[string]string{
 					"status": "error",
 					"message": fmt.Sprintf(`
 <p>
-We were unable to install the service files. Please ensure you have write
-permissions to the directory '%s'
+We were unable to undo the previous installation to '%s'.
 </p>
 <p>
 Include the following error in your report '%s'
 </p>
-								`, gui.installPath, err.Error()),
-				}, nil
-			}
-		}
-
-		// NOTE We no longer run as a service, but rather and autostart
-		// Install mininghq-miner as a service
-		// We do this using a separate executable so that only the service install
-		// requires Administrator/sudo rights and not the entire installer
-		// For Linux we use the PolicyKit exec function,
-		// For Windows we embed a manifest file to request admin right
-		// var out []byte
-		// if strings.ToLower(runtime.GOOS) == "windows" {
-		//
-		// 	out, err = exec.Command(
-		// 		"cmd.exe", "/C",
-		// 		filepath.Join(gui.installPath, installFiles["service-installer"]),
-		// 		"-op", "install",
-		// 		"-serviceName", gui.serviceName,
-		// 		"-serviceDisplayName", gui.serviceDisplayName,
-		// 		"-serviceDescription", gui.serviceDescription,
-		// 		"-installedPath", gui.installPath,
-		// 		"-serviceFilename", installFiles["miner-service"],
-		// 		"-username", currentUser.Username,
-		// 	).CombinedOutput()
-		// } else {
-		// 	out, err = exec.Command(
-		// 		"pkexec",
-		// 		filepath.Join(gui.installPath, installFiles["service-installer"]),
-		// 		"-op", "install",
-		// 		"-serviceName", gui.serviceName,
-		// 		"-serviceDisplayName", gui.serviceDisplayName,
-		// 		"-serviceDescription", gui.serviceDescription,
-		// 		"-installedPath", gui.installPath,
-		// 		"-serviceFilename", installFiles["miner-service"],
-		// 		"-username", currentUser.Username,
-		// 	).CombinedOutput()
-		// }
-		// END NOTE
-
-		app := &autostart.App{
-			Name:        gui.serviceName,
-			DisplayName: gui.serviceDisplayName,
-			Exec:        []string{filepath.Join(gui.installPath, installFiles["miner-service"])},
-		}
-		if strings.ToLower(runtime.GOOS) == "windows" {
-			// To run in the background on Windows we need a helper script
-			app = &autostart.App{
-				Name:        gui.serviceName,
-				DisplayName: gui.serviceDisplayName,
-				// C:\Users\Donovan\MiningHQ\run.bat "C:\Users\Donovan\MiningHQ\miner-service.exe" -arguments "-b" -showWindow 0 -title "MiningHQ"
-				Exec: []string{
-					filepath.Join(gui.installPath, installFiles["runner"]),
-					filepath.Join(gui.installPath, installFiles["miner-service"]),
-					"-showWindow", "0",
-					"-title", "MiningHQ"},
-			}
-		}
-		if app.IsEnabled(false) == false {
-			err = app.Enable(false)
-			if err != nil {
-				return map[string]string{
-					"status": "error",
-					"message": fmt.Sprintf(`
-						<p>
-						We were unable to install the miner service.
-						</p>
-						<p>
-						Include the following error in your report '%s'
-						</p>
-						`, err.Error()),
+					`, gui.transaction.InstallPath(), err.Error()),
 				}, nil
 			}
 		}
 
-		installedCheckfilePath := filepath.Join(gui.homeDir, ".mhqpath")
-		installedCheckfile, err := os.OpenFile(
-			installedCheckfilePath,
-			os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
-			0644)
+		gui.installationInfo, gui.installSteps = gui.installation(gui.installPath, miningKey)
+		err = gui.transaction.SetInstallPath(gui.installPath)
 		if err != nil {
 			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-We were unable to create the installer check file in ~/.mhqpath. This
-will cause MiningHQ services to be unable to detect the installation.
-</p>
-<p>
-Please ensure you have the correct permissions to write to your home directory.
-</p>
-<p>
-Include the following error in your report '%s'
-</p>
-				`, err.Error()),
+				"status":  "error",
+				"message": fmt.Sprintf("Unable to record the installation: %s", err.Error()),
 			}, nil
 		}
-		defer installedCheckfile.Close()
-
-		_, err = installedCheckfile.WriteString(gui.installPath)
+		err = gui.transaction.Run(gui.installSteps[:1])
 		if err != nil {
-			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-We were unable to write to the installer check file in ~/.mhqpath. This
-will cause MiningHQ services to be unable to detect the installation.
-</p>
-<p>
-Please ensure you have the correct permissions to write to your home directory.
-</p>
-<p>
-Include the following error in your report '%s'
-</p>
-				`, err.Error()),
-			}, nil
+			return gui.installStepError(err), nil
 		}
 
-		// Copy the manager
-		managerBinaryPath, err := os.Executable()
-		if err != nil {
+		// Return the exclude directory for antivirus
+		// and then wait for the confirmation to be sent to us to continue
+		return map[string]string{
+			"status":  "confirm-av",
+			"message": gui.transaction.Value(install.ValueAVExcludeDirectory),
+		}, nil
+
+	// Sent after the user confirmed the exclude of the miner path, we can
+	// continue with the install
+	case "confirmed-av":
+
+		if gui.transaction == nil {
 			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-We were unable to copy the miner manager to your installation path.
-</p>
-<p>
-Please ensure you have the correct permissions to write to your install directory.
-</p>
-<p>
-Include the following error in your report '%s'
-</p>
-				`, err.Error()),
+				"status":  "error",
+				"message": "The installation has not been started",
 			}, nil
 		}
 
-		if strings.ToLower(runtime.GOOS) == Windows {
-			err = os.Rename(managerBinaryPath, filepath.Join(gui.installPath, "MiningHQ Miner Manager.exe"))
-		} else {
-			err = os.Rename(managerBinaryPath, filepath.Join(gui.installPath, "MiningHQ Miner Manager"))
-		}
+		// We need to know about the base system specs
+		systemInfo, err := caps.GetSystemInfo()
 		if err != nil {
-
+			gui.transaction.Rollback(gui.installSteps)
 			return map[string]string{
 				"status": "error",
 				"message": fmt.Sprintf(`
 <p>
-We were unable to copy the miner manager to your installation path.
+We were unable to determine the capabilities of this rig. Please ensure you
+have sufficient permissions to check installed hardware on this system.
 </p>
 <p>
-Please ensure you have the correct permissions to write to your install directory.
+If you are sure you have the permissions, please contact support to resolve
+the issue. Support can be contacted via our help channels listed at
+https://www.mininghq.io/connect
 </p>
 <p>
-Include the following error in your report '%s'
-</p>
-				`, err.Error()),
+Include the following error in your report '%s'"), err.Error())
+</p>`, err.Error()),
 			}, nil
 		}
 
 		_ = gui.sendElectronCommand("install_progress", map[string]string{
 			"status":  "ok",
-			"message": "Installing MiningHQ Miner",
+			"message": "Gather rig capabilities",
 		})
 
-		// NOTE We no longer run as a service but rather as autostart
-		// Start the mininghq-miner service
-		// We do this using a separate executable so that only the service install
-		// requires Administrator/sudo rights and not the entire installer
-		// if strings.ToLower(runtime.GOOS) == "windows" {
-		// 	out, err = exec.Command(
-		// 		"cmd.exe", "/C",
-		// 		filepath.Join(gui.installPath, installFiles["service-installer"]),
-		// 		"-op", "start",
-		// 		"-serviceName", gui.serviceName,
-		// 		"-serviceDisplayName", gui.serviceDisplayName,
-		// 		"-serviceDescription", gui.serviceDescription,
-		// 		"-installedPath", gui.installPath,
-		// 		"-serviceFilename", installFiles["miner-service"],
-		// 		"-username", currentUser.Username,
-		// 	).CombinedOutput()
-		// } else {
-		// 	out, err = exec.Command(
-		// 		"pkexec",
-		// 		filepath.Join(gui.installPath, installFiles["service-installer"]),
-		// 		"-op", "start",
-		// 		"-serviceName", gui.serviceName,
-		// 		"-serviceDisplayName", gui.serviceDisplayName,
-		// 		"-serviceDescription", gui.serviceDescription,
-		// 		"-installedPath", gui.installPath,
-		// 		"-serviceFilename", installFiles["miner-service"],
-		// 		"-username", currentUser.Username,
-		// 	).CombinedOutput()
-		// }
-		cmd := exec.Command(filepath.Join(gui.installPath, installFiles["miner-service"]))
-		if strings.ToLower(runtime.GOOS) == "windows" {
-			cmd = exec.Command(
-				filepath.Join(gui.installPath, installFiles["runner"]),
-				filepath.Join(gui.installPath, installFiles["miner-service"]),
-				"-showWindow", "0",
-				"-title", "MiningHQ",
-			)
+		gui.installationInfo.Register = mhq.RegisterRigRequest{
+			Name: gui.rigName,
+			Caps: systemInfo,
 		}
-		err = cmd.Start()
+		err = gui.transaction.Run(gui.installSteps)
 		if err != nil {
-			fmt.Printf(`
-	Unable to start the MiningHQ service, please start the 'MiningHQ-Miner' service manually. Reason: %s
-			 `, err.Error())
+			return gui.installStepError(err), nil
 		}
+		err = gui.transaction.Commit()
+		if err != nil {
+			gui.logger.Warningf("Unable to remove the installation journal: %s", err)
+		}
+
+		err = gui.startService(gui.installPath)
 		if err != nil {
 			return map[string]string{
 				"status": "error",
@@ -690,7 +443,7 @@ Include the following error in your report '%s'
 		if strings.ToLower(runtime.GOOS) == "windows" {
 
 			// To run in the background on Windows we need a helper script
-			app = &autostart.App{
+			app := &autostart.App{
 				Name:        "MiningHQ Miner Manager",
 				DisplayName: "MiningHQ Miner Manager",
 				Exec:        []string{filepath.Join(gui.installPath, "MiningHQ Miner Manager.exe")},
@@ -746,10 +499,233 @@ Icon=%s/resources/icon.png`,
 		}
 		return username, nil
 
+	// Save-diagnostics is received when the user saves the diagnostics after
+	// the installation failed. The payload is the path to save them to
+	case "save-diagnostics":
+		var path string
+		err := json.Unmarshal(command.Payload, &path)
+		if err != nil {
+			return nil, err
+		}
+		_, err = saveDiagnostics(path, nil)
+		if err != nil {
+			return map[string]string{
+				"status":  "error",
+				"message": fmt.Sprintf("Unable to save the diagnostics: %s", err),
+			}, nil
+		}
+		return map[string]string{
+			"status":  "ok",
+			"message": fmt.Sprintf("Saved the diagnostics to %s, attach the file to your report", path),
+		}, nil
+
 	}
 	return nil, fmt.Errorf("'%s' is an unknown command", command.Name)
 }
 
+// installation describes the installation to installPath for the shared
+// installation steps
+func (gui *Installer) installation(
+	installPath string,
+	miningKey string) (*install.Installation, []install.Step) {
+
+	var files []string
+	for _, filename := range gui.installFiles {
+		files = append(files, filename)
+	}
+
+	// We no longer run as a service, but rather and autostart
+	app := &autostart.App{
+		Name:        gui.serviceName,
+		DisplayName: gui.serviceDisplayName,
+		Exec:        []string{filepath.Join(installPath, gui.installFiles["miner-service"])},
+	}
+	managerName := "MiningHQ Miner Manager"
+	if strings.ToLower(runtime.GOOS) == Windows {
+		// To run in the background on Windows we need a helper script
+		app = &autostart.App{
+			Name:        gui.serviceName,
+			DisplayName: gui.serviceDisplayName,
+			// C:\Users\Donovan\MiningHQ\run.bat "C:\Users\Donovan\MiningHQ\miner-service.exe" -arguments "-b" -showWindow 0 -title "MiningHQ"
+			Exec: []string{
+				filepath.Join(installPath, gui.installFiles["runner"]),
+				filepath.Join(installPath, gui.installFiles["miner-service"]),
+				"-showWindow", "0",
+				"-title", "MiningHQ"},
+		}
+		managerName = "MiningHQ Miner Manager.exe"
+	}
+
+	// The manager moves itself to the installation path. If we can't find
+	// ourselves the step fails and the installation is undone
+	managerBinaryPath, _ := os.Executable()
+
+	installation := install.Installation{
+		HomeDir:     gui.homeDir,
+		InstallPath: installPath,
+		MiningKey:   miningKey,
+		APIEndpoint: gui.mhqEndpoint,
+		ToolsPath:   "tools",
+		Files:       files,
+		Autostart:   app,
+		ManagerPath: managerBinaryPath,
+		ManagerName: managerName,
+	}
+	return &installation, install.Steps(&installation)
+}
+
+// startService starts the installed service
+func (gui *Installer) startService(installPath string) error {
+	// NOTE We no longer run as a service but rather as autostart
+	cmd := exec.Command(filepath.Join(installPath, gui.installFiles["miner-service"]))
+	if strings.ToLower(runtime.GOOS) == "windows" {
+		cmd = exec.Command(
+			filepath.Join(installPath, gui.installFiles["runner"]),
+			filepath.Join(installPath, gui.installFiles["miner-service"]),
+			"-showWindow", "0",
+			"-title", "MiningHQ",
+		)
+	}
+	return cmd.Start()
+}
+
+// installProgressMessages are shown to the user as the installation
+// steps complete
+var installProgressMessages = map[string]string{
+	install.StepCreateDirectories: "Create installation directory",
+	install.StepRegisterRig:       "Register rig with MiningHQ",
+	install.StepCreateConfig:      "Create config files",
+	install.StepInstallFiles:      "Install service files",
+	install.StepEnableAutostart:   "Enable automatic start",
+	install.StepInstallManager:    "Install Miner Manager",
+	install.StepRecordInstallPath: "Installing MiningHQ Miner",
+}
+
+// reportInstallStep sends the progress of the installation steps
+// to Electron
+func (gui *Installer) reportInstallStep(stepID string, status string, err error) {
+	gui.logger.WithFields(logrus.Fields{
+		"step":   stepID,
+		"status": status,
+	}).Info("Installation step")
+
+	message := installProgressMessages[stepID]
+	switch status {
+	case install.StatusDone, install.StatusResumed:
+		// The directories are created before the antivirus confirmation,
+		// the user isn't shown the progress yet
+		if stepID == install.StepCreateDirectories {
+			return
+		}
+		_ = gui.sendElectronCommand("install_progress", map[string]string{
+			"status":  "ok",
+			"message": message,
+		})
+	case install.StatusUndone:
+		_ = gui.sendElectronCommand("install_progress", map[string]string{
+			"status":  "error",
+			"message": fmt.Sprintf("Undone: %s", message),
+		})
+	case install.StatusUndoFailed:
+		gui.logger.Errorf("Unable to undo %s: %s", stepID, err)
+		_ = gui.sendElectronCommand("install_progress", map[string]string{
+			"status":  "error",
+			"message": fmt.Sprintf("Unable to undo: %s", message),
+		})
+	}
+}
+
+// installStepError returns the message shown to the user when an
+// installation step failed
+func (gui *Installer) installStepError(err error) map[string]string {
+	stepErr, ok := err.(*install.StepError)
+	if ok == false {
+		return map[string]string{
+			"status":  "error",
+			"message": err.Error(),
+		}
+	}
+
+	var message string
+	switch stepErr.StepID {
+	case install.StepCreateDirectories:
+		message = fmt.Sprintf(`
+<p>
+We could not create one or more of the installation directories. Please
+ensure you have sufficient permissions (like Administrator or root) access
+to create directories in '%s'.
+</p>`, gui.installPath)
+	case install.StepRegisterRig:
+		message = `
+<p>
+We were unable to register your rig with MiningHQ. Please ensure that
+you are connected to the internet and that the file 'mining_key' contains the same
+mining key that you can find under 'Mining' in your settings available at
+https://www.mininghq.io/user/settings
+</p>
+<p>
+If you are sure everything is in order, please contact support to resolve
+the issue. Support can be contacted via our help channels listed at
+<a href="https://www.mininghq.io/connect">https://www.mininghq.io/connect</a>
+</p>`
+	case install.StepCreateConfig:
+		message = `
+<p>
+We were unable to create the new rig files for your installation.
+</p>`
+	case install.StepInstallFiles:
+		message = fmt.Sprintf(`
+<p>
+We were unable to install the service files. Please ensure you have write
+permissions to the directory '%s'
+</p>`, gui.installPath)
+	case install.StepEnableAutostart:
+		message = `
+<p>
+We were unable to install the miner service.
+</p>`
+	case install.StepInstallManager:
+		message = `
+<p>
+We were unable to copy the miner manager to your installation path.
+</p>
+<p>
+Please ensure you have the correct permissions to write to your install directory.
+</p>`
+	case install.StepRecordInstallPath:
+		message = `
+<p>
+We were unable to save the installation record. This
+will cause MiningHQ services to be unable to detect the installation.
+</p>
+<p>
+Please ensure you have the correct permissions to write to your configuration directory.
+</p>`
+	}
+
+	if stepErr.RollbackErr != nil {
+		message += `
+<p>
+The installation could not be fully undone. Run the installer again to
+resume the installation, or uninstall MiningHQ to remove it.
+</p>`
+	} else {
+		message += `
+<p>
+All the changes made by the installation have been undone.
+</p>`
+	}
+	message += fmt.Sprintf(`
+<p>
+Include the following error in your report '%s'
+</p>`, err.Error())
+
+	return map[string]string{
+		"status":  "error",
+		"message": message,
+	}
+}
+
 // sendElectronCommand sends the given data to Electron under the command name
 func (gui *Installer) sendElectronCommand(
 	name string,
@@ -24,15 +24,14 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
 	"runtime"
 
-	"github.com/mininghq/rpcproto/rpcproto"
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/install"
+	"github.com/mininghq/miner/helper/state"
 	homedir "github.com/mitchellh/go-homedir"
-	"google.golang.org/grpc"
 )
 
 const (
@@ -48,6 +47,9 @@ var AppName string
 func main() {
 
 	debug := flag.Bool("d", false, "Enable debug mode")
+	upgrade := flag.Bool("upgrade", false, "Upgrade the existing installation with the files of this package")
+	repair := flag.Bool("repair", false, "Repair the existing installation with the files of this package")
+	address := flag.String("address", helper.ControllerAddress(), "Address of the miner controller")
 	flag.Parse()
 
 	homeDir, err := homedir.Dir()
@@ -55,22 +57,51 @@ func main() {
 		fmt.Printf("Unable to get user home directory: %s\n", err)
 	}
 
-	if isInstalled() {
-		// Installed, run manager
-		conn, err := grpc.Dial("localhost:64630", grpc.WithInsecure())
+	// The Miner Manager acts as both installer and manager, the installation
+	// record tells us which one to run. Installing again over an existing
+	// installation would register the rig a second time
+	installed, err := state.IsInstalled(homeDir)
+	if err != nil {
+		// Setting the output to stdout so the user can see the error
+		log.SetOutput(os.Stdout)
+		log.Fatalf("Unable to read the installation record, restore or correct it and start the Miner Manager again: %s", err)
+	}
+	if installed && (*upgrade || *repair) {
+		// Upgrades run without the installer window, the manager is
+		// started once the installation is upgraded
+		mode := install.ModeUpgrade
+		if *repair {
+			mode = install.ModeRepair
+		}
+		gui, err := NewInstaller(
+			AppName,
+			Asset,
+			RestoreAssets,
+			homeDir,
+			runtime.GOOS,
+			apiEndpoint,
+			*debug,
+		)
+		if err == nil {
+			err = gui.Upgrade(mode)
+		}
 		if err != nil {
-			panic(err)
+			// Setting the output to stdout so the user can see the error
+			log.SetOutput(os.Stdout)
+			log.Fatalf("Unable to %s the installation: %s", mode, err)
 		}
-		defer conn.Close()
-		client := rpcproto.NewManagerServiceClient(conn)
+	}
 
-		// Start the Electron interface
+	if installed {
+		// Installed, run manager. The manager connects to the controller
+		// itself and reconnects whenever the controller restarts
 		// AppName, Asset and RestoreAssets are injected by the bundler
 		gui, err := NewManager(
-			client,
+			*address,
 			AppName,
 			Asset,
 			RestoreAssets,
+			homeDir,
 			*debug,
 		)
 		if err != nil {
@@ -113,41 +144,3 @@ func main() {
 	}
 
 }
-
-// isInstalled checks if the Miner Manager has been installed already.
-//
-// The Miner Manager acts as both installer and manager. We need to decide
-// which one to execute based on the installed services
-func isInstalled() bool {
-	// We created a file $USERHOME/.mhqpath containing the installation dir
-	// If the path exists in .mhqpath then the services are installed
-	homeDir, err := homedir.Dir()
-	if err != nil {
-		fmt.Printf(`
-Unable to find your home directory: %s\n
-
-Please contact our support via our help channels listed at https://www.mininghq.io/connect
-`, err)
-		os.Exit(1)
-	}
-
-	installedCheckfilePath := filepath.Join(homeDir, ".mhqpath")
-	installedPath, err := ioutil.ReadFile(installedCheckfilePath)
-	if err != nil {
-		// if the mhqpath file doesn't exist, nothing is installed
-		return false
-	}
-
-	// Check if installedPath exists
-	info, err := os.Stat(string(installedPath))
-	if err != nil {
-		return false
-	}
-
-	// If it is a directory, then the services should be installed
-	if info.IsDir() {
-		return true
-	}
-
-	return false
-}
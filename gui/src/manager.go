@@ -27,15 +27,24 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
 	astilectron "github.com/asticode/go-astilectron"
 	bootstrap "github.com/asticode/go-astilectron-bootstrap"
 	"github.com/buildkite/terminal"
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/logstore"
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/miner/helper/schedule"
+	"github.com/mininghq/miner/helper/state"
+	"github.com/mininghq/miner/helper/timeseries"
 	"github.com/mininghq/rpcproto/rpcproto"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 // Manager implements the manager GUI
@@ -44,24 +53,79 @@ type Manager struct {
 	window *astilectron.Window
 	// astilectronOptions holds the Astilectron options
 	astilectronOptions bootstrap.Options
+	// address is the address of the miner controller's manager API
+	address string
+	// installPath is the installation directory, it holds the manager API
+	// credentials, the history files and the tray icons
+	installPath string
+	// connMutex guards conn and managerClient, they are replaced when the
+	// manager reconnects
+	connMutex sync.Mutex
+	// conn is the connection to the miner controller
+	conn *grpc.ClientConn
 	// managerClient is the client to the miner controller's manager API
 	managerClient rpcproto.ManagerServiceClient
 	// logger logs to stdout
 	logger   *logrus.Entry
 	debugLog *os.File
+
+	// app is the running Astilectron app, it is stopped to quit
+	app *astilectron.Astilectron
+	// trayMutex guards tray, trayShown and miningState, the tray menu is
+	// updated by the update loop and clicked in Astilectron's goroutines
+	trayMutex sync.Mutex
+	// tray is the tray menu, nil until Astilectron is running
+	tray *astilectron.Menu
+	// trayShown is what the tray menu shows
+	trayShown trayMenu
+	// miningState is the last mining state of the controller
+	miningState rpcproto.MinerState
+
+	// logs keeps the miner logs read from the controller for searching
+	logs *logstore.Store
+	// logQueryMutex guards logQuery
+	logQueryMutex sync.Mutex
+	// logQuery selects the log entries shown, new entries are only sent
+	// to Electron if they match
+	logQuery logstore.Query
+
+	// updateOnce starts the update loop once
+	updateOnce sync.Once
+	// refresh makes the update loop send everything again
+	refresh chan struct{}
 }
 
-// NewManager creates a new instance of the graphical installer
+// NewManager creates a new instance of the manager for the miner
+// controller at address, for the installation recorded in homeDir
 func NewManager(
-	client rpcproto.ManagerServiceClient,
+	address string,
 	appName string,
 	asset bootstrap.Asset,
 	restoreAssets bootstrap.RestoreAssets,
+	homeDir string,
 	isDebug bool) (*Manager, error) {
 
 	gui := Manager{
-		managerClient: client,
+		address: address,
+		logs:    logstore.New(logstore.DefaultCapacity),
+		refresh: make(chan struct{}, 1),
+	}
+	// The manager may be started from the package by an upgrade, the
+	// installation record has the installation directory
+	record, err := state.Load(homeDir)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find the installation directory: %s", err)
 	}
+	gui.installPath = record.InstallPath
+
+	// The connection is made in the background, a controller that isn't
+	// running yet is reconnected to by the update loop
+	conn, err := managerapi.Dial(gui.installPath, address)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to the miner controller at '%s': %s", address, err)
+	}
+	gui.conn = conn
+	gui.managerClient = rpcproto.NewManagerServiceClient(conn)
 
 	// If no config is specified then this is the first run
 	startPage := "manager.html"
@@ -86,18 +150,17 @@ func NewManager(
 		Center:          astilectron.PtrBool(true),
 		Height:          astilectron.PtrInt(500),
 		Width:           astilectron.PtrInt(980),
+		// Closing the window keeps the manager running in the tray, quit
+		// from the tray menu
+		Custom: &astilectron.WindowCustomOptions{
+			HideOnClose: astilectron.PtrBool(true),
+		},
 	}
 
 	if isDebug {
-		// Get current path
-		debugLogPath := filepath.Join(os.TempDir(), "mininghq_debug.log")
-		executable, err := os.Executable()
-		if err == nil {
-			debugLogPath = filepath.Join(filepath.Dir(executable), "mininghq_debug.log")
-		}
-
+		var err error
 		gui.debugLog, err = os.OpenFile(
-			debugLogPath,
+			debugLogPath(),
 			os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
 			0644)
 		if err != nil {
@@ -147,6 +210,13 @@ func NewManager(
 		"service": "mininghq-manager",
 	})
 
+	// The tray shows the hashrate and state once connected
+	initialTray := trayMenu{
+		status:     "Connecting to the miner controller",
+		pauseLabel: "Pause mining",
+	}
+	gui.trayShown = initialTray
+
 	gui.astilectronOptions = bootstrap.Options{
 		Debug:         isDebug,
 		Asset:         asset,
@@ -161,20 +231,36 @@ func NewManager(
 			AppIconDarwinPath:  "resources/icon.icns",
 			AppIconDefaultPath: "resources/icon.png",
 		},
-		// TODO: Fix this tray to display nicely
-		/*TrayOptions: &astilectron.TrayOptions{
-			Image:   astilectron.PtrStr("/static/i/miner-logo.png"),
+		TrayOptions: &astilectron.TrayOptions{
+			Image:   astilectron.PtrStr(gui.trayIconPath()),
 			Tooltip: astilectron.PtrStr(appName),
-		},*/
-		MenuOptions: menu,
+		},
+		TrayMenuOptions: gui.trayMenuOptions(),
+		MenuOptions:     menu,
 		// OnWait is triggered as soon as the electron window is ready and running
 		OnWait: func(
-			_ *astilectron.Astilectron,
+			app *astilectron.Astilectron,
 			windows []*astilectron.Window,
 			_ *astilectron.Menu,
-			_ *astilectron.Tray,
-			_ *astilectron.Menu) error {
+			tray *astilectron.Tray,
+			trayMenu *astilectron.Menu) error {
+			gui.app = app
 			gui.window = windows[0]
+
+			// Clicking the tray icon shows the window where the platform
+			// supports it, the menu has an item for the others
+			tray.On(astilectron.EventNameTrayEventClicked, func(_ astilectron.Event) bool {
+				gui.showWindow()
+				return false
+			})
+
+			// The stats may have changed the menu before the tray existed
+			gui.trayMutex.Lock()
+			current := gui.trayShown
+			gui.trayShown = initialTray
+			gui.tray = trayMenu
+			gui.showTrayMenu(current)
+			gui.trayMutex.Unlock()
 			return nil
 		},
 	}
@@ -187,7 +273,13 @@ func NewManager(
 func (gui *Manager) Run() error {
 	gui.logger.Info("Starting manager")
 
+	alertsDone := make(chan struct{})
+	go gui.watchAlerts(alertsDone)
 	err := bootstrap.Run(gui.astilectronOptions)
+	close(alertsDone)
+	gui.connMutex.Lock()
+	gui.conn.Close()
+	gui.connMutex.Unlock()
 	if err != nil {
 		return err
 	}
@@ -195,73 +287,328 @@ func (gui *Manager) Run() error {
 	return nil
 }
 
-// updateLoop is executed every X seconds, it fetches the latest state, stats
-// and logs from the miner controller and sends it to the Electron.
-func (gui *Manager) updateLoop() {
+// minerStats holds the stats of a single miner
+type minerStats struct {
+	// Key identifies the miner, ie. the miner and the coin it mines
+	Key string
+	// Hashrate is the hashrate of the miner
+	Hashrate float64
+	// TotalShares is the number of shares submitted
+	TotalShares int64
+	// AcceptedShares is the number of shares accepted by the pool
+	AcceptedShares int64
+	// RejectedShares is the number of shares rejected by the pool
+	RejectedShares int64
+	// RejectionRate is the percentage of the shares that were rejected
+	RejectionRate float64
+}
 
-	var managerUpdate rpcproto.ManagerUpdate
+// statsUpdate is sent to Electron when the stats or state of the miners
+// changed
+type statsUpdate struct {
+	// Hashrate combines the hashrate of all miners
+	Hashrate float64
+	// TotalShares combines the shares of all miners
+	TotalShares int64
+	// AcceptedShares combines the accepted shares of all miners
+	AcceptedShares int64
+	// RejectedShares combines the rejected shares of all miners
+	RejectedShares int64
+	// RejectionRate is the percentage of the shares of all miners that
+	// were rejected
+	RejectionRate float64
+	// Miners holds the stats of every miner, sorted by key
+	Miners []minerStats
+	// State is the mining state
+	State rpcproto.MinerState
+}
 
-	for {
-		gui.logger.Debug("Fetching update information")
+// logLine is a log entry sent to Electron
+type logLine struct {
+	// ID orders the lines
+	ID int64 `json:"id"`
+	// Miner is the key of the miner that logged the line
+	Miner string `json:"miner"`
+	// Time is when the line was logged
+	Time time.Time `json:"time"`
+	// Level is the severity of the line
+	Level string `json:"level"`
+	// HTML is the line rendered as HTML
+	HTML string `json:"html"`
+}
 
-		managerUpdate = rpcproto.ManagerUpdate{
-			Stats: &rpcproto.MinerStats{},
-		}
+// logsUpdate is sent to Electron when new log lines were logged, or the
+// lines shown must be replaced
+type logsUpdate struct {
+	// Lines holds the lines that match the log query
+	Lines []logLine `json:"lines"`
+	// Reset is set when the shown logs must be replaced by Lines
+	Reset bool `json:"reset"`
+	// Matches is the number of lines that match the log query when Reset
+	// is set, only the latest maxLogLines are sent
+	Matches int `json:"matches,omitempty"`
+	// Miners lists the miners that logged lines when Reset is set
+	Miners []string `json:"miners,omitempty"`
+}
+
+// exportRequest is sent by Electron to export log lines to a file
+type exportRequest struct {
+	// Query selects the lines to export
+	Query logstore.Query `json:"query"`
+	// Format is the format of the file, logstore.FormatText or
+	// logstore.FormatJSON
+	Format string `json:"format"`
+	// Path is the file chosen by the user
+	Path string `json:"path"`
+}
 
-		// Get the miner's stats
-		statsResponse, err := gui.managerClient.GetStats(context.Background(), &rpcproto.StatsRequest{})
+const (
+	// statsInterval is how often the stats and state are fetched
+	statsInterval = time.Second * 5
+	// logsInterval is how often the logs are polled for new lines
+	logsInterval = time.Second * 2
+	// maxLogLines is the number of lines shown, they are fetched when the
+	// logs are shown first
+	maxLogLines = 500
+	// tailLogLines is the number of latest lines fetched on every poll,
+	// the new lines are found where they overlap the lines fetched before
+	tailLogLines = 100
+)
+
+// updateLoop fetches the stats, state and logs from the miner controller
+// and sends the changes to Electron. The logs are only rendered and sent
+// for lines that weren't sent before, the stats only when they changed.
+// When the controller can't be reached the loop reconnects, backing off
+// between attempts, and sets up the page again once it is back
+func (gui *Manager) updateLoop() {
+
+	statsTicker := time.NewTicker(statsInterval)
+	defer statsTicker.Stop()
+	logsTicker := time.NewTicker(logsInterval)
+	defer logsTicker.Stop()
+
+	tail := helper.NewLogTail()
+	var lastStats *statsUpdate
+	err := gui.setup()
+	if err == nil {
+		err = gui.updateStats(&lastStats)
+	}
+	if err == nil {
+		err = gui.updateLogs(tail, true)
+	}
+	for {
 		if err != nil {
-			gui.logger.WithField(
-				"op", "GetStats",
-			).Errorf("Unable to get stats from controller: %s", err)
-		} else if statsResponse != nil {
-			// Combine all the miner stats into one
-			for _, stats := range statsResponse.Stats {
-				managerUpdate.Stats.Hashrate += stats.Hashrate
-				managerUpdate.Stats.TotalShares += stats.TotalShares
-				managerUpdate.Stats.AcceptedShares += stats.AcceptedShares
-				managerUpdate.Stats.RejectedShares += stats.RejectedShares
+			gui.reconnect(err)
+			// Everything is sent again, the controller may have restarted.
+			// The tail isn't reset, lines read before are kept in the log
+			// store and must not be added twice
+			lastStats = nil
+			err = gui.updateStats(&lastStats)
+			if err == nil {
+				err = gui.updateLogs(tail, true)
 			}
+			continue
 		}
 
-		// Get the miner's state
-		stateResponse, err := gui.managerClient.GetState(context.Background(), &rpcproto.StateRequest{})
-		if err != nil {
-			gui.logger.WithField(
-				"op", "GetState",
-			).Errorf("Unable to get state from controller: %s", err)
-		} else if stateResponse != nil {
-			managerUpdate.State = stateResponse.State
+		select {
+		case <-statsTicker.C:
+			err = gui.updateStats(&lastStats)
+		case <-logsTicker.C:
+			err = gui.updateLogs(tail, false)
+		case <-gui.refresh:
+			// Everything is sent again
+			lastStats = nil
+			err = gui.setup()
+			if err == nil {
+				err = gui.updateStats(&lastStats)
+			}
+			if err == nil {
+				err = gui.updateLogs(tail, true)
+			}
 		}
+	}
+}
+
+// updateStats sends the combined stats and the state to Electron if they
+// differ from lastStats. An error is returned if the controller couldn't
+// be reached
+func (gui *Manager) updateStats(lastStats **statsUpdate) error {
+	gui.logger.Debug("Fetching stats")
 
-		// Get the miner's logs
-		logsResponse, err := gui.managerClient.GetLogs(context.Background(), &rpcproto.LogsRequest{
-			MaxLines: 500,
+	update := statsUpdate{
+		Miners: []minerStats{},
+	}
+	// Get the miner's stats
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	statsResponse, err := gui.client().GetStats(ctx, &rpcproto.StatsRequest{})
+	if err != nil {
+		gui.logger.WithField(
+			"op", "GetStats",
+		).Errorf("Unable to get stats from controller: %s", err)
+		return err
+	}
+	if statsResponse != nil {
+		// Keep the stats of every miner and combine them into one
+		for _, stats := range statsResponse.Stats {
+			update.Miners = append(update.Miners, minerStats{
+				Key:            stats.Key,
+				Hashrate:       stats.Hashrate,
+				TotalShares:    stats.TotalShares,
+				AcceptedShares: stats.AcceptedShares,
+				RejectedShares: stats.RejectedShares,
+				RejectionRate:  helper.RejectionRate(stats.AcceptedShares, stats.RejectedShares),
+			})
+			update.Hashrate += stats.Hashrate
+			update.TotalShares += stats.TotalShares
+			update.AcceptedShares += stats.AcceptedShares
+			update.RejectedShares += stats.RejectedShares
+		}
+		update.RejectionRate = helper.RejectionRate(update.AcceptedShares, update.RejectedShares)
+		sort.Slice(update.Miners, func(i, j int) bool {
+			return update.Miners[i].Key < update.Miners[j].Key
 		})
+	}
+
+	// Get the miner's state
+	stateResponse, err := gui.client().GetState(ctx, &rpcproto.StateRequest{})
+	if err != nil {
+		gui.logger.WithField(
+			"op", "GetState",
+		).Errorf("Unable to get state from controller: %s", err)
+		return err
+	}
+	if stateResponse != nil {
+		update.State = stateResponse.State
+	}
+	gui.updateTrayStats(update.Hashrate, update.State)
+
+	if *lastStats != nil && reflect.DeepEqual(**lastStats, update) {
+		return nil
+	}
+	err = gui.sendElectronCommand("stats", update)
+	if err != nil {
+		gui.logger.WithField(
+			"method", "stats",
+		).Errorf("Unable to send stats to Electron: %s", err)
+		return nil
+	}
+	*lastStats = &update
+	return nil
+}
+
+// updateLogs adds the new log lines to the log store and sends those that
+// match the log query to Electron. With reset, the latest maxLogLines lines
+// that match replace the logs shown. An error is returned if the controller
+// couldn't be reached.
+//
+// The controller's GetLogs has no cursor, every poll fetches the latest
+// tailLogLines lines of every miner and LogTail drops those already read.
+// Only sending the new lines to Electron is incremental
+func (gui *Manager) updateLogs(tail *helper.LogTail, reset bool) error {
+	gui.logger.Debug("Fetching logs")
+
+	maxLines := tailLogLines
+	if reset {
+		maxLines = maxLogLines
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	logsResponse, err := gui.client().GetLogs(ctx, &rpcproto.LogsRequest{
+		MaxLines: int32(maxLines),
+	})
+	if err != nil {
+		gui.logger.WithField(
+			"op", "GetLogs",
+		).Errorf("Unable to get logs from controller: %s", err)
+		return err
+	}
+	if logsResponse == nil {
+		return nil
+	}
+
+	var added []logstore.Entry
+	read := time.Now()
+	for _, log := range logsResponse.MinerLogs {
+		added = append(added, gui.logs.Add(log.Key, tail.Next(log.Key, log.Logs), read)...)
+	}
+
+	if reset {
+		update, err := gui.searchLogs(gui.currentLogQuery())
 		if err != nil {
 			gui.logger.WithField(
-				"op", "GetLogs",
-			).Errorf("Unable to get logs from controller: %s", err)
-		} else if logsResponse != nil {
-			var logs []string
-			// We need to format the logs to HTML for display
-			for _, log := range logsResponse.MinerLogs {
-				for _, line := range log.Logs {
-					htmlLine := terminal.Render([]byte(line))
-					logs = append(logs, string(htmlLine))
-				}
-			}
-			managerUpdate.HTMLLogs = strings.Join(logs, "<br/>")
+				"method", "logs",
+			).Errorf("Unable to search logs: %s", err)
+			return nil
 		}
+		gui.sendLogs(update)
+		return nil
+	}
 
-		err = gui.sendElectronCommand("update", managerUpdate)
-		if err != nil {
-			gui.logger.WithField(
-				"method", "update",
-			).Errorf("Unable to send update to Electron: %s", err)
+	// Only the new lines that match are formatted to HTML for display
+	query := gui.currentLogQuery()
+	update := logsUpdate{
+		Lines: []logLine{},
+	}
+	for _, entry := range added {
+		if query.Matches(entry) {
+			update.Lines = append(update.Lines, renderLogLine(entry))
 		}
+	}
+	if len(update.Lines) == 0 {
+		return nil
+	}
+	gui.sendLogs(update)
+	return nil
+}
 
-		time.Sleep(time.Second * 5)
+// searchLogs returns the latest maxLogLines lines that match the query,
+// to replace the logs shown
+func (gui *Manager) searchLogs(query logstore.Query) (logsUpdate, error) {
+	entries, err := gui.logs.Search(query)
+	if err != nil {
+		return logsUpdate{}, err
+	}
+	update := logsUpdate{
+		Lines:   []logLine{},
+		Reset:   true,
+		Matches: len(entries),
+		Miners:  gui.logs.Miners(),
+	}
+	if len(entries) > maxLogLines {
+		entries = entries[len(entries)-maxLogLines:]
+	}
+	for _, entry := range entries {
+		update.Lines = append(update.Lines, renderLogLine(entry))
+	}
+	return update, nil
+}
+
+// currentLogQuery returns the query selecting the logs shown
+func (gui *Manager) currentLogQuery() logstore.Query {
+	gui.logQueryMutex.Lock()
+	defer gui.logQueryMutex.Unlock()
+	return gui.logQuery
+}
+
+// renderLogLine formats the log entry as HTML for display
+func renderLogLine(entry logstore.Entry) logLine {
+	return logLine{
+		ID:    entry.ID,
+		Miner: entry.Miner,
+		Time:  entry.Time,
+		Level: entry.Level,
+		HTML:  string(terminal.Render([]byte(entry.Raw))),
+	}
+}
+
+// sendLogs sends the log lines to Electron
+func (gui *Manager) sendLogs(update logsUpdate) {
+	err := gui.sendElectronCommand("logs", update)
+	if err != nil {
+		gui.logger.WithField(
+			"method", "logs",
+		).Errorf("Unable to send logs to Electron: %s", err)
 	}
 }
 
@@ -279,49 +626,23 @@ func (gui *Manager) handleElectronCommands(
 	switch command.Name {
 
 	case "ready":
-		// Check if the miner controller is available by fetching the
-		// base information
-
-		response, err := gui.managerClient.GetInfo(
-			context.Background(),
-			&rpcproto.RigInfoRequest{})
-		if err != nil {
-			gui.logger.WithField(
-				"method", "setup",
-			).Errorf("Unable to query miner controller: %s", err)
-
-			return map[string]string{
-				"status": "error",
-				"message": fmt.Sprintf(`
-<p>
-Unable to query miner controller, please ensure the MiningHQ Miner service is running.
-</p>
-<p>
-%s
-</p>`, err),
-			}, nil
-		}
-
-		// Send the initial setup packet
-		// This includes a link to the rig on MiningHQ as well as the
-		// rig name. This is injected into the frontend for display purposes
-		err = gui.sendElectronCommand("setup", map[string]string{
-			"name": response.Name,
-			"link": response.Link,
+		// The update loop sets up the page once the miner controller is
+		// available. When the page is reloaded, the running update loop
+		// only needs to send everything again
+		started := false
+		gui.updateOnce.Do(func() {
+			started = true
+			go gui.updateLoop()
 		})
-		if err != nil {
-			gui.logger.WithField(
-				"method", "setup",
-			).Errorf("Unable to send setup to Electron: %s", err)
+		if started == false {
+			gui.requestRefresh()
 		}
-
-		// TODO: Do this loop better
-		go gui.updateLoop()
+		return map[string]string{
+			"status": "success",
+		}, nil
 
 	case "pause":
-		_, err := gui.managerClient.SetState(context.Background(), &rpcproto.StateRequest{
-			State: rpcproto.MinerState_PauseMining,
-		})
+		err := gui.setMiningState(rpcproto.MinerState_PauseMining)
 		if err != nil {
 			return map[string]string{
 				"status": "error",
@@ -345,9 +666,7 @@ Mining has been paused
 		}, nil
 
 	case "resume":
-		_, err := gui.managerClient.SetState(context.Background(), &rpcproto.StateRequest{
-			State: rpcproto.MinerState_ResumeMining,
-		})
+		err := gui.setMiningState(rpcproto.MinerState_ResumeMining)
 		if err != nil {
 			return map[string]string{
 				"status": "error",
@@ -370,12 +689,211 @@ Mining has been resumed
 `),
 		}, nil
 
+	case "history":
+		// The miner service records its events in history files in the
+		// installation directory, they are shown newest first
+		var events []helper.Event
+		for _, filename := range helper.HistoryFilenames() {
+			fileEvents, err := helper.ReadEvents(filepath.Join(gui.installPath, filename))
+			if err != nil {
+				gui.logger.WithField(
+					"method", "history",
+				).Errorf("Unable to read history '%s': %s", filename, err)
+				continue
+			}
+			events = append(events, fileEvents...)
+		}
+		// Newest events first
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].Time.After(events[j].Time)
+		})
+
+		return map[string]interface{}{
+			"status": "success",
+			"events": events,
+		}, nil
+
+	case "search-logs":
+		// The payload is the query selecting the logs to show, it also
+		// selects the new lines shown from now on
+		var query logstore.Query
+		err := json.Unmarshal(command.Payload, &query)
+		if err != nil {
+			return nil, err
+		}
+		update, err := gui.searchLogs(query)
+		if err != nil {
+			return map[string]string{
+				"status":  "error",
+				"message": err.Error(),
+			}, nil
+		}
+		gui.logQueryMutex.Lock()
+		gui.logQuery = query
+		gui.logQueryMutex.Unlock()
+
+		return map[string]interface{}{
+			"status": "success",
+			"logs":   update,
+		}, nil
+
+	case "export-logs":
+		var request exportRequest
+		err := json.Unmarshal(command.Payload, &request)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := gui.logs.Search(request.Query)
+		if err == nil {
+			err = exportLogs(request.Path, entries, request.Format)
+		}
+		if err != nil {
+			return map[string]string{
+				"status":  "error",
+				"message": fmt.Sprintf("Unable to export the logs: %s", err),
+			}, nil
+		}
+
+		return map[string]string{
+			"status":  "success",
+			"message": fmt.Sprintf("Exported %d log lines to %s", len(entries), request.Path),
+		}, nil
+
+	case "save-diagnostics":
+		// The payload is the path to save the bundle to
+		var path string
+		err := json.Unmarshal(command.Payload, &path)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := gui.logs.Search(logstore.Query{})
+		if err != nil {
+			return nil, err
+		}
+		bundle, err := saveDiagnostics(path, entries)
+		if err != nil {
+			return map[string]string{
+				"status":  "error",
+				"message": fmt.Sprintf("Unable to save the diagnostics: %s", err),
+			}, nil
+		}
+		for _, problem := range bundle.Problems() {
+			gui.logger.WithField("method", "save-diagnostics").Warning(problem)
+		}
+
+		return map[string]string{
+			"status":  "success",
+			"message": fmt.Sprintf("Saved the diagnostics to %s, attach the file to your report", path),
+		}, nil
+
+	case "stats-history":
+		// The payload is the period to chart, such as '1h' or '30d'
+		var periodValue string
+		err := json.Unmarshal(command.Payload, &periodValue)
+		if err != nil {
+			return nil, err
+		}
+		period, err := timeseries.ParsePeriod(periodValue)
+		if err != nil {
+			return map[string]string{
+				"status":  "error",
+				"message": err.Error(),
+			}, nil
+		}
+
+		// The miner service records the stats history in the installation
+		// directory
+		historyPath := filepath.Join(gui.installPath, timeseries.Filename)
+		points, resolution, err := timeseries.Query(historyPath, period)
+		if err != nil {
+			gui.logger.WithField(
+				"method", "stats-history",
+			).Errorf("Unable to read the stats history: %s", err)
+			return map[string]string{
+				"status":  "error",
+				"message": fmt.Sprintf("Unable to read the stats history: %s", err),
+			}, nil
+		}
+
+		return map[string]interface{}{
+			"status": "success",
+			"step":   resolution.Step.Seconds(),
+			"points": points,
+		}, nil
+
+	case "schedule":
+		// The miner service applies the schedule, the manager only edits it
+		schedulePath := filepath.Join(gui.installPath, schedule.Filename)
+		miningSchedule, err := schedule.Load(schedulePath)
+		if err != nil {
+			return map[string]string{
+				"status":  "error",
+				"message": err.Error(),
+			}, nil
+		}
+		return map[string]interface{}{
+			"status":   "success",
+			"schedule": miningSchedule,
+			"next":     nextScheduleChange(miningSchedule),
+		}, nil
+
+	case "save-schedule":
+		var miningSchedule schedule.Schedule
+		err := json.Unmarshal(command.Payload, &miningSchedule)
+		if err != nil {
+			return nil, err
+		}
+		err = miningSchedule.Save(filepath.Join(gui.installPath, schedule.Filename))
+		if err != nil {
+			return map[string]string{
+				"status":  "error",
+				"message": err.Error(),
+			}, nil
+		}
+		return map[string]interface{}{
+			"status":   "success",
+			"schedule": miningSchedule,
+			"next":     nextScheduleChange(miningSchedule),
+		}, nil
+
+	case "refresh":
+		gui.requestRefresh()
+		return map[string]string{
+			"status": "success",
+		}, nil
+
 	case "Cancel":
 
 	}
 	return nil, fmt.Errorf("'%s' is an unknown command", command.Name)
 }
 
+// nextScheduleChange describes when the schedule next pauses or resumes
+// mining, it is empty if the schedule doesn't change the mining state
+func nextScheduleChange(miningSchedule schedule.Schedule) string {
+	if miningSchedule.Enabled == false {
+		return ""
+	}
+	next, action := miningSchedule.NextChange(time.Now())
+	if next.IsZero() {
+		return ""
+	}
+	verb := "resumes"
+	if action == schedule.ActionPause {
+		verb = "pauses"
+	}
+	return fmt.Sprintf("The schedule next %s mining on %s", verb, next.Format("Monday at 15:04"))
+}
+
+// requestRefresh makes the update loop send the stats and logs again
+func (gui *Manager) requestRefresh() {
+	select {
+	case gui.refresh <- struct{}{}:
+	default:
+		// A refresh is pending already
+	}
+}
+
 // sendElectronCommand sends the given data to Electron under the command name
 func (gui *Manager) sendElectronCommand(
 	name string,
@@ -386,3 +904,19 @@ func (gui *Manager) sendElectronCommand(
 	}
 	return bootstrap.SendMessage(gui.window, name, string(dataBytes))
 }
+
+// exportLogs writes the log entries to the file at path in the format
+func exportLogs(path string, entries []logstore.Entry, format string) error {
+	if path == "" {
+		return fmt.Errorf("No file was chosen")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	err = logstore.Export(file, entries, format)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+)
+
+// alertsInterval is how often the alert history is checked for new alerts
+const alertsInterval = time.Second * 5
+
+// watchAlerts shows the alerts the service records in the alert history as
+// desktop notifications until done is closed. The service can't show them
+// itself, it runs outside the user's desktop session. Alerts recorded
+// before the manager started are not shown
+func (gui *Manager) watchAlerts(done <-chan struct{}) {
+	ticker := time.NewTicker(alertsInterval)
+	defer ticker.Stop()
+
+	follower := helper.NewEventFollower(filepath.Join(gui.installPath, helper.AlertHistoryFilename))
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		events, err := follower.Next()
+		if err != nil {
+			gui.logger.Debugf("Unable to read the alert history: %s", err)
+			continue
+		}
+		if len(events) == 0 || gui.desktopAlerts() == false {
+			continue
+		}
+		for _, event := range events {
+			title := "MiningHQ rig alert"
+			if event.Type == "resolved" {
+				title = "MiningHQ rig alert resolved"
+			}
+			err = notifyDesktop(title, event.Message, event.Type != "resolved")
+			if err != nil {
+				gui.logger.Errorf("Unable to show the alert as a desktop notification: %s", err)
+			}
+		}
+	}
+}
+
+// desktopAlerts returns true unless desktop notifications are disabled in
+// the service config
+func (gui *Manager) desktopAlerts() bool {
+	configBytes, err := ioutil.ReadFile(filepath.Join(gui.installPath, helper.ServiceConfigFilename))
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil {
+		gui.logger.Debugf("Unable to read the service config: %s", err)
+		return true
+	}
+	var config struct {
+		Alerts struct {
+			Desktop *bool `json:"desktop"`
+		} `json:"alerts"`
+	}
+	if json.Unmarshal(configBytes, &config) != nil || config.Alerts.Desktop == nil {
+		return true
+	}
+	return *config.Alerts.Desktop
+}
@@ -0,0 +1,48 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/mininghq/miner/helper"
+)
+
+// notifyDesktop shows a desktop notification using notify-send, which
+// talks to the notification daemon of the user's desktop
+func notifyDesktop(title string, message string, urgent bool) error {
+	urgency := "normal"
+	if urgent {
+		urgency = "critical"
+	}
+	output, err := exec.Command(
+		"notify-send",
+		"--app-name", helper.ServiceDisplayName,
+		"--urgency", urgency,
+		title,
+		message).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Unable to run notify-send, install libnotify: %s %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// balloonScript shows a notification balloon from the notification area.
+// The title and message are passed in the environment to avoid quoting
+// them in the script
+const balloonScript = `
+Add-Type -AssemblyName System.Windows.Forms
+Add-Type -AssemblyName System.Drawing
+$notify = New-Object System.Windows.Forms.NotifyIcon
+$notify.Icon = [System.Drawing.SystemIcons]::Application
+$notify.Visible = $true
+$notify.ShowBalloonTip(10000, $env:MHQ_ALERT_TITLE, $env:MHQ_ALERT_MESSAGE, $env:MHQ_ALERT_ICON)
+Start-Sleep -Seconds 10
+$notify.Dispose()
+`
+
+// notifyDesktop shows a desktop notification using PowerShell without a
+// console window. The balloon stays up for a while, the command is not
+// waited for
+func notifyDesktop(title string, message string, urgent bool) error {
+	icon := "Info"
+	if urgent {
+		icon = "Warning"
+	}
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", balloonScript)
+	cmd.Env = append(
+		os.Environ(),
+		"MHQ_ALERT_TITLE="+title,
+		"MHQ_ALERT_MESSAGE="+message,
+		"MHQ_ALERT_ICON="+icon)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	err := cmd.Start()
+	if err != nil {
+		return fmt.Errorf("Unable to run PowerShell: %s", err)
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -114,6 +114,7 @@ let installer = {
       if (data.status == 'error')
       {
         alert('Unable to install: ' + data.message);
+        $('.save-diagnostics').removeClass('hide');
       }
       else if (data.status == 'ok')
       {
@@ -228,6 +229,20 @@ let installer = {
        remote.getCurrentWindow().close();
     });
 
+    // Save the details support needs when the installation failed
+    $('.save-diagnostics').bind('click', function(){
+      var options = {
+        defaultPath: 'mininghq-diagnostics.zip',
+        filters: [{name: 'Zip', extensions: ['zip']}],
+      };
+      remote.dialog.showSaveDialog(remote.getCurrentWindow(), options, function(path) {
+        if (!path) return;
+        astilectron.sendMessage({name: "save-diagnostics", payload: path}, function(message) {
+          alert(message.payload.message);
+        });
+      });
+    });
+
     $('#install_path_selector').bind('click', function(){
       astilectron.showOpenDialog({properties: ['openDirectory',], title: "Select your installation directory"}, function(path) {
           $('#install_path').val(path);
@@ -249,6 +264,7 @@ let installer = {
         {
           $('.wizard-continue').addClass('hide');
           $('.exit').removeClass('hide');
+          $('.save-diagnostics').removeClass('hide');
 
           $('#install_error').html(data.message);
           $('#install_error').removeClass('hide');
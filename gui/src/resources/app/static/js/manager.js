@@ -23,8 +23,11 @@ let manager = {
           payload: ""
         }, function(message) {
           // Show modal with error
-          $('#error_list').html(message.payload.message);
-          $('#error_modal').modal();
+          if (message.payload.status == 'error')
+          {
+            $('#error_list').html(message.payload.message);
+            $('#error_modal').modal();
+          }
         });
 
         manager.bindEvents();
@@ -41,15 +44,34 @@ let manager = {
           $('#rig_link').attr('href', parsed.link);
           break;
 
-        case "update":
-          if (parsed.Stats.Hashrate != undefined)
+        case "logs":
+          manager.showLogs(parsed);
+          break;
+
+        case "connection":
+          manager.showConnection(parsed);
+          break;
+
+        // Sent by the tray menu
+        case "open-external":
+          require('electron').shell.openExternal(parsed.url);
+          break;
+
+        case "error":
+          $('#error_list').html(parsed.message);
+          $('#error_modal').modal();
+          break;
+
+        // Stats are only sent when they changed
+        case "stats":
+          if (parsed.Hashrate != undefined)
           {
-            $('#current_hashrate').html(parsed.Stats.Hashrate + " H/s");
+            $('#current_hashrate').html(parsed.Hashrate + " H/s");
           } else $('#current_hashrate').html("0 H/s");
-          $('#shares_total').html(parsed.Stats.TotalShares);
-          $('#shares_accepted').html(parsed.Stats.AcceptedShares);
-          $('#shares_rejected').html(parsed.Stats.RejectedShares);
-          $('#rig_logs').html(parsed.HTMLLogs);
+          $('#shares_total').html(parsed.TotalShares);
+          $('#shares_accepted').html(parsed.AcceptedShares);
+          $('#shares_rejected').html(parsed.RejectedShares);
+          manager.showMiners(parsed.Miners, parsed.State);
 
           if (parsed.State == 2) // Mining = 2;
           {
@@ -89,6 +111,329 @@ let manager = {
         }
       });
   },
+  // Show the banner while the miner controller is unavailable, the shown
+  // stats are out of date until it is back
+  showConnection: function(connection) {
+    if (connection.state == 'connected')
+    {
+      $('#connection_banner').addClass('d-none');
+      return;
+    }
+    var message = 'The miner controller at ' + connection.address + ' is unavailable, reconnecting';
+    if (connection.retry_in > 0)
+    {
+      message += ' in ' + connection.retry_in + (connection.retry_in == 1 ? ' second' : ' seconds');
+    }
+    $('#connection_message').text(message);
+    $('#connection_banner').attr('title', connection.error);
+    $('#connection_banner').removeClass('d-none');
+
+    $('#state_info').removeClass('text-success');
+    $('#state_info').removeClass('text-warning');
+    $('#state_info').addClass('text-danger');
+    $('#state_info').html('Unavailable');
+    $('#state_info').show();
+  },
+  // Miners rejecting more than this percentage of their shares are
+  // highlighted
+  maxRejectionRate: 5,
+  // Show the stats of every miner, miners that aren't hashing while mining
+  // or reject too many shares are highlighted
+  showMiners: function(miners, state) {
+    miners = miners || [];
+    var failing = false;
+    $('#miners_list').empty();
+    if (miners.length == 0)
+    {
+      $('#miners_list').append($('<tr>').append($('<td colspan="5">').text('No miners are running')));
+    }
+    $.each(miners, function(index, miner) {
+      var row = $('<tr>');
+      // Mining = 2
+      if ((state == 2 && miner.Hashrate == 0) || miner.RejectionRate > manager.maxRejectionRate)
+      {
+        row.addClass('text-danger');
+        failing = true;
+      }
+      row.append($('<td>').text(miner.Key));
+      row.append($('<td class="text-right">').text(miner.Hashrate + ' H/s'));
+      row.append($('<td class="text-right">').text(miner.AcceptedShares));
+      row.append($('<td class="text-right">').text(miner.RejectedShares));
+      row.append($('<td class="text-right">').text(miner.RejectionRate.toFixed(1) + '%'));
+      $('#miners_list').append(row);
+    });
+    if (failing)
+    {
+      $('#miners_warning').removeClass('d-none');
+    } else $('#miners_warning').addClass('d-none');
+  },
+  // The number of log lines kept, older lines are removed
+  maxLogLines: 500,
+  // Show the log lines sent by the manager. A reset replaces the lines
+  // shown with those matching the log filters
+  showLogs: function(update) {
+    var filtered = $('#log_miner').val() || $('#log_level').val() || $('#log_search').val();
+    if (update.reset)
+    {
+      if (update.miners) manager.showLogMiners(update.miners);
+      if (filtered && update.matches > update.lines.length)
+      {
+        $('#log_matches').text('Latest ' + update.lines.length + ' of ' + update.matches + ' matching lines');
+      }
+      else if (filtered)
+      {
+        $('#log_matches').text(update.matches + ' matching lines');
+      } else $('#log_matches').text('');
+    }
+    manager.appendLogs(update.lines, update.reset);
+    if (update.reset && update.lines.length == 0)
+    {
+      $('#rig_logs').text(filtered ? 'No log lines match the filters' : 'Logs not available yet or rig is not mining');
+    }
+  },
+  // List the miners that logged lines in the miner filter, keeping the
+  // miner selected
+  showLogMiners: function(miners) {
+    var select = $('#log_miner');
+    var selected = select.val();
+    select.find('option:not(:first)').remove();
+    $.each(miners, function(index, miner) {
+      select.append($('<option>').val(miner).text(miner));
+    });
+    select.val(selected);
+  },
+  // The log filters, the manager sends only the lines that match them
+  logQuery: function() {
+    return {
+      miner: $('#log_miner').val(),
+      level: $('#log_level').val(),
+      text: $('#log_search').val(),
+    };
+  },
+  // Ask the manager for the lines that match the log filters
+  searchLogs: function() {
+    astilectron.sendMessage({name: "search-logs", payload: manager.logQuery()}, function(message){
+      if (message.payload.status == 'error')
+      {
+        $('#log_matches').text(message.payload.message);
+        return;
+      }
+      manager.showLogs(message.payload.logs);
+    });
+  },
+  // Export the lines that match the log filters and the range in the
+  // export dialog to a file the user chooses
+  exportLogs: function() {
+    var query = manager.logQuery();
+    if ($('#export_since').val()) query.since = new Date($('#export_since').val()).toISOString();
+    if ($('#export_until').val()) query.until = new Date($('#export_until').val()).toISOString();
+    var format = $('#export_format').val();
+    var options = {
+      defaultPath: 'mininghq-logs.' + (format == 'json' ? 'json' : 'txt'),
+      filters: [format == 'json' ? {name: 'JSON', extensions: ['json']} : {name: 'Text', extensions: ['txt', 'log']}],
+    };
+    remote.dialog.showSaveDialog(remote.getCurrentWindow(), options, function(path) {
+      if (!path) return;
+      astilectron.sendMessage({name: "export-logs", payload: {query: query, format: format, path: path}}, function(message){
+        if (message.payload.status == 'error')
+        {
+          $('#error_list').text(message.payload.message);
+          $('#error_modal').modal();
+          return;
+        }
+        $('#export_logs_modal').modal('hide');
+        $('#log_matches').text(message.payload.message);
+      });
+    });
+  },
+  // Save a diagnostics bundle for support to a zip file the user chooses
+  saveDiagnostics: function() {
+    var options = {
+      defaultPath: 'mininghq-diagnostics.zip',
+      filters: [{name: 'Zip', extensions: ['zip']}],
+    };
+    remote.dialog.showSaveDialog(remote.getCurrentWindow(), options, function(path) {
+      if (!path) return;
+      astilectron.sendMessage({name: "save-diagnostics", payload: path}, function(message){
+        if (message.payload.status == 'error')
+        {
+          $('#error_list').text(message.payload.message);
+          $('#error_modal').modal();
+          return;
+        }
+        remote.dialog.showMessageBox(remote.getCurrentWindow(), {
+          type: 'info',
+          title: 'Diagnostics',
+          message: message.payload.message,
+          buttons: ['Ok'],
+        });
+      });
+    });
+  },
+  // Append the new log lines, already rendered as HTML. With reset the
+  // shown lines are replaced
+  appendLogs: function(lines, reset) {
+    var logs = $('#rig_logs');
+    // Keep following the logs if scrolled to the bottom
+    var atBottom = logs.scrollTop() + logs.innerHeight() >= logs[0].scrollHeight - 10;
+    if (reset)
+    {
+      logs.empty();
+    }
+    $.each(lines || [], function(index, line) {
+      logs.append($('<div>')
+        .addClass('log-' + line.level)
+        .attr('title', new Date(line.time).toLocaleString() + ' - ' + line.miner)
+        .html(line.html));
+    });
+    var shown = logs.children();
+    if (shown.length > manager.maxLogLines)
+    {
+      shown.slice(0, shown.length - manager.maxLogLines).remove();
+    }
+    if (atBottom || reset)
+    {
+      logs.scrollTop(logs[0].scrollHeight);
+    }
+  },
+  // The charts of the stats history, created when first shown
+  hashrateChart: null,
+  sharesChart: null,
+  // Load the stats history of the period, such as '1h' or '30d', and
+  // chart it
+  showStatsHistory: function(period) {
+    astilectron.sendMessage({name: "stats-history", payload: period}, function(message){
+      if (message.payload.status == 'error')
+      {
+        $('#error_list').html(message.payload.message);
+        $('#error_modal').modal();
+        return;
+      }
+
+      var points = message.payload.points || [];
+      var labels = [];
+      var hashrates = [];
+      var accepted = [];
+      var rejected = [];
+      $.each(points, function(index, point) {
+        var time = new Date(point.time);
+        labels.push(period == '1h' ? time.toLocaleTimeString() : time.toLocaleString());
+        hashrates.push(point.hashrate.toFixed(2));
+        // Share counters are totals, chart the shares found per step
+        var previous = index > 0 ? points[index - 1] : point;
+        accepted.push(Math.max(point.accepted_shares - previous.accepted_shares, 0));
+        rejected.push(Math.max(point.rejected_shares - previous.rejected_shares, 0));
+      });
+
+      if (points.length == 0)
+      {
+        $('#stats_history_empty').removeClass('d-none');
+      } else $('#stats_history_empty').addClass('d-none');
+
+      if (manager.hashrateChart != null)
+      {
+        manager.hashrateChart.destroy();
+        manager.sharesChart.destroy();
+      }
+      manager.hashrateChart = new Chart($('#hashrate_chart'), {
+        type: 'line',
+        data: {
+          labels: labels,
+          datasets: [{
+            label: 'Hashrate (H/s)',
+            data: hashrates,
+            borderColor: '#22b66e',
+            backgroundColor: 'rgba(34, 182, 110, 0.1)',
+            pointRadius: 0,
+          }]
+        },
+        options: {
+          animation: false,
+          scales: {yAxes: [{ticks: {beginAtZero: true}}]},
+        }
+      });
+      manager.sharesChart = new Chart($('#shares_chart'), {
+        type: 'bar',
+        data: {
+          labels: labels,
+          datasets: [{
+            label: 'Accepted shares',
+            data: accepted,
+            backgroundColor: '#22b66e',
+          }, {
+            label: 'Rejected shares',
+            data: rejected,
+            backgroundColor: '#f44455',
+          }]
+        },
+        options: {
+          animation: false,
+          scales: {
+            xAxes: [{stacked: true}],
+            yAxes: [{stacked: true, ticks: {beginAtZero: true}}],
+          },
+        }
+      });
+    });
+  },
+  // The days of a schedule rule, in the order they are shown
+  scheduleDays: ['mon', 'tue', 'wed', 'thu', 'fri', 'sat', 'sun'],
+  // Show the mining schedule for editing
+  showSchedule: function(schedule, next) {
+    $('#schedule_enabled').prop('checked', schedule.enabled);
+    $('#schedule_default').val(schedule.default);
+    $('#schedule_rules').empty();
+    $.each(schedule.rules || [], function(index, rule) {
+      manager.addScheduleRule(rule);
+    });
+    $('#schedule_next').text(next);
+  },
+  // Add a row to edit a schedule rule
+  addScheduleRule: function(rule) {
+    var row = $('<tr class="schedule-rule">');
+    var days = $('<td>');
+    $.each(manager.scheduleDays, function(index, day) {
+      var checkbox = $('<input type="checkbox" class="mr-1">').val(day);
+      checkbox.prop('checked', (rule.days || []).indexOf(day) >= 0);
+      days.append($('<label class="mr-2 mb-0">').append(checkbox).append(day));
+    });
+    row.append(days);
+    row.append($('<td>').append($('<input type="time" class="form-control form-control-sm schedule-start">').val(rule.start)));
+    row.append($('<td>').append($('<input type="time" class="form-control form-control-sm schedule-end">').val(rule.end)));
+    var action = $('<select class="form-control form-control-sm schedule-action">');
+    action.append($('<option value="pause">').text('pause'));
+    action.append($('<option value="mine">').text('mine'));
+    action.val(rule.action);
+    row.append($('<td>').append(action));
+    var remove = $('<a href="#" class="text-muted"><i class="fa fa-fw fa-trash"></i></a>');
+    remove.bind('click', function(){
+      row.remove();
+    });
+    row.append($('<td>').append(remove));
+    $('#schedule_rules').append(row);
+  },
+  // Read the edited schedule, rules without days apply every day
+  readSchedule: function() {
+    var schedule = {
+      enabled: $('#schedule_enabled').prop('checked'),
+      default: $('#schedule_default').val(),
+      rules: [],
+    };
+    $('#schedule_rules .schedule-rule').each(function() {
+      var row = $(this);
+      var days = [];
+      row.find('input[type=checkbox]:checked').each(function() {
+        days.push($(this).val());
+      });
+      schedule.rules.push({
+        days: days,
+        start: row.find('.schedule-start').val(),
+        end: row.find('.schedule-end').val(),
+        action: row.find('.schedule-action').val(),
+      });
+    });
+    return schedule;
+  },
   // Bind to UI events using jQuery
   bindEvents: function() {
 
@@ -152,6 +497,105 @@ let manager = {
       });
     });
 
+    $('#miners').bind('click', function(){
+      $('#miners_modal').modal();
+    });
+
+    $('#stats_history').bind('click', function(){
+      $('#stats_history_modal').modal();
+      manager.showStatsHistory($('.stats-period.active').data('period'));
+    });
+
+    $('.stats-period').bind('click', function(){
+      $('.stats-period').removeClass('active');
+      $(this).addClass('active');
+      manager.showStatsHistory($(this).data('period'));
+    });
+
+    $('#schedule').bind('click', function(){
+      astilectron.sendMessage({name: "schedule", payload: ""}, function(message){
+        if (message.payload.status == 'error')
+        {
+          $('#error_list').html(message.payload.message);
+          $('#error_modal').modal();
+          return;
+        }
+        manager.showSchedule(message.payload.schedule, message.payload.next);
+        $('#schedule_modal').modal();
+      });
+    });
+
+    $('#schedule_add').bind('click', function(){
+      manager.addScheduleRule({days: ['mon', 'tue', 'wed', 'thu', 'fri'], start: '08:00', end: '18:00', action: 'pause'});
+    });
+
+    $('#schedule_save').bind('click', function(){
+      astilectron.sendMessage({name: "save-schedule", payload: manager.readSchedule()}, function(message){
+        if (message.payload.status == 'error')
+        {
+          $('#schedule_next').text(message.payload.message);
+          $('#schedule_next').addClass('text-danger');
+          return;
+        }
+        $('#schedule_next').removeClass('text-danger');
+        $('#schedule_modal').modal('hide');
+      });
+    });
+
+    $('#log_miner, #log_level').bind('change', function(){
+      manager.searchLogs();
+    });
+
+    // Search once typing stops
+    var searchTimer = null;
+    $('#log_search').bind('input', function(){
+      clearTimeout(searchTimer);
+      searchTimer = setTimeout(manager.searchLogs, 300);
+    });
+
+    $('#export_logs').bind('click', function(){
+      $('#export_logs_modal').modal();
+    });
+
+    $('#export_logs_save').bind('click', function(){
+      manager.exportLogs();
+    });
+
+    $('#diagnostics').bind('click', function(){
+      manager.saveDiagnostics();
+    });
+
+    $('#history').bind('click', function(){
+      astilectron.sendMessage({name: "history", payload: ""}, function(message){
+        if (message.payload.status == 'error')
+        {
+          $('#error_list').html(message.payload.message);
+          $('#error_modal').modal();
+          return;
+        }
+
+        var events = message.payload.events || [];
+        $('#history_list').empty();
+        if (events.length == 0)
+        {
+          $('#history_list').append($('<li>').text('No rollbacks, quarantined files, pauses, throttling or alerts'));
+        }
+        $.each(events, function(index, event) {
+          var item = $('<li class="mb-2">');
+          item.append($('<small class="text-muted">').text(new Date(event.time).toLocaleString() + ' - ' + event.type));
+          item.append($('<div>').text(event.message));
+          $('#history_list').append(item);
+        });
+        $('#history_modal').modal();
+      });
+    });
+
+    $('#reconnect').bind('click', function(){
+      $('#connection_message').text('Reconnecting to the miner controller');
+      astilectron.sendMessage({name: "refresh", payload: ""}, function(message){
+      });
+    });
+
     $('#refresh').bind('click', function(){
       astilectron.sendMessage({name: "refresh", payload: ""}, function(message){
       });
@@ -0,0 +1,294 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	astilectron "github.com/asticode/go-astilectron"
+	"github.com/mininghq/rpcproto/rpcproto"
+)
+
+// Positions of the items in the tray menu
+const (
+	// trayItemStatus shows the hashrate and mining state
+	trayItemStatus = 0
+	// trayItemPause pauses or resumes mining
+	trayItemPause = 2
+	// trayItemDashboard opens the rig on MiningHQ
+	trayItemDashboard = 3
+)
+
+// trayMenu is what the tray menu shows
+type trayMenu struct {
+	// status is the label of the status item
+	status string
+	// pauseLabel is the label of the pause item
+	pauseLabel string
+	// canPause enables the pause item
+	canPause bool
+	// link is the rig's dashboard link, the dashboard item is enabled once
+	// it is known
+	link string
+}
+
+// trayIconPath returns the path of the tray icon restored with the
+// resources next to the manager
+func (gui *Manager) trayIconPath() string {
+	icon := "icon.png"
+	if runtime.GOOS == "windows" {
+		icon = "icon.ico"
+	}
+	return filepath.Join(gui.installPath, "resources", icon)
+}
+
+// trayMenuOptions returns the items of the tray menu, in the order of the
+// trayItem positions
+func (gui *Manager) trayMenuOptions() []*astilectron.MenuItemOptions {
+	return []*astilectron.MenuItemOptions{
+		{
+			Label:   astilectron.PtrStr(gui.trayShown.status),
+			Enabled: astilectron.PtrBool(false),
+		},
+		{
+			Type: astilectron.MenuItemTypeSeparator,
+		},
+		{
+			Label:   astilectron.PtrStr(gui.trayShown.pauseLabel),
+			Enabled: astilectron.PtrBool(false),
+			OnClick: func(_ astilectron.Event) bool {
+				gui.togglePause()
+				return false
+			},
+		},
+		{
+			Label:   astilectron.PtrStr("Open dashboard"),
+			Enabled: astilectron.PtrBool(false),
+			OnClick: func(_ astilectron.Event) bool {
+				gui.openDashboard()
+				return false
+			},
+		},
+		{
+			Label: astilectron.PtrStr("Show Miner Manager"),
+			OnClick: func(_ astilectron.Event) bool {
+				gui.showWindow()
+				return false
+			},
+		},
+		{
+			Type: astilectron.MenuItemTypeSeparator,
+		},
+		{
+			Label: astilectron.PtrStr("Quit"),
+			OnClick: func(_ astilectron.Event) bool {
+				gui.logger.Info("Quitting from the tray")
+				gui.app.Stop()
+				return false
+			},
+		},
+	}
+}
+
+// updateTrayStats shows the hashrate and state in the tray menu
+func (gui *Manager) updateTrayStats(hashrate float64, state rpcproto.MinerState) {
+	gui.trayMutex.Lock()
+	defer gui.trayMutex.Unlock()
+	gui.miningState = state
+
+	menu := gui.trayShown
+	switch state {
+	case rpcproto.MinerState_Mining:
+		menu.status = fmt.Sprintf("Mining at %.2f H/s", hashrate)
+		menu.pauseLabel = "Pause mining"
+		menu.canPause = true
+	case rpcproto.MinerState_PauseMining:
+		menu.status = "Paused"
+		menu.pauseLabel = "Resume mining"
+		menu.canPause = true
+	default:
+		menu.status = "Not mining"
+		menu.pauseLabel = "Resume mining"
+		menu.canPause = false
+	}
+	gui.showTrayMenu(menu)
+}
+
+// updateTrayConnection shows that the controller is unavailable in the tray
+// menu, the stats update it again once the controller is back
+func (gui *Manager) updateTrayConnection(update connectionUpdate) {
+	if update.State != connectionReconnecting {
+		return
+	}
+	gui.trayMutex.Lock()
+	defer gui.trayMutex.Unlock()
+
+	menu := gui.trayShown
+	menu.status = "Reconnecting to the miner controller"
+	menu.canPause = false
+	gui.showTrayMenu(menu)
+}
+
+// updateTrayLink enables opening the rig's dashboard from the tray menu
+func (gui *Manager) updateTrayLink(link string) {
+	gui.trayMutex.Lock()
+	defer gui.trayMutex.Unlock()
+
+	menu := gui.trayShown
+	menu.link = link
+	gui.showTrayMenu(menu)
+}
+
+// showTrayMenu updates the items of the tray menu that changed, trayMutex
+// must be held
+func (gui *Manager) showTrayMenu(menu trayMenu) {
+	shown := gui.trayShown
+	gui.trayShown = menu
+	if gui.tray == nil {
+		// The tray isn't created yet, it is created with the menu as is
+		return
+	}
+
+	var err error
+	if menu.status != shown.status {
+		err = gui.setTrayItem(trayItemStatus, func(item *astilectron.MenuItem) error {
+			return item.SetLabel(menu.status)
+		})
+	}
+	if err == nil && menu.pauseLabel != shown.pauseLabel {
+		err = gui.setTrayItem(trayItemPause, func(item *astilectron.MenuItem) error {
+			return item.SetLabel(menu.pauseLabel)
+		})
+	}
+	if err == nil && menu.canPause != shown.canPause {
+		err = gui.setTrayItem(trayItemPause, func(item *astilectron.MenuItem) error {
+			return item.SetEnabled(menu.canPause)
+		})
+	}
+	if err == nil && (menu.link != "") != (shown.link != "") {
+		err = gui.setTrayItem(trayItemDashboard, func(item *astilectron.MenuItem) error {
+			return item.SetEnabled(menu.link != "")
+		})
+	}
+	if err != nil {
+		gui.logger.WithField(
+			"method", "tray",
+		).Errorf("Unable to update the tray menu: %s", err)
+	}
+}
+
+// setTrayItem applies the change to the tray menu item at position
+func (gui *Manager) setTrayItem(position int, change func(item *astilectron.MenuItem) error) error {
+	item, err := gui.tray.Item(position)
+	if err != nil {
+		return err
+	}
+	return change(item)
+}
+
+// togglePause pauses mining if the rig is mining, otherwise it resumes
+// mining
+func (gui *Manager) togglePause() {
+	gui.trayMutex.Lock()
+	state := rpcproto.MinerState_ResumeMining
+	if gui.miningState == rpcproto.MinerState_Mining {
+		state = rpcproto.MinerState_PauseMining
+	}
+	gui.trayMutex.Unlock()
+
+	err := gui.setMiningState(state)
+	if err != nil {
+		gui.logger.WithField(
+			"method", "tray",
+		).Errorf("Unable to change the mining state: %s", err)
+		// The error is shown in the window
+		gui.showWindow()
+		err = gui.sendElectronCommand("error", map[string]string{
+			"message": fmt.Sprintf(`
+<p>
+Unable to change the mining state, please ensure the MiningHQ Miner service is running.
+</p>
+<p>
+%s
+</p>`, err),
+		})
+		if err != nil {
+			gui.logger.WithField(
+				"method", "tray",
+			).Errorf("Unable to send error to Electron: %s", err)
+		}
+	}
+}
+
+// setMiningState asks the controller to change the mining state and
+// refreshes the stats shown once it did
+func (gui *Manager) setMiningState(state rpcproto.MinerState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	_, err := gui.client().SetState(ctx, &rpcproto.StateRequest{
+		State: state,
+	})
+	if err != nil {
+		return err
+	}
+	gui.requestRefresh()
+	return nil
+}
+
+// openDashboard opens the rig on MiningHQ in the browser. Electron opens
+// it, the same way the links on the page are opened
+func (gui *Manager) openDashboard() {
+	gui.trayMutex.Lock()
+	link := gui.trayShown.link
+	gui.trayMutex.Unlock()
+	if link == "" {
+		return
+	}
+	err := gui.sendElectronCommand("open-external", map[string]string{
+		"url": link,
+	})
+	if err != nil {
+		gui.logger.WithField(
+			"method", "tray",
+		).Errorf("Unable to open the dashboard: %s", err)
+	}
+}
+
+// showWindow shows and focuses the main window, it is hidden instead of
+// closed
+func (gui *Manager) showWindow() {
+	if gui.window == nil {
+		return
+	}
+	err := gui.window.Show()
+	if err == nil {
+		err = gui.window.Focus()
+	}
+	if err != nil {
+		gui.logger.WithField(
+			"method", "tray",
+		).Errorf("Unable to show the window: %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/install"
+	"github.com/mininghq/miner/helper/state"
+	"github.com/sirupsen/logrus"
+)
+
+// Upgrade upgrades or repairs the existing installation with the files of
+// this package without showing the installer. In install.ModeUpgrade only
+// the components that differ are replaced, install.ModeRepair replaces all
+// of them. The rig is not registered again
+func (gui *Installer) Upgrade(mode string) error {
+	record, err := state.Load(gui.homeDir)
+	if err != nil {
+		return err
+	}
+	gui.logger.WithFields(logrus.Fields{
+		"mode":         mode,
+		"install_path": record.InstallPath,
+		"version":      record.Version,
+	}).Info("Upgrading installation")
+
+	// The mining key is only needed if the mining key file of the
+	// installation is missing
+	miningKey, _ := helper.GetMiningKeyFromFile("mining_key")
+	installation, _ := gui.installation(record.InstallPath, miningKey)
+
+	result, err := install.Upgrade(
+		installation,
+		record,
+		mode,
+		func(stepID string, status string, err error) {
+			entry := gui.logger.WithFields(logrus.Fields{
+				"step":   stepID,
+				"status": status,
+			})
+			if err != nil {
+				entry.Errorf("Upgrade step failed: %s", err)
+				return
+			}
+			entry.Info("Upgrade step")
+		})
+	// The stopped services are started again, with the restored files if
+	// the upgrade failed
+	if result != nil && result.ServicesStopped {
+		startErr := gui.startService(record.InstallPath)
+		if startErr != nil {
+			gui.logger.Warningf("Unable to start the miner, please start the MiningHQ Miner from your install directory: %s", startErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	gui.logger.WithFields(logrus.Fields{
+		"version":   result.ToVersion,
+		"replaced":  result.Replaced,
+		"unchanged": result.Unchanged,
+		"recreated": result.RecreatedConfig,
+	}).Info("Installation upgraded")
+	return nil
+}
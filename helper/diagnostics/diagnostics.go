@@ -0,0 +1,401 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package diagnostics collects what support needs to look into a problem
+// with a rig into a single zip bundle: the system info, installation record,
+// component versions, service config, logs and history. Secrets such as the
+// mining key, the manager API token and the alert credentials are redacted
+package diagnostics
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/mininghq-spec/spec/caps"
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/install"
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/miner/helper/schedule"
+	"github.com/mininghq/miner/helper/state"
+)
+
+const (
+	// MaxLogSize is the most of a log included in a bundle, only the end
+	// of larger logs is included
+	MaxLogSize = 1 << 20
+	// Redacted replaces secrets in a bundle
+	Redacted = "[REDACTED]"
+	// summaryFilename is the file in the bundle describing it
+	summaryFilename = "summary.txt"
+)
+
+var (
+	// secretKeys matches the keys of JSON values that are secrets
+	secretKeys = regexp.MustCompile(`(?i)^(password|passwd|token|secret|mining_key|api_key|private_key|webhook_url)$`)
+	// unsafeName matches characters not used in file names in a bundle
+	unsafeName = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+// file is a single file in the bundle
+type file struct {
+	// name is the slash separated path in the bundle
+	name string
+	// contents of the file, secrets are redacted when the bundle is written
+	contents []byte
+}
+
+// Bundle holds the files of a diagnostics bundle until it is written
+type Bundle struct {
+	// created is when the bundle was started
+	created time.Time
+	// files in the order they were added
+	files []file
+	// secrets are redacted from every file
+	secrets []string
+	// problems lists what couldn't be collected
+	problems []string
+}
+
+// New creates an empty bundle
+func New() *Bundle {
+	return &Bundle{
+		created: time.Now(),
+	}
+}
+
+// Collect creates a bundle with the details of this rig and the MiningHQ
+// installation of the user, if any. Anything that can't be collected is
+// listed in the bundle's summary rather than failing
+func Collect(homeDir string) *Bundle {
+	bundle := New()
+
+	systemInfo, err := caps.GetSystemInfo()
+	if err != nil {
+		bundle.Problem("Unable to determine the capabilities of this rig: %s", err)
+	} else {
+		bundle.AddJSON("system.json", systemInfo)
+	}
+
+	// An interrupted installation leaves its journal behind
+	bundle.AddFile("install/journal.json", filepath.Join(homeDir, install.JournalFilename))
+
+	record, err := state.Load(homeDir)
+	if err != nil {
+		bundle.Problem("Unable to load the installation record: %s", err)
+		return bundle
+	}
+	bundle.AddJSON("install/record.json", record)
+	if record.Installed() == false {
+		bundle.Problem("The installation directory '%s' does not exist", record.InstallPath)
+		return bundle
+	}
+
+	installPath := record.InstallPath
+	controllerPath := filepath.Join(installPath, "miner-controller")
+	// The secrets themselves are never added to the bundle
+	bundle.AddSecretFile(filepath.Join(controllerPath, "mining_key"))
+	bundle.AddSecretFile(managerapi.TokenPath(installPath))
+
+	bundle.AddJSON("versions.json", map[string]interface{}{
+		"manager":    helper.Version,
+		"installed":  record.Version,
+		"controller": bundle.listDirectories(controllerPath, "miners"),
+		"miners":     bundle.listDirectories(filepath.Join(controllerPath, "miners")),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+	})
+
+	bundle.AddConfig("config/"+helper.ServiceConfigFilename, filepath.Join(installPath, helper.ServiceConfigFilename))
+	bundle.AddConfig("config/"+schedule.Filename, filepath.Join(installPath, schedule.Filename))
+
+	bundle.AddFile("logs/"+helper.ServiceLogFilename+".1", filepath.Join(installPath, helper.ServiceLogFilename+".1"))
+	bundle.AddFile("logs/"+helper.ServiceLogFilename, filepath.Join(installPath, helper.ServiceLogFilename))
+
+	bundle.AddFile("history/"+helper.ControllerVersionsFilename, filepath.Join(installPath, helper.ControllerVersionsFilename))
+	for _, filename := range helper.HistoryFilenames() {
+		bundle.AddFile("history/"+filename, filepath.Join(installPath, filename))
+	}
+	return bundle
+}
+
+// Problem records something that couldn't be collected, problems are
+// listed in the bundle's summary
+func (bundle *Bundle) Problem(format string, args ...interface{}) {
+	bundle.problems = append(bundle.problems, fmt.Sprintf(format, args...))
+}
+
+// Problems returns what couldn't be collected
+func (bundle *Bundle) Problems() []string {
+	return bundle.problems
+}
+
+// AddSecret redacts secret from every file in the bundle
+func (bundle *Bundle) AddSecret(secret string) {
+	secret = strings.TrimSpace(secret)
+	if secret == "" || secret == Redacted {
+		return
+	}
+	for _, existing := range bundle.secrets {
+		if existing == secret {
+			return
+		}
+	}
+	bundle.secrets = append(bundle.secrets, secret)
+}
+
+// AddSecretFile redacts the contents of the file at filePath from every
+// file in the bundle. A file that doesn't exist holds no secret
+func (bundle *Bundle) AddSecretFile(filePath string) {
+	secret, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			bundle.Problem("Unable to read '%s' to redact it: %s", filePath, err)
+		}
+		return
+	}
+	bundle.AddSecret(string(secret))
+}
+
+// Add adds a file with the given contents to the bundle
+func (bundle *Bundle) Add(name string, contents []byte) {
+	bundle.files = append(bundle.files, file{
+		name:     name,
+		contents: contents,
+	})
+}
+
+// AddJSON adds value to the bundle as an indented JSON file
+func (bundle *Bundle) AddJSON(name string, value interface{}) {
+	contents, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		bundle.Problem("Unable to encode '%s': %s", name, err)
+		return
+	}
+	bundle.Add(name, contents)
+}
+
+// AddFile adds the end of the file at filePath, up to MaxLogSize, to the
+// bundle. Files that don't exist are skipped
+func (bundle *Bundle) AddFile(name string, filePath string) {
+	contents, err := readTail(filePath, MaxLogSize)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			bundle.Problem("Unable to read '%s': %s", filePath, err)
+		}
+		return
+	}
+	bundle.Add(name, contents)
+}
+
+// AddConfig adds the JSON config at filePath to the bundle with the values
+// of secret keys, such as 'password' and 'webhook_url', redacted. The
+// redacted values are also redacted from every other file
+func (bundle *Bundle) AddConfig(name string, filePath string) {
+	contents, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			bundle.Problem("Unable to read '%s': %s", filePath, err)
+		}
+		return
+	}
+	var config interface{}
+	err = json.Unmarshal(contents, &config)
+	if err != nil {
+		// Without parsing the config its secrets can't be found
+		bundle.Problem("Not including '%s', it is malformed: %s", filePath, err)
+		return
+	}
+	bundle.AddJSON(name, bundle.redactKeys(config))
+}
+
+// AddMinerLog adds the log lines of a miner to the bundle
+func (bundle *Bundle) AddMinerLog(miner string, lines []string) {
+	name := unsafeName.ReplaceAllString(miner, "_")
+	bundle.Add(path.Join("logs", "miners", name+".log"), []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// Write writes the bundle as a zip file to filePath, with every secret
+// redacted
+func (bundle *Bundle) Write(filePath string) error {
+	out, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to write the diagnostics bundle '%s': %s", filePath, err)
+	}
+	err = bundle.writeZip(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return fmt.Errorf("Unable to write the diagnostics bundle '%s': %s", filePath, err)
+	}
+	return nil
+}
+
+// writeZip writes the summary and the files, redacted, to out
+func (bundle *Bundle) writeZip(out io.Writer) error {
+	archive := zip.NewWriter(out)
+	files := append([]file{{
+		name:     summaryFilename,
+		contents: bundle.summary(),
+	}}, bundle.files...)
+	for _, entry := range files {
+		header := zip.FileHeader{
+			Name:   entry.name,
+			Method: zip.Deflate,
+		}
+		header.SetModTime(bundle.created)
+		writer, err := archive.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(bundle.redact(entry.contents))
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// summary describes the bundle and lists the problems collecting it
+func (bundle *Bundle) summary() []byte {
+	var summary bytes.Buffer
+	fmt.Fprintf(&summary, "MiningHQ diagnostics\n\n")
+	fmt.Fprintf(&summary, "Created:  %s\n", bundle.created.Format(time.RFC1123Z))
+	fmt.Fprintf(&summary, "Version:  %s\n", helper.Version)
+	fmt.Fprintf(&summary, "Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&summary, "Redacted: %d secrets\n\n", len(bundle.secrets))
+	fmt.Fprintf(&summary, "Files:\n")
+	for _, entry := range bundle.files {
+		fmt.Fprintf(&summary, "  %s (%d bytes)\n", entry.name, len(entry.contents))
+	}
+	if len(bundle.problems) > 0 {
+		fmt.Fprintf(&summary, "\nProblems collecting diagnostics:\n")
+		for _, problem := range bundle.problems {
+			fmt.Fprintf(&summary, "  %s\n", problem)
+		}
+	}
+	return summary.Bytes()
+}
+
+// redact replaces every secret in contents. Longer secrets are replaced
+// first so that a secret containing another is redacted completely
+func (bundle *Bundle) redact(contents []byte) []byte {
+	secrets := append([]string{}, bundle.secrets...)
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	for _, secret := range secrets {
+		contents = bytes.Replace(contents, []byte(secret), []byte(Redacted), -1)
+		// Secrets in JSON files, such as the history, may be escaped
+		escaped, err := json.Marshal(secret)
+		if err == nil {
+			contents = bytes.Replace(contents, escaped[1:len(escaped)-1], []byte(Redacted), -1)
+		}
+	}
+	return contents
+}
+
+// redactKeys replaces the values of secret keys in the decoded JSON value,
+// the values are added as secrets
+func (bundle *Bundle) redactKeys(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if secretKeys.MatchString(key) {
+				if secret, ok := child.(string); ok && secret != "" {
+					bundle.AddSecret(secret)
+					typed[key] = Redacted
+				}
+				continue
+			}
+			typed[key] = bundle.redactKeys(child)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			typed[i] = bundle.redactKeys(child)
+		}
+	}
+	return value
+}
+
+// listDirectories returns the names of the directories in dirPath, except
+// those excluded
+func (bundle *Bundle) listDirectories(dirPath string, exclude ...string) []string {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) == false {
+			bundle.Problem("Unable to list '%s': %s", dirPath, err)
+		}
+		return []string{}
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() == false || contains(exclude, entry.Name()) {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// readTail reads the last maxSize bytes of the file at filePath
+func readTail(filePath string, maxSize int64) ([]byte, error) {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSize {
+		_, err = in.Seek(info.Size()-maxSize, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.ReadAll(io.LimitReader(in, maxSize))
+}
+
+// contains checks if value is in values
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
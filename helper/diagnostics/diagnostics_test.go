@@ -0,0 +1,158 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package diagnostics
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRedact checks that no secret is written to a bundle, whether it is
+// added as is, JSON encoded or only found in a config
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		// secret must not appear in the bundle
+		secret string
+		// file is the secret file the secret is read from, empty for
+		// secrets that are only found in the config
+		file string
+		// configKey is the path of the secret in the service config,
+		// empty for secrets that aren't in the config
+		configKey string
+	}{
+		{name: "mining key", secret: "MK-7f3a9c2e41d8", file: "mining_key"},
+		{name: "manager API token", secret: "tok+/\"<manager>\\api", file: "manager_api_token"},
+		{name: "SMTP password", secret: "smtp pass&word", configKey: "alerts.smtp.password"},
+		{name: "webhook URL", secret: "https://hooks.example.com/T0/B1?key=abc&sig=def", configKey: "alerts.webhook_url"},
+		{name: "pool password", secret: "pool-secret-99", configKey: "pools.password"},
+		// Contains the mining key, it must not be redacted as the key
+		// followed by the rest
+		{name: "secret containing another", secret: "MK-7f3a9c2e41d8-tail-of-longer", configKey: "alerts.smtp.secret"},
+	}
+
+	dir, err := ioutil.TempDir("", "diagnostics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := New()
+	config := map[string]interface{}{
+		"alerts": map[string]interface{}{
+			"enabled": true,
+			"smtp": map[string]interface{}{
+				"address": "smtp.example.com:587",
+			},
+		},
+		"pools": []interface{}{
+			map[string]interface{}{"url": "pool.example.com:3333"},
+		},
+	}
+	var log []string
+	var messages []string
+	for _, test := range tests {
+		if test.file != "" {
+			filePath := filepath.Join(dir, test.file)
+			err = ioutil.WriteFile(filePath, []byte(test.secret+"\n"), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bundle.AddSecretFile(filePath)
+		}
+		switch test.configKey {
+		case "":
+		case "pools.password":
+			config["pools"].([]interface{})[0].(map[string]interface{})["password"] = test.secret
+		default:
+			parent := config
+			keys := strings.Split(test.configKey, ".")
+			for _, key := range keys[:len(keys)-1] {
+				parent = parent[key].(map[string]interface{})
+			}
+			parent[keys[len(keys)-1]] = test.secret
+		}
+		log = append(log, fmt.Sprintf("Using %s %s", test.name, test.secret))
+		messages = append(messages, fmt.Sprintf("Changed %s to '%s'", test.name, test.secret))
+	}
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "miner-service.json")
+	err = ioutil.WriteFile(configPath, configBytes, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.AddConfig("config/miner-service.json", configPath)
+	bundle.Add("logs/miner-service.log", []byte(strings.Join(log, "\n")))
+	// JSON escapes quotes, backslashes, '<', '>' and '&'
+	bundle.AddJSON("history/events.json", messages)
+
+	bundlePath := filepath.Join(dir, "diagnostics.zip")
+	err = bundle.Write(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var written strings.Builder
+	for _, entry := range archive.File {
+		reader, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&written, "%s\n%s\n", entry.Name, contents)
+	}
+	if strings.Contains(written.String(), "Redacted: 6 secrets") == false {
+		t.Errorf("Expected the summary to count 6 secrets")
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			escaped, _ := json.Marshal(test.secret)
+			for _, form := range []string{test.secret, string(escaped[1 : len(escaped)-1])} {
+				if strings.Contains(written.String(), form) {
+					t.Errorf("The bundle contains the secret %q", form)
+				}
+			}
+		})
+	}
+	if strings.Contains(written.String(), "tail-of-longer") {
+		t.Errorf("The bundle contains the end of a secret containing another")
+	}
+}
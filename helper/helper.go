@@ -29,6 +29,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
@@ -38,8 +39,42 @@ const (
 	ServiceDisplayName = "MiningHQ Miner"
 	// ServiceDescription for the service
 	ServiceDescription = "The MiningHQ.io Miner service for controlling mining with this rig"
+
+	// ManagerAddress is the address of the miner controller's manager API
+	ManagerAddress = "localhost:64630"
+	// EnvManagerAddress overrides the address the manager and the CLI
+	// connect to the miner controller on
+	EnvManagerAddress = "MHQ_MANAGER_ADDRESS"
+
+	// DefaultKillGracePeriod is the time processes get to exit cleanly
+	// before they are killed
+	DefaultKillGracePeriod = time.Second * 10
+
+	// ServiceConfigFilename is the name of the service config file in the
+	// installation directory
+	ServiceConfigFilename = "miner-service.json"
+	// ServiceLogFilename is the file in the installation directory the
+	// service logs to, the controller's output is logged by the service
+	ServiceLogFilename = "miner-service.log"
+	// MaxServiceLogSize is the size the service log grows to before it is
+	// rotated, the previous log is kept with a '.1' suffix
+	MaxServiceLogSize = 5 << 20
 )
 
+// Version is the version of MiningHQ Miner, it is set at build time with
+// -ldflags "-X github.com/mininghq/miner/helper.Version=<version>"
+var Version = "dev"
+
+// ControllerAddress returns the address of the miner controller's manager
+// API, ManagerAddress unless it is overridden by MHQ_MANAGER_ADDRESS
+func ControllerAddress() string {
+	address := strings.TrimSpace(os.Getenv(EnvManagerAddress))
+	if address == "" {
+		return ManagerAddress
+	}
+	return address
+}
+
 // CreateInstallDirectories creates the directories needed for installation
 //
 // It returns the path where miners will be installed, users need to exclude
@@ -105,3 +140,23 @@ func CopyFile(src string, dst string) error {
 	}
 	return out.Close()
 }
+
+// RejectionRate returns the percentage of the submitted shares that were
+// rejected, 0 if no shares were submitted
+func RejectionRate(acceptedShares int64, rejectedShares int64) float64 {
+	submitted := acceptedShares + rejectedShares
+	if submitted == 0 {
+		return 0
+	}
+	return float64(rejectedShares) / float64(submitted) * 100
+}
+
+// containsPID checks if pid is in pids
+func containsPID(pids []int, pid int) bool {
+	for _, candidate := range pids {
+		if candidate == pid {
+			return true
+		}
+	}
+	return false
+}
@@ -23,10 +23,152 @@
 package helper
 
 import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 // KillProcess kills a process and all its children
 func KillProcess(pid int) error {
-	return syscall.Kill(pid, syscall.SIGKILL)
+	_, err := KillProcessTree(pid, DefaultKillGracePeriod)
+	return err
+}
+
+// KillProcessTree terminates a process and all its descendants. Every
+// process is sent SIGTERM first, those still running after gracePeriod are
+// sent SIGKILL. It returns the PIDs that were terminated
+func KillProcessTree(pid int, gracePeriod time.Duration) ([]int, error) {
+	tree, err := ProcessTree(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// The parent is signalled first so that it can't restart its children
+	for _, treePID := range tree {
+		syscall.Kill(treePID, syscall.SIGTERM)
+	}
+	running := waitForExit(tree, gracePeriod)
+
+	// Children started during the grace period are killed as well
+	if len(running) > 0 {
+		current, err := processTrees(running)
+		if err == nil {
+			for _, treePID := range current {
+				if containsPID(tree, treePID) == false {
+					tree = append(tree, treePID)
+				}
+			}
+			running = current
+		}
+	}
+	for _, treePID := range running {
+		syscall.Kill(treePID, syscall.SIGKILL)
+	}
+	running = waitForExit(running, time.Second*2)
+
+	var terminated []int
+	for _, treePID := range tree {
+		if containsPID(running, treePID) == false {
+			terminated = append(terminated, treePID)
+		}
+	}
+	if len(running) > 0 {
+		return terminated, fmt.Errorf("Unable to kill processes %v", running)
+	}
+	return terminated, nil
+}
+
+// ProcessTree returns pid followed by all its descendants, parents are
+// always listed before their children
+func ProcessTree(pid int) ([]int, error) {
+	if isRunning(pid) == false {
+		return nil, fmt.Errorf("Process %d is not running", pid)
+	}
+	return processTrees([]int{pid})
+}
+
+// processTrees returns the pids followed by all their descendants, parents
+// are always listed before their children
+func processTrees(pids []int) ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		childPID, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		parentPID, _, err := readProcStat(childPID)
+		if err != nil {
+			// The process exited while we were walking /proc
+			continue
+		}
+		children[parentPID] = append(children[parentPID], childPID)
+	}
+
+	tree := append([]int{}, pids...)
+	for i := 0; i < len(tree); i++ {
+		for _, childPID := range children[tree[i]] {
+			if containsPID(tree, childPID) == false {
+				tree = append(tree, childPID)
+			}
+		}
+	}
+	return tree, nil
+}
+
+// readProcStat returns the parent PID and state of a process from
+// /proc/<pid>/stat
+func readProcStat(pid int) (int, string, error) {
+	statBytes, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, "", err
+	}
+	// The executable name is in brackets and may contain spaces, the
+	// fields we need follow the closing bracket
+	stat := string(statBytes)
+	nameEnd := strings.LastIndex(stat, ")")
+	if nameEnd < 0 {
+		return 0, "", fmt.Errorf("Unable to parse /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(stat[nameEnd+1:])
+	if len(fields) < 2 {
+		return 0, "", fmt.Errorf("Unable to parse /proc/%d/stat", pid)
+	}
+	parentPID, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", err
+	}
+	return parentPID, fields[0], nil
+}
+
+// isRunning checks if a process exists and is not a zombie waiting to be
+// reaped by its parent
+func isRunning(pid int) bool {
+	_, state, err := readProcStat(pid)
+	return err == nil && state != "Z" && state != "X"
+}
+
+// waitForExit waits up to timeout for the processes to exit and returns
+// those still running
+func waitForExit(pids []int, timeout time.Duration) []int {
+	deadline := time.Now().Add(timeout)
+	for {
+		var running []int
+		for _, pid := range pids {
+			if isRunning(pid) {
+				running = append(running, pid)
+			}
+		}
+		if len(running) == 0 || time.Now().After(deadline) {
+			return running
+		}
+		time.Sleep(time.Millisecond * 100)
+		pids = running
+	}
 }
@@ -23,8 +23,13 @@
 package helper
 
 import (
+	"fmt"
 	"os/exec"
 	"strconv"
+	"syscall"
+	"time"
+
+	ps "github.com/mitchellh/go-ps"
 )
 
 // KillProcess kills a process and all its children
@@ -32,3 +37,123 @@ func KillProcess(pid int) error {
 	// -PID (minus PID) to kill the process and all their children
 	return exec.Command("TASKKILL", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
 }
+
+// KillProcessTree terminates a process and all its descendants. The
+// processes are asked to close first, those still running after
+// gracePeriod are forcefully terminated. It returns the PIDs that
+// were terminated
+//
+// Windows reuses PIDs as soon as a process exits, the processes are held
+// open while they are terminated so that only the processes of the tree
+// are ever forcefully terminated
+func KillProcessTree(pid int, gracePeriod time.Duration) ([]int, error) {
+	tree, err := ProcessTree(pid)
+	if err != nil {
+		return nil, err
+	}
+	handles := openProcesses(tree)
+	defer func() {
+		for _, handle := range handles {
+			syscall.CloseHandle(handle)
+		}
+	}()
+
+	// /T to include the process and all their children. Closing is only
+	// requested by PID, a process that reused the PID may be asked to
+	// close but isn't terminated
+	exec.Command("TASKKILL", "/T", "/PID", strconv.Itoa(pid)).Run()
+	running := waitForExit(tree, handles, gracePeriod)
+	if len(running) > 0 {
+		for _, treePID := range running {
+			syscall.TerminateProcess(handles[treePID], 1)
+		}
+		running = waitForExit(running, handles, time.Second*2)
+	}
+
+	var terminated []int
+	for _, treePID := range tree {
+		if containsPID(running, treePID) == false {
+			terminated = append(terminated, treePID)
+		}
+	}
+	if len(running) > 0 {
+		return terminated, fmt.Errorf("Unable to kill processes %v", running)
+	}
+	return terminated, nil
+}
+
+// ProcessTree returns pid followed by all its descendants, parents are
+// always listed before their children
+func ProcessTree(pid int) ([]int, error) {
+	processes, err := ps.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	children := make(map[int][]int)
+	for _, process := range processes {
+		if process.Pid() == pid {
+			found = true
+		}
+		// The System Idle Process is its own parent
+		if process.Pid() != process.PPid() {
+			children[process.PPid()] = append(children[process.PPid()], process.Pid())
+		}
+	}
+	if found == false {
+		return nil, fmt.Errorf("Process %d is not running", pid)
+	}
+
+	// Parent PIDs are never updated, a reused PID can make a process
+	// appear as the child of its own descendant
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		for _, childPID := range children[tree[i]] {
+			if containsPID(tree, childPID) == false {
+				tree = append(tree, childPID)
+			}
+		}
+	}
+	return tree, nil
+}
+
+// openProcesses opens the processes to wait for and terminate them. A
+// process that can't be opened has already exited
+func openProcesses(pids []int) map[int]syscall.Handle {
+	handles := make(map[int]syscall.Handle)
+	for _, pid := range pids {
+		handle, err := syscall.OpenProcess(
+			syscall.SYNCHRONIZE|syscall.PROCESS_TERMINATE|syscall.PROCESS_QUERY_INFORMATION,
+			false,
+			uint32(pid))
+		if err == nil {
+			handles[pid] = handle
+		}
+	}
+	return handles
+}
+
+// waitForExit waits up to timeout for the opened processes to exit and
+// returns those still running
+func waitForExit(pids []int, handles map[int]syscall.Handle, timeout time.Duration) []int {
+	deadline := time.Now().Add(timeout)
+	for {
+		var running []int
+		for _, pid := range pids {
+			handle, opened := handles[pid]
+			if opened == false {
+				continue
+			}
+			event, _ := syscall.WaitForSingleObject(handle, 0)
+			if event != syscall.WAIT_OBJECT_0 {
+				running = append(running, pid)
+			}
+		}
+		if len(running) == 0 || time.Now().After(deadline) {
+			return running
+		}
+		time.Sleep(time.Millisecond * 100)
+		pids = running
+	}
+}
@@ -0,0 +1,197 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package helper implements various helper functions
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	// IntegrityHistoryFilename is the file in the installation directory that
+	// records files failing signature verification
+	IntegrityHistoryFilename = "integrity-history.jsonl"
+	// RollbackHistoryFilename is the file in the installation directory that
+	// records controller rollbacks
+	RollbackHistoryFilename = "rollback-history.jsonl"
+	// PauseHistoryFilename is the file in the installation directory that
+	// records mining paused and resumed by the service, ie. on the mining
+	// schedule or while the user is active
+	PauseHistoryFilename = "pause-history.jsonl"
+	// ThrottleHistoryFilename is the file in the installation directory that
+	// records mining throttled on the temperatures and load of the rig
+	ThrottleHistoryFilename = "throttle-history.jsonl"
+	// AlertHistoryFilename is the file in the installation directory that
+	// records the alerts raised on rig problems
+	AlertHistoryFilename = "alert-history.jsonl"
+	// ControllerVersionsFilename is the file in the installation directory
+	// that tracks the last known good and bad controller versions
+	ControllerVersionsFilename = "controller-versions.json"
+)
+
+// HistoryFilenames returns the history files in the installation directory
+func HistoryFilenames() []string {
+	return []string{
+		IntegrityHistoryFilename,
+		RollbackHistoryFilename,
+		PauseHistoryFilename,
+		ThrottleHistoryFilename,
+		AlertHistoryFilename,
+	}
+}
+
+// Event is a single entry in one of the service's history files. History
+// files contain one JSON encoded event per line so that the manager can
+// display them without the service running
+type Event struct {
+	// Time the event occurred
+	Time time.Time `json:"time"`
+	// Type of the event, ie. 'quarantined', 'rollback', 'paused',
+	// 'throttled' or 'alert'
+	Type string `json:"type"`
+	// Version is the miner-controller version the event relates to
+	Version string `json:"version,omitempty"`
+	// Path is the file the event relates to
+	Path string `json:"path,omitempty"`
+	// Message is a human readable description of the event
+	Message string `json:"message"`
+}
+
+// AppendEvent appends the event to the history file at path
+func AppendEvent(path string, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	eventBytes, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(eventBytes, '\n'))
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// ReadEvents reads all the events from the history file at path, oldest
+// first. Lines that can't be parsed are skipped
+func ReadEvents(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if json.Unmarshal(scanner.Bytes(), &event) == nil {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// EventFollower reads the events appended to a history file since it was
+// last read, ie. to act on new alerts while the service records them
+type EventFollower struct {
+	// path is the history file
+	path string
+	// offset is where the next event starts
+	offset int64
+}
+
+// NewEventFollower follows the history file at path. The events already
+// recorded are skipped, the file doesn't need to exist yet
+func NewEventFollower(path string) *EventFollower {
+	follower := EventFollower{
+		path: path,
+	}
+	info, err := os.Stat(path)
+	if err == nil {
+		follower.offset = info.Size()
+	}
+	return &follower
+}
+
+// Next returns the events appended since the last call, oldest first. A
+// line still being written is returned by a later call. When the file was
+// replaced by a smaller one it is read from the start. Lines that can't be
+// parsed are skipped
+func (follower *EventFollower) Next() ([]Event, error) {
+	file, err := os.Open(follower.path)
+	if os.IsNotExist(err) {
+		follower.offset = 0
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < follower.offset {
+		follower.offset = 0
+	}
+	_, err = file.Seek(follower.offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	appended, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.LastIndexByte(appended, '\n')
+	if end == -1 {
+		return nil, nil
+	}
+	follower.offset += int64(end + 1)
+
+	var events []Event
+	for _, line := range bytes.Split(appended[:end], []byte{'\n'}) {
+		var event Event
+		if json.Unmarshal(line, &event) == nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,110 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package helper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestEventFollower checks that only the events appended after the
+// follower started are returned, once each
+func TestEventFollower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, AlertHistoryFilename)
+	epoch := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+
+	follower := NewEventFollower(path)
+	events, err := follower.Next()
+	if err != nil || len(events) != 0 {
+		t.Fatalf("Expected no events before the file exists, got %v %v", events, err)
+	}
+
+	err = AppendEvent(path, Event{Time: epoch, Type: "alert", Message: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower = NewEventFollower(path)
+	err = AppendEvent(path, Event{Time: epoch, Type: "alert", Message: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AppendEvent(path, Event{Time: epoch, Type: "resolved", Message: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A line still being written is left for later
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString(`{"type":"alert","mess`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err = follower.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Message != "first" || events[1].Message != "second" {
+		t.Fatalf("Expected the events 'first' and 'second', got %v", events)
+	}
+
+	_, err = file.WriteString(`age":"third"}` + "\n")
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err = follower.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Message != "third" {
+		t.Fatalf("Expected the event 'third', got %v", events)
+	}
+
+	// A replaced file is read from the start
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AppendEvent(path, Event{Time: epoch, Type: "alert", Message: "fourth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err = follower.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Message != "fourth" {
+		t.Fatalf("Expected the event 'fourth', got %v", events)
+	}
+}
@@ -0,0 +1,334 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package install
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/ProtonMail/go-autostart"
+	"github.com/mininghq/miner-controller/src/mhq"
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/miner/helper/state"
+)
+
+// IDs of the installation steps, in the order they run
+const (
+	// StepCreateDirectories creates the installation directories
+	StepCreateDirectories = "create_directories"
+	// StepRegisterRig registers the rig with MiningHQ
+	StepRegisterRig = "register_rig"
+	// StepCreateConfig writes the mining key, rig ID and manager API
+	// credentials
+	StepCreateConfig = "create_config"
+	// StepInstallFiles copies the service files
+	StepInstallFiles = "install_files"
+	// StepEnableAutostart starts the service on login
+	StepEnableAutostart = "enable_autostart"
+	// StepInstallManager moves the Miner Manager to the installation path
+	StepInstallManager = "install_manager"
+	// StepRecordInstallPath saves the installation record, this marks the
+	// installation as complete
+	StepRecordInstallPath = "record_install_path"
+)
+
+// Keys of the values recorded in the transaction
+const (
+	// ValueAVExcludeDirectory is the directory to exclude from antivirus
+	ValueAVExcludeDirectory = "av_exclude_directory"
+	// ValueRigID is the ID MiningHQ registered the rig as
+	ValueRigID = "rig_id"
+	// valueCreatedInstallPath is set if the installation path was created
+	valueCreatedInstallPath = "created_install_path"
+	// valueCreatedControllerPath is set if the controller path was created
+	valueCreatedControllerPath = "created_controller_path"
+	// valueEnabledAutostart is set if autostart was enabled by the installer
+	valueEnabledAutostart = "enabled_autostart"
+	// valueManagerPath is the path the Miner Manager was moved from
+	valueManagerPath = "manager_path"
+)
+
+// Installation holds everything the steps need to install MiningHQ
+type Installation struct {
+	// HomeDir is the user's home directory
+	HomeDir string
+	// InstallPath is the directory to install to
+	InstallPath string
+	// MiningKey is the user's mining key
+	MiningKey string
+	// APIEndpoint is the MiningHQ API endpoint
+	APIEndpoint string
+	// Register is the rig registration, it must be set before the steps run
+	Register mhq.RegisterRigRequest
+	// ToolsPath is the directory containing the files to install
+	ToolsPath string
+	// Files lists the files in ToolsPath to install
+	Files []string
+	// Autostart starts the service on login
+	Autostart *autostart.App
+	// ManagerPath is the path of the running Miner Manager
+	ManagerPath string
+	// ManagerName is the filename of the Miner Manager once installed
+	ManagerName string
+	// SystemWide saves the installation record for all users
+	SystemWide bool
+	// ManagerTLS generates a self-signed certificate for the manager API
+	// along with its token
+	ManagerTLS bool
+}
+
+// Steps returns the steps to install MiningHQ, in order
+func Steps(installation *Installation) []Step {
+	return []Step{
+		createDirectories(installation),
+		registerRig(installation),
+		createConfig(installation),
+		installFiles(installation),
+		enableAutostart(installation),
+		installManager(installation),
+		recordInstallPath(installation),
+	}
+}
+
+// createDirectories creates the installation directories, only the
+// directories that didn't exist are removed on undo
+func createDirectories(installation *Installation) Step {
+	controllerPath := filepath.Join(installation.InstallPath, "miner-controller")
+	return Step{
+		ID: StepCreateDirectories,
+		Do: func(tx *Transaction) error {
+			if _, err := os.Stat(installation.InstallPath); os.IsNotExist(err) {
+				tx.SetValue(valueCreatedInstallPath, "true")
+			}
+			if _, err := os.Stat(controllerPath); os.IsNotExist(err) {
+				tx.SetValue(valueCreatedControllerPath, "true")
+			}
+			avExcludeDirectory, err := helper.CreateInstallDirectories(installation.InstallPath)
+			if err != nil {
+				return err
+			}
+			tx.SetValue(ValueAVExcludeDirectory, avExcludeDirectory)
+			return nil
+		},
+		Undo: func(tx *Transaction) error {
+			if tx.Value(valueCreatedInstallPath) != "" {
+				return os.RemoveAll(installation.InstallPath)
+			}
+			if tx.Value(valueCreatedControllerPath) != "" {
+				return os.RemoveAll(controllerPath)
+			}
+			return nil
+		},
+	}
+}
+
+// registerRig registers the rig with MiningHQ, it is deregistered on undo
+func registerRig(installation *Installation) Step {
+	return Step{
+		ID: StepRegisterRig,
+		Do: func(tx *Transaction) error {
+			apiClient, err := mhq.NewClient(installation.MiningKey, installation.APIEndpoint)
+			if err != nil {
+				return err
+			}
+			rigID, err := apiClient.RegisterRig(installation.Register)
+			if err != nil {
+				return err
+			}
+			tx.SetValue(ValueRigID, rigID)
+			return nil
+		},
+		Undo: func(tx *Transaction) error {
+			if tx.Value(ValueRigID) == "" {
+				return nil
+			}
+			apiClient, err := mhq.NewClient(installation.MiningKey, installation.APIEndpoint)
+			if err != nil {
+				return err
+			}
+			return apiClient.DeregisterRig(mhq.DeregisterRigRequest{
+				RigID: tx.Value(ValueRigID),
+			})
+		},
+	}
+}
+
+// createConfig writes the mining key and rig ID the controller needs, and
+// the credentials clients of the manager API present
+func createConfig(installation *Installation) Step {
+	miningKeyPath := filepath.Join(installation.InstallPath, "miner-controller", "mining_key")
+	rigIDPath := filepath.Join(installation.InstallPath, "miner-controller", "rig_id")
+	return Step{
+		ID: StepCreateConfig,
+		Do: func(tx *Transaction) error {
+			rigID := tx.Value(ValueRigID)
+			if rigID == "" {
+				return errors.New("The rig has not been registered")
+			}
+			err := writeFile(miningKeyPath, []byte(installation.MiningKey), 0644)
+			if err != nil {
+				return err
+			}
+			err = writeFile(rigIDPath, []byte(rigID), 0644)
+			if err != nil {
+				return err
+			}
+			err = managerapi.GenerateToken(installation.InstallPath)
+			if err != nil {
+				return err
+			}
+			if installation.ManagerTLS {
+				return managerapi.GenerateCertificate(installation.InstallPath)
+			}
+			return nil
+		},
+		Undo: func(tx *Transaction) error {
+			err := managerapi.RemoveCredentials(installation.InstallPath)
+			if err != nil {
+				return err
+			}
+			return removeFiles(miningKeyPath, rigIDPath)
+		},
+	}
+}
+
+// installFiles copies the service files to the installation path
+func installFiles(installation *Installation) Step {
+	var installed []string
+	for _, filename := range installation.Files {
+		installed = append(installed, filepath.Join(installation.InstallPath, filename))
+	}
+	return Step{
+		ID: StepInstallFiles,
+		Do: func(tx *Transaction) error {
+			for _, filename := range installation.Files {
+				err := helper.CopyFile(
+					filepath.Join(installation.ToolsPath, filename),
+					filepath.Join(installation.InstallPath, filename))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Undo: func(tx *Transaction) error {
+			return removeFiles(installed...)
+		},
+	}
+}
+
+// enableAutostart starts the service on login. Autostart is only disabled
+// on undo if the installer enabled it
+func enableAutostart(installation *Installation) Step {
+	return Step{
+		ID: StepEnableAutostart,
+		Do: func(tx *Transaction) error {
+			if installation.Autostart.IsEnabled(false) {
+				return nil
+			}
+			err := installation.Autostart.Enable(false)
+			if err != nil {
+				return err
+			}
+			tx.SetValue(valueEnabledAutostart, "true")
+			return nil
+		},
+		Undo: func(tx *Transaction) error {
+			if tx.Value(valueEnabledAutostart) == "" || installation.Autostart.IsEnabled(false) == false {
+				return nil
+			}
+			return installation.Autostart.Disable(false)
+		},
+	}
+}
+
+// installManager moves the running Miner Manager to the installation path,
+// it is moved back on undo
+func installManager(installation *Installation) Step {
+	installedPath := filepath.Join(installation.InstallPath, installation.ManagerName)
+	return Step{
+		ID: StepInstallManager,
+		Do: func(tx *Transaction) error {
+			tx.SetValue(valueManagerPath, installation.ManagerPath)
+			return os.Rename(installation.ManagerPath, installedPath)
+		},
+		Undo: func(tx *Transaction) error {
+			if _, err := os.Stat(installedPath); os.IsNotExist(err) {
+				return nil
+			}
+			return os.Rename(installedPath, tx.Value(valueManagerPath))
+		},
+	}
+}
+
+// recordInstallPath saves the installation record
+func recordInstallPath(installation *Installation) Step {
+	record := state.NewRecord(installation.HomeDir, installation.InstallPath, installation.SystemWide)
+	return Step{
+		ID: StepRecordInstallPath,
+		Do: func(tx *Transaction) error {
+			record.Version = helper.Version
+			record.RigID = tx.Value(ValueRigID)
+			record.Components = append([]string{}, installation.Files...)
+			if installation.ManagerName != "" {
+				record.Components = append(record.Components, installation.ManagerName)
+			}
+			if installation.Autostart != nil {
+				record.Autostart = []state.AutostartEntry{{
+					Name:        installation.Autostart.Name,
+					DisplayName: installation.Autostart.DisplayName,
+					Exec:        installation.Autostart.Exec,
+				}}
+			}
+			return record.Save()
+		},
+		Undo: func(tx *Transaction) error {
+			return record.Remove()
+		},
+	}
+}
+
+// writeFile writes the file, replacing any existing file
+func writeFile(path string, contents []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// removeFiles removes the files, files that don't exist are ignored
+func removeFiles(paths ...string) error {
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && os.IsNotExist(err) == false {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package install implements the installation steps shared by the text
+// and graphical installers. Every step that changes the system can be
+// undone and is recorded in a journal, a failed installation is rolled
+// back and an interrupted installation resumes where it stopped
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// JournalFilename is the file in the user's home directory that records
+// the steps of an installation in progress
+const JournalFilename = ".mhqinstall"
+
+// Statuses passed to a Reporter
+const (
+	// StatusStarted is reported before a step runs
+	StatusStarted = "started"
+	// StatusDone is reported when a step completed
+	StatusDone = "done"
+	// StatusResumed is reported for a step completed by an earlier,
+	// interrupted installation
+	StatusResumed = "resumed"
+	// StatusFailed is reported when a step failed
+	StatusFailed = "failed"
+	// StatusUndone is reported when a completed step was rolled back
+	StatusUndone = "undone"
+	// StatusUndoFailed is reported when a completed step could not be
+	// rolled back
+	StatusUndoFailed = "undo_failed"
+)
+
+// Step is a single reversible installation step
+type Step struct {
+	// ID identifies the step in the journal
+	ID string
+	// Do performs the step. Values needed by later steps or by Undo must
+	// be stored in the transaction
+	Do func(tx *Transaction) error
+	// Undo reverts the step, it may be nil for steps that change nothing
+	Undo func(tx *Transaction) error
+}
+
+// Reporter is notified of the progress of every step
+type Reporter func(stepID string, status string, err error)
+
+// StepError is returned when a step fails
+type StepError struct {
+	// StepID is the ID of the step that failed
+	StepID string
+	// Err is the error the step failed with
+	Err error
+	// RollbackErr is set when the completed steps could not all be undone
+	RollbackErr error
+}
+
+// Error implements error
+func (err *StepError) Error() string {
+	if err.RollbackErr != nil {
+		return fmt.Sprintf("%s failed: %s. Rollback failed: %s", err.StepID, err.Err, err.RollbackErr)
+	}
+	return fmt.Sprintf("%s failed: %s", err.StepID, err.Err)
+}
+
+// journal is persisted after every step
+type journal struct {
+	// InstallPath is the directory being installed to
+	InstallPath string `json:"install_path"`
+	// Completed lists the IDs of the completed steps in order
+	Completed []string `json:"completed"`
+	// Values holds the values recorded by the steps
+	Values map[string]string `json:"values"`
+	// Updated is when the journal was last written
+	Updated time.Time `json:"updated"`
+}
+
+// Transaction runs installation steps, recording them in the journal
+type Transaction struct {
+	// path is the path of the journal file
+	path string
+	// journal holds the recorded steps
+	journal journal
+	// resumed is set when an existing journal was loaded
+	resumed bool
+	// reporter is notified of progress, it may be nil
+	reporter Reporter
+	// steps holds every step passed to Run by ID, they are needed to undo
+	// the completed steps
+	steps map[string]Step
+}
+
+// Open opens the journal at journalPath. If an interrupted installation
+// left a journal, it is resumed and installPath is ignored, see InstallPath.
+// The journal is only written once SetInstallPath is called
+func Open(journalPath string, installPath string, reporter Reporter) (*Transaction, error) {
+	tx := Transaction{
+		path:     journalPath,
+		reporter: reporter,
+		steps:    make(map[string]Step),
+		journal: journal{
+			InstallPath: installPath,
+			Values:      make(map[string]string),
+		},
+	}
+
+	journalBytes, err := ioutil.ReadFile(journalPath)
+	if err != nil && os.IsNotExist(err) == false {
+		return nil, fmt.Errorf("Unable to read the installation journal: %s", err)
+	}
+	if err == nil {
+		var saved journal
+		err = json.Unmarshal(journalBytes, &saved)
+		if err != nil {
+			return nil, fmt.Errorf("The installation journal '%s' is malformed: %s", journalPath, err)
+		}
+		// The steps can't be resumed or undone without the directory they
+		// installed to
+		if saved.InstallPath == "" && len(saved.Completed) > 0 {
+			return nil, fmt.Errorf("The installation journal '%s' doesn't record the installation directory", journalPath)
+		}
+		if saved.InstallPath == "" {
+			saved.InstallPath = installPath
+		}
+		if saved.Values == nil {
+			saved.Values = make(map[string]string)
+		}
+		tx.journal = saved
+		tx.resumed = true
+	}
+	return &tx, nil
+}
+
+// Resumed returns true if an interrupted installation is being resumed
+func (tx *Transaction) Resumed() bool {
+	return tx.resumed
+}
+
+// InstallPath returns the directory being installed to
+func (tx *Transaction) InstallPath() string {
+	return tx.journal.InstallPath
+}
+
+// SetInstallPath sets the directory being installed to and saves the
+// journal, it must be called before the first step runs. The directory
+// can't be changed once steps have completed, they must be rolled back first
+func (tx *Transaction) SetInstallPath(installPath string) error {
+	if installPath == "" {
+		return errors.New("An installation directory must be set")
+	}
+	if len(tx.journal.Completed) > 0 && installPath != tx.journal.InstallPath {
+		return fmt.Errorf(
+			"The interrupted installation to '%s' must be undone before installing to '%s'",
+			tx.journal.InstallPath,
+			installPath)
+	}
+	tx.journal.InstallPath = installPath
+	return tx.save()
+}
+
+// Value returns a value recorded by a step
+func (tx *Transaction) Value(key string) string {
+	return tx.journal.Values[key]
+}
+
+// SetValue records a value, it is saved along with the step
+func (tx *Transaction) SetValue(key string, value string) {
+	tx.journal.Values[key] = value
+}
+
+// Completed checks if the step with the given ID has completed
+func (tx *Transaction) Completed(stepID string) bool {
+	for _, completed := range tx.journal.Completed {
+		if completed == stepID {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the steps in order, skipping those already completed. If a
+// step fails, every completed step is undone and a *StepError is returned
+func (tx *Transaction) Run(steps []Step) error {
+	for _, step := range steps {
+		tx.steps[step.ID] = step
+	}
+
+	for _, step := range steps {
+		if tx.Completed(step.ID) {
+			tx.report(step.ID, StatusResumed, nil)
+			continue
+		}
+
+		tx.report(step.ID, StatusStarted, nil)
+		err := step.Do(tx)
+		if err == nil {
+			tx.journal.Completed = append(tx.journal.Completed, step.ID)
+			err = tx.save()
+		}
+		if err != nil {
+			tx.report(step.ID, StatusFailed, err)
+			stepErr := StepError{
+				StepID: step.ID,
+				Err:    err,
+			}
+			// The failed step may have partially completed, it is undone
+			// before the completed steps
+			if tx.Completed(step.ID) == false && step.Undo != nil {
+				undoErr := step.Undo(tx)
+				if undoErr != nil {
+					tx.report(step.ID, StatusUndoFailed, undoErr)
+					stepErr.RollbackErr = undoErr
+				}
+			}
+			rollbackErr := tx.Rollback(steps)
+			if rollbackErr != nil {
+				stepErr.RollbackErr = rollbackErr
+			}
+			return &stepErr
+		}
+		tx.report(step.ID, StatusDone, nil)
+	}
+	return nil
+}
+
+// Rollback undoes the completed steps in reverse order. Steps that can't
+// be undone stay in the journal so that running the installer again
+// resumes after them. The journal is removed once every step is undone
+func (tx *Transaction) Rollback(steps []Step) error {
+	for _, step := range steps {
+		tx.steps[step.ID] = step
+	}
+
+	var remaining []string
+	var rollbackErr error
+	for i := len(tx.journal.Completed) - 1; i >= 0; i-- {
+		stepID := tx.journal.Completed[i]
+		step, ok := tx.steps[stepID]
+		var err error
+		if ok == false {
+			err = fmt.Errorf("Unable to undo unknown step '%s'", stepID)
+		} else if step.Undo != nil {
+			err = step.Undo(tx)
+		}
+		if err != nil {
+			remaining = append([]string{stepID}, remaining...)
+			rollbackErr = err
+			tx.report(stepID, StatusUndoFailed, err)
+			continue
+		}
+		tx.report(stepID, StatusUndone, nil)
+	}
+
+	tx.journal.Completed = remaining
+	if len(remaining) > 0 {
+		err := tx.save()
+		if err != nil {
+			return err
+		}
+		return rollbackErr
+	}
+	return tx.Commit()
+}
+
+// Commit finishes the installation by removing the journal
+func (tx *Transaction) Commit() error {
+	err := os.Remove(tx.path)
+	if err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	tx.resumed = false
+	return nil
+}
+
+// report notifies the reporter, if any
+func (tx *Transaction) report(stepID string, status string, err error) {
+	if tx.reporter != nil {
+		tx.reporter(stepID, status, err)
+	}
+}
+
+// save writes the journal to disk
+func (tx *Transaction) save() error {
+	tx.journal.Updated = time.Now()
+	journalBytes, err := json.MarshalIndent(&tx.journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The journal contains the rig ID, keep it private
+	err = ioutil.WriteFile(tx.path, journalBytes, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to write the installation journal: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// recorder records the steps done and undone and the reported statuses
+type recorder struct {
+	// calls lists "do <id>" and "undo <id>" in the order they ran
+	calls []string
+	// reports lists "<id> <status>" in the order they were reported
+	reports []string
+}
+
+// report implements Reporter
+func (rec *recorder) report(stepID string, status string, err error) {
+	rec.reports = append(rec.reports, stepID+" "+status)
+}
+
+// steps returns steps with the given IDs that are recorded. The step at
+// failAt fails, Undo fails for the steps in undoFails
+func (rec *recorder) steps(ids []string, failAt int, undoFails ...string) []Step {
+	var steps []Step
+	for i, id := range ids {
+		id, fail := id, i == failAt
+		steps = append(steps, Step{
+			ID: id,
+			Do: func(tx *Transaction) error {
+				rec.calls = append(rec.calls, "do "+id)
+				tx.SetValue(id, "value of "+id)
+				if fail {
+					return errors.New("disk full")
+				}
+				return nil
+			},
+			Undo: func(tx *Transaction) error {
+				rec.calls = append(rec.calls, "undo "+id)
+				for _, undoFail := range undoFails {
+					if undoFail == id {
+						return errors.New("access denied")
+					}
+				}
+				return nil
+			},
+		})
+	}
+	return steps
+}
+
+// readJournal reads the journal at path
+func readJournal(t *testing.T, path string) journal {
+	journalBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved journal
+	err = json.Unmarshal(journalBytes, &saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saved
+}
+
+// TestRunFailure fails every position in turn and checks that the
+// completed steps are undone in reverse order
+func TestRunFailure(t *testing.T) {
+	ids := []string{"a", "b", "c", "d"}
+	tests := []struct {
+		failAt int
+		calls  []string
+	}{
+		{
+			failAt: 0,
+			calls:  []string{"do a", "undo a"},
+		},
+		{
+			failAt: 1,
+			calls:  []string{"do a", "do b", "undo b", "undo a"},
+		},
+		{
+			failAt: 2,
+			calls:  []string{"do a", "do b", "do c", "undo c", "undo b", "undo a"},
+		},
+		{
+			failAt: 3,
+			calls:  []string{"do a", "do b", "do c", "do d", "undo d", "undo c", "undo b", "undo a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("fail at %d", test.failAt), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "transaction")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			journalPath := filepath.Join(dir, JournalFilename)
+
+			rec := recorder{}
+			tx, err := Open(journalPath, filepath.Join(dir, "mininghq"), rec.report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tx.SetInstallPath(filepath.Join(dir, "mininghq"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tx.Run(rec.steps(ids, test.failAt))
+			stepErr, ok := err.(*StepError)
+			if ok == false {
+				t.Fatalf("Expected a *StepError, got %v", err)
+			}
+			if stepErr.StepID != ids[test.failAt] || stepErr.RollbackErr != nil {
+				t.Errorf("Expected %s to fail with no rollback error, got %s", ids[test.failAt], stepErr)
+			}
+			if reflect.DeepEqual(rec.calls, test.calls) == false {
+				t.Errorf("Expected the calls %v, got %v", test.calls, rec.calls)
+			}
+			if test.failAt > 0 && rec.reports[len(rec.reports)-1] != "a "+StatusUndone {
+				t.Errorf("Expected the last report to undo a, got %v", rec.reports)
+			}
+			_, err = os.Stat(journalPath)
+			if os.IsNotExist(err) == false {
+				t.Errorf("Expected the journal to be removed after the rollback, got %v", err)
+			}
+		})
+	}
+}
+
+// TestJournal checks that the journal is written after every step
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journalPath := filepath.Join(dir, JournalFilename)
+	installPath := filepath.Join(dir, "mininghq")
+
+	tx, err := Open(journalPath, installPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Resumed() {
+		t.Error("Expected a new installation not to be resumed")
+	}
+	_, err = os.Stat(journalPath)
+	if os.IsNotExist(err) == false {
+		t.Fatalf("Expected no journal before the installation directory is set, got %v", err)
+	}
+	err = tx.SetInstallPath(installPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := recorder{}
+	steps := rec.steps([]string{"a", "b", "c"}, -1)
+	// Check what an interruption before b would leave behind
+	do := steps[1].Do
+	steps[1].Do = func(tx *Transaction) error {
+		saved := readJournal(t, journalPath)
+		if saved.InstallPath != installPath {
+			t.Errorf("Expected the install path '%s', got '%s'", installPath, saved.InstallPath)
+		}
+		if reflect.DeepEqual(saved.Completed, []string{"a"}) == false {
+			t.Errorf("Expected a to be completed, got %v", saved.Completed)
+		}
+		if saved.Values["a"] != "value of a" {
+			t.Errorf("Expected the value of a to be saved, got %v", saved.Values)
+		}
+		return do(tx)
+	}
+	err = tx.Run(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := readJournal(t, journalPath)
+	if reflect.DeepEqual(saved.Completed, []string{"a", "b", "c"}) == false {
+		t.Errorf("Expected every step to be completed, got %v", saved.Completed)
+	}
+	info, err := os.Stat(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Separator == '/' && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the journal to be private, got %s", info.Mode())
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(journalPath)
+	if os.IsNotExist(err) == false {
+		t.Errorf("Expected the journal to be removed by Commit, got %v", err)
+	}
+}
+
+// TestResume opens the journal of an interrupted installation
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		failAt  int
+		calls   []string
+		reports []string
+	}{
+		{
+			name:    "completes",
+			failAt:  -1,
+			calls:   []string{"do c", "do d"},
+			reports: []string{"a resumed", "b resumed", "c started", "c done", "d started", "d done"},
+		},
+		{
+			name:   "fails",
+			failAt: 3,
+			calls:  []string{"do c", "do d", "undo d", "undo c", "undo b", "undo a"},
+			reports: []string{
+				"a resumed", "b resumed", "c started", "c done", "d started", "d failed",
+				"c undone", "b undone", "a undone",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "transaction")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			journalPath := filepath.Join(dir, JournalFilename)
+			installPath := filepath.Join(dir, "mininghq")
+			err = ioutil.WriteFile(journalPath, []byte(`{
+  "install_path": "`+filepath.ToSlash(installPath)+`",
+  "completed": ["a", "b"],
+  "values": {"a": "value of a"}
+}`), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := recorder{}
+			tx, err := Open(journalPath, filepath.Join(dir, "elsewhere"), rec.report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.Resumed() == false {
+				t.Error("Expected the installation to be resumed")
+			}
+			if tx.InstallPath() != filepath.ToSlash(installPath) {
+				t.Errorf("Expected the install path of the journal, got '%s'", tx.InstallPath())
+			}
+			if tx.Value("a") != "value of a" {
+				t.Errorf("Expected the values of the journal, got '%s'", tx.Value("a"))
+			}
+			err = tx.SetInstallPath(filepath.Join(dir, "elsewhere"))
+			if err == nil {
+				t.Error("Expected changing the install path of completed steps to fail")
+			}
+
+			err = tx.Run(rec.steps([]string{"a", "b", "c", "d"}, test.failAt))
+			if test.failAt == -1 && err != nil {
+				t.Fatal(err)
+			}
+			if test.failAt != -1 && err == nil {
+				t.Fatal("Expected the installation to fail")
+			}
+			if reflect.DeepEqual(rec.calls, test.calls) == false {
+				t.Errorf("Expected the calls %v, got %v", test.calls, rec.calls)
+			}
+			if reflect.DeepEqual(rec.reports, test.reports) == false {
+				t.Errorf("Expected the reports %v, got %v", test.reports, rec.reports)
+			}
+		})
+	}
+}
+
+// TestRollbackFailure checks that steps that can't be undone stay in the
+// journal
+func TestRollbackFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journalPath := filepath.Join(dir, JournalFilename)
+
+	rec := recorder{}
+	tx, err := Open(journalPath, "", rec.report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.SetInstallPath(filepath.Join(dir, "mininghq"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"a", "b", "c"}
+	err = tx.Run(rec.steps(ids, 2, "a"))
+	stepErr, ok := err.(*StepError)
+	if ok == false || stepErr.RollbackErr == nil {
+		t.Fatalf("Expected a *StepError with a rollback error, got %v", err)
+	}
+	saved := readJournal(t, journalPath)
+	if reflect.DeepEqual(saved.Completed, []string{"a"}) == false {
+		t.Errorf("Expected a to stay in the journal, got %v", saved.Completed)
+	}
+
+	// Running the rollback again finishes it
+	rec = recorder{}
+	tx, err = Open(journalPath, "", rec.report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Rollback(rec.steps(ids, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(rec.calls, []string{"undo a"}) == false {
+		t.Errorf("Expected only a to be undone, got %v", rec.calls)
+	}
+	_, err = os.Stat(journalPath)
+	if os.IsNotExist(err) == false {
+		t.Errorf("Expected the journal to be removed after the rollback, got %v", err)
+	}
+}
+
+// TestOpenMalformed checks that a damaged journal isn't treated as a new
+// installation
+func TestOpenMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal string
+	}{
+		{
+			name:    "not JSON",
+			journal: `{"completed": [`,
+		},
+		{
+			name:    "no install path",
+			journal: `{"completed": ["a"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "transaction")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			journalPath := filepath.Join(dir, JournalFilename)
+			err = ioutil.WriteFile(journalPath, []byte(test.journal), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Open(journalPath, filepath.Join(dir, "mininghq"), nil)
+			if err == nil {
+				t.Error("Expected opening the journal to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package install
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/miner/helper/state"
+)
+
+const (
+	// ModeUpgrade replaces the installed components that differ from the
+	// package
+	ModeUpgrade = "upgrade"
+	// ModeRepair replaces every installed component
+	ModeRepair = "repair"
+)
+
+// IDs of the upgrade steps, in the order they run
+const (
+	// StepStopServices stops the running services so that their files can
+	// be replaced
+	StepStopServices = "stop_services"
+	// StepRepairDirectories re-creates missing installation directories
+	StepRepairDirectories = "repair_directories"
+	// StepRepairConfig re-creates a missing mining key, rig ID or manager
+	// API token file
+	StepRepairConfig = "repair_config"
+	// StepReplaceComponents replaces the installed components
+	StepReplaceComponents = "replace_components"
+	// StepUpdateRecord saves the upgraded installation record
+	StepUpdateRecord = "update_record"
+)
+
+// stagedSuffix is appended to components copied next to the installed
+// component before they replace it
+const stagedSuffix = ".new"
+
+// backupSuffix is appended to the installed components while they are
+// replaced, they are restored if the upgrade fails
+const backupSuffix = ".old"
+
+// UpgradeResult describes what an upgrade or repair changed
+type UpgradeResult struct {
+	// FromVersion is the version that was installed
+	FromVersion string
+	// ToVersion is the version installed now
+	ToVersion string
+	// Terminated lists the PIDs of the stopped services
+	Terminated []int
+	// ServicesStopped is set once the services were stopped, they must be
+	// started again whether the upgrade succeeded or not
+	ServicesStopped bool
+	// Replaced lists the components that were replaced
+	Replaced []string
+	// Unchanged lists the components that matched the package
+	Unchanged []string
+	// RecreatedConfig lists the config files that were missing
+	RecreatedConfig []string
+}
+
+// Upgrade upgrades or repairs the installation described by record with
+// the files of the package. The rig keeps its registration, the existing
+// rig ID and mining key files are never replaced. Components are staged
+// next to the installed files first and only replace them once every
+// component was staged. If replacing them or saving the record fails, the
+// installed components are restored.
+//
+// The services are left stopped, the caller must start them again when
+// ServicesStopped is set, even if a *StepError is returned
+func Upgrade(
+	installation *Installation,
+	record *state.Record,
+	mode string,
+	reporter Reporter) (*UpgradeResult, error) {
+
+	if mode != ModeUpgrade && mode != ModeRepair {
+		return nil, fmt.Errorf("Mode may only be '%s' or '%s'", ModeUpgrade, ModeRepair)
+	}
+	report := func(stepID string, status string, err error) {
+		if reporter != nil {
+			reporter(stepID, status, err)
+		}
+	}
+	fail := func(stepID string, err error) error {
+		report(stepID, StatusFailed, err)
+		return &StepError{
+			StepID: stepID,
+			Err:    err,
+		}
+	}
+	// restore puts back the components replaced so far after stepID failed
+	restore := func(stepID string, err error, components []string) error {
+		report(stepID, StatusFailed, err)
+		stepErr := StepError{
+			StepID: stepID,
+			Err:    err,
+		}
+		restoreErr := restoreComponents(record.InstallPath, components)
+		if restoreErr != nil {
+			report(StepReplaceComponents, StatusUndoFailed, restoreErr)
+			stepErr.RollbackErr = restoreErr
+		} else {
+			report(StepReplaceComponents, StatusUndone, nil)
+		}
+		return &stepErr
+	}
+
+	result := UpgradeResult{
+		FromVersion: record.Version,
+		ToVersion:   helper.Version,
+	}
+
+	report(StepStopServices, StatusStarted, nil)
+	terminated, _, killErr := helper.StopServices()
+	result.Terminated = terminated
+	if killErr != nil {
+		return &result, fail(StepStopServices, killErr)
+	}
+	result.ServicesStopped = true
+	report(StepStopServices, StatusDone, nil)
+
+	report(StepRepairDirectories, StatusStarted, nil)
+	_, err := helper.CreateInstallDirectories(record.InstallPath)
+	if err != nil {
+		return &result, fail(StepRepairDirectories, err)
+	}
+	report(StepRepairDirectories, StatusDone, nil)
+
+	report(StepRepairConfig, StatusStarted, nil)
+	result.RecreatedConfig, err = repairConfig(installation, record)
+	if err != nil {
+		return &result, fail(StepRepairConfig, err)
+	}
+	report(StepRepairConfig, StatusDone, nil)
+
+	report(StepReplaceComponents, StatusStarted, nil)
+	replaced, unchanged, err := replaceComponents(installation, record, mode)
+	result.Unchanged = unchanged
+	if err != nil {
+		return &result, restore(StepReplaceComponents, err, replaced)
+	}
+	report(StepReplaceComponents, StatusDone, nil)
+
+	report(StepUpdateRecord, StatusStarted, nil)
+	version := record.Version
+	components := record.Components
+	record.Version = helper.Version
+	record.Components = append([]string{}, installation.Files...)
+	if installation.ManagerName != "" {
+		record.Components = append(record.Components, installation.ManagerName)
+	}
+	err = record.Save()
+	if err != nil {
+		record.Version = version
+		record.Components = components
+		return &result, restore(StepUpdateRecord, err, replaced)
+	}
+	report(StepUpdateRecord, StatusDone, nil)
+
+	result.Replaced = replaced
+	removeBackups(record.InstallPath, replaced)
+	return &result, nil
+}
+
+// repairConfig re-creates the mining key, rig ID and manager API token
+// files if they are missing. Existing files are kept so that the rig isn't
+// registered again and clients keep their token
+func repairConfig(installation *Installation, record *state.Record) ([]string, error) {
+	miningKeyPath := filepath.Join(record.InstallPath, "miner-controller", "mining_key")
+	rigIDPath := filepath.Join(record.InstallPath, "miner-controller", "rig_id")
+	tokenPath := managerapi.TokenPath(record.InstallPath)
+
+	var recreated []string
+	// Installations from before the manager API required a token get one
+	if _, err := os.Stat(tokenPath); os.IsNotExist(err) {
+		err = managerapi.GenerateToken(record.InstallPath)
+		if err != nil {
+			return recreated, err
+		}
+		recreated = append(recreated, tokenPath)
+	}
+	if _, err := os.Stat(miningKeyPath); os.IsNotExist(err) {
+		if installation.MiningKey == "" {
+			return recreated, errors.New("The mining key file is missing and no mining key was given")
+		}
+		err = writeFile(miningKeyPath, []byte(installation.MiningKey), 0644)
+		if err != nil {
+			return recreated, err
+		}
+		recreated = append(recreated, miningKeyPath)
+	}
+
+	rigIDBytes, err := ioutil.ReadFile(rigIDPath)
+	if err != nil && os.IsNotExist(err) == false {
+		return recreated, err
+	}
+	if err == nil {
+		// Installations migrated from ~/.mhqpath may not have recorded the
+		// rig ID yet
+		if record.RigID == "" {
+			record.RigID = strings.TrimSpace(string(rigIDBytes))
+		}
+		return recreated, nil
+	}
+	if record.RigID == "" {
+		return recreated, errors.New(
+			"The rig ID file is missing and the installation record has no rig ID, MiningHQ must be reinstalled")
+	}
+	err = writeFile(rigIDPath, []byte(record.RigID), 0644)
+	if err != nil {
+		return recreated, err
+	}
+	recreated = append(recreated, rigIDPath)
+	return recreated, nil
+}
+
+// replaceComponents replaces the installed components with those of the
+// package. In ModeUpgrade, components identical to the package are kept.
+// The replaced components are backed up, see restoreComponents. If a
+// component can't be replaced, the components moved so far are returned
+// with the error so that they can be restored
+func replaceComponents(
+	installation *Installation,
+	record *state.Record,
+	mode string) ([]string, []string, error) {
+
+	// Maps the installed component to its replacement
+	sources := make(map[string]string)
+	var components []string
+	for _, filename := range installation.Files {
+		sources[filename] = filepath.Join(installation.ToolsPath, filename)
+		components = append(components, filename)
+	}
+	// The Miner Manager can only be replaced when the upgrade isn't run by
+	// the installed manager itself
+	if installation.ManagerName != "" && installation.ManagerPath != "" {
+		managerPath := filepath.Join(record.InstallPath, installation.ManagerName)
+		if samePath(installation.ManagerPath, managerPath) == false {
+			sources[installation.ManagerName] = installation.ManagerPath
+			components = append(components, installation.ManagerName)
+		}
+	}
+
+	var replace []string
+	var unchanged []string
+	for _, component := range components {
+		if mode == ModeUpgrade {
+			same, err := sameContents(sources[component], filepath.Join(record.InstallPath, component))
+			if err != nil {
+				return nil, nil, err
+			}
+			if same {
+				unchanged = append(unchanged, component)
+				continue
+			}
+		}
+		replace = append(replace, component)
+	}
+
+	// Every component is staged before any is replaced, a package missing
+	// a component leaves the installation untouched
+	var staged []string
+	removeStaged := func() {
+		for _, stagedPath := range staged {
+			os.Remove(stagedPath)
+		}
+	}
+	for _, component := range replace {
+		stagedPath := filepath.Join(record.InstallPath, component) + stagedSuffix
+		// A previous upgrade may have left a read-only staged file behind
+		err := removeFiles(stagedPath)
+		if err == nil {
+			err = helper.CopyFile(sources[component], stagedPath)
+		}
+		if err != nil {
+			removeStaged()
+			return nil, unchanged, fmt.Errorf("Unable to stage '%s': %s", component, err)
+		}
+		staged = append(staged, stagedPath)
+	}
+
+	var replaced []string
+	for _, component := range replace {
+		installedPath := filepath.Join(record.InstallPath, component)
+		// A backup left by a previous upgrade is stale, without it a
+		// component that wasn't installed is removed when restoring
+		err := removeFiles(installedPath + backupSuffix)
+		if err == nil {
+			err = os.Rename(installedPath, installedPath+backupSuffix)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err == nil {
+			replaced = append(replaced, component)
+			err = os.Rename(installedPath+stagedSuffix, installedPath)
+		}
+		if err != nil {
+			removeStaged()
+			return replaced, unchanged, fmt.Errorf("Unable to replace '%s': %s", component, err)
+		}
+	}
+	return replaced, unchanged, nil
+}
+
+// restoreComponents puts back the components backed up by
+// replaceComponents. Components without a backup weren't installed before
+// and are removed
+func restoreComponents(installPath string, components []string) error {
+	var restoreErr error
+	for _, component := range components {
+		installedPath := filepath.Join(installPath, component)
+		backupPath := installedPath + backupSuffix
+		err := removeFiles(installedPath)
+		if err == nil {
+			err = os.Rename(backupPath, installedPath)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			restoreErr = fmt.Errorf("Unable to restore '%s': %s", component, err)
+		}
+	}
+	return restoreErr
+}
+
+// removeBackups removes the backups of the replaced components once the
+// upgrade completed. A backup that can't be removed is replaced by the
+// next upgrade
+func removeBackups(installPath string, components []string) {
+	for _, component := range components {
+		removeFiles(filepath.Join(installPath, component) + backupSuffix)
+	}
+}
+
+// sameContents checks if the files have the same contents. A missing
+// installed file is never the same
+func sameContents(source string, installed string) (bool, error) {
+	sourceSum, err := fileChecksum(source)
+	if err != nil {
+		return false, fmt.Errorf("The package is missing '%s': %s", source, err)
+	}
+	installedSum, err := fileChecksum(installed)
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(sourceSum, installedSum), nil
+}
+
+// fileChecksum returns the SHA-256 checksum of the file
+func fileChecksum(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// samePath checks if both paths refer to the same file
+func samePath(a string, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
@@ -0,0 +1,90 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package helper
+
+import "os"
+
+// LogTail finds the log lines that are new since the logs were last read.
+//
+// The miner controller only returns the latest lines of every miner, new
+// lines are found by where the latest lines overlap those read before
+type LogTail struct {
+	// seen holds the lines last read per miner
+	seen map[string][]string
+}
+
+// NewLogTail creates a new LogTail, the first lines read are all new
+func NewLogTail() *LogTail {
+	return &LogTail{
+		seen: make(map[string][]string),
+	}
+}
+
+// Next returns the lines of the miner that weren't read before. If the
+// lines don't overlap those read before, more lines were logged than were
+// read and all of them are new
+func (tail *LogTail) Next(miner string, lines []string) []string {
+	previous := tail.seen[miner]
+	tail.seen[miner] = lines
+
+	overlap := len(previous)
+	if len(lines) < overlap {
+		overlap = len(lines)
+	}
+	for ; overlap > 0; overlap-- {
+		if equalLines(previous[len(previous)-overlap:], lines[:overlap]) {
+			return lines[overlap:]
+		}
+	}
+	return lines
+}
+
+// Reset forgets the lines read, the next lines read are all new
+func (tail *LogTail) Reset() {
+	tail.seen = make(map[string][]string)
+}
+
+// equalLines checks if both slices hold the same lines
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// OpenLogFile opens the log file at path for appending. A log larger than
+// maxSize is rotated first, the previous log is kept at path + ".1"
+func OpenLogFile(path string, maxSize int64) (*os.File, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.Size() > maxSize {
+		err = os.Rename(path, path+".1")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
@@ -0,0 +1,307 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package logstore keeps the miner logs read from the miner controller as
+// structured entries, so that they can be searched, filtered and exported
+// rather than only displayed
+package logstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCapacity is the number of entries kept, older entries are dropped
+const DefaultCapacity = 20000
+
+// Levels of log entries, from least to most severe
+const (
+	// LevelDebug is for lines that only help debugging
+	LevelDebug = "debug"
+	// LevelInfo is for lines without a severity
+	LevelInfo = "info"
+	// LevelWarning is for lines about problems the miner recovers from
+	LevelWarning = "warning"
+	// LevelError is for lines about errors
+	LevelError = "error"
+)
+
+// Formats entries can be exported as
+const (
+	// FormatText exports one line per entry
+	FormatText = "text"
+	// FormatJSON exports the entries as a JSON array, with the lines as
+	// they were logged
+	FormatJSON = "json"
+)
+
+// levelOrder ranks the levels by severity
+var levelOrder = map[string]int{
+	LevelDebug:   0,
+	LevelInfo:    1,
+	LevelWarning: 2,
+	LevelError:   3,
+}
+
+var (
+	// ansiCodes matches the terminal colour codes miners log with
+	ansiCodes = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+	// errorWords mark lines as errors
+	errorWords = regexp.MustCompile(`(?i)\b(error|err|fatal|panic|failed|failure|exception)\b`)
+	// warningWords mark lines as warnings
+	warningWords = regexp.MustCompile(`(?i)\b(warn|warning|rejected|retry|retrying|timeout|timed out)\b`)
+	// debugWords mark lines as debug output
+	debugWords = regexp.MustCompile(`(?i)\b(debug|trace)\b`)
+	// lineTime matches the timestamp most miners start their lines with,
+	// ie. '[2018-06-01 12:00:00]'
+	lineTime = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2})`)
+)
+
+// Entry is a single line logged by a miner
+type Entry struct {
+	// ID orders the entries, it increases with every entry added
+	ID int64 `json:"id"`
+	// Miner is the key of the miner that logged the line
+	Miner string `json:"miner"`
+	// Time is when the line was logged, or read if the line has no
+	// timestamp
+	Time time.Time `json:"time"`
+	// Level is the severity of the line, one of the Level values
+	Level string `json:"level"`
+	// Text is the line without terminal colour codes
+	Text string `json:"text"`
+	// Raw is the line as it was logged, including terminal colour codes
+	Raw string `json:"raw"`
+}
+
+// Query selects entries, the zero value selects every entry
+type Query struct {
+	// Miner only selects the entries of this miner
+	Miner string `json:"miner,omitempty"`
+	// Level only selects entries of this level or more severe
+	Level string `json:"level,omitempty"`
+	// Text only selects entries containing this text, ignoring case
+	Text string `json:"text,omitempty"`
+	// Since only selects entries logged at or after this time
+	Since time.Time `json:"since"`
+	// Until only selects entries logged before this time
+	Until time.Time `json:"until"`
+	// AfterID only selects entries added after the entry with this ID
+	AfterID int64 `json:"after_id,omitempty"`
+	// Limit only selects the latest entries up to this number
+	Limit int `json:"limit,omitempty"`
+}
+
+// Validate checks that the query can be used to search
+func (query *Query) Validate() error {
+	query.Level = strings.ToLower(strings.TrimSpace(query.Level))
+	if _, ok := levelOrder[query.Level]; query.Level != "" && ok == false {
+		return fmt.Errorf(
+			"The log level '%s' is invalid, it must be '%s', '%s', '%s' or '%s'",
+			query.Level,
+			LevelDebug,
+			LevelInfo,
+			LevelWarning,
+			LevelError)
+	}
+	if query.Limit < 0 {
+		return fmt.Errorf("The log limit '%d' is invalid, it must be 0 or more", query.Limit)
+	}
+	if query.Until.IsZero() == false && query.Until.Before(query.Since) {
+		return fmt.Errorf(
+			"The log range is invalid, '%s' is before '%s'",
+			query.Until.Format(time.RFC3339),
+			query.Since.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Matches checks if the entry is selected by the query, Limit is ignored
+func (query *Query) Matches(entry Entry) bool {
+	if entry.ID <= query.AfterID {
+		return false
+	}
+	if query.Miner != "" && entry.Miner != query.Miner {
+		return false
+	}
+	if query.Level != "" && levelOrder[entry.Level] < levelOrder[query.Level] {
+		return false
+	}
+	if query.Since.IsZero() == false && entry.Time.Before(query.Since) {
+		return false
+	}
+	if query.Until.IsZero() == false && entry.Time.Before(query.Until) == false {
+		return false
+	}
+	if query.Text != "" && strings.Contains(strings.ToLower(entry.Text), strings.ToLower(query.Text)) == false {
+		return false
+	}
+	return true
+}
+
+// Store keeps the latest entries in memory, it is safe for concurrent use
+type Store struct {
+	// mutex guards the fields below
+	mutex sync.Mutex
+	// capacity is the number of entries kept
+	capacity int
+	// entries holds the entries, oldest first
+	entries []Entry
+	// lastID is the ID of the last entry added
+	lastID int64
+	// miners holds the keys of the miners that logged entries
+	miners map[string]bool
+}
+
+// New creates a store that keeps the latest capacity entries
+func New(capacity int) *Store {
+	if capacity < 1 {
+		capacity = DefaultCapacity
+	}
+	return &Store{
+		capacity: capacity,
+		miners:   make(map[string]bool),
+	}
+}
+
+// Add adds the lines logged by the miner, read at the given time, and
+// returns the entries created for them
+func (store *Store) Add(miner string, lines []string, read time.Time) []Entry {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	added := make([]Entry, 0, len(lines))
+	for _, line := range lines {
+		store.lastID++
+		text := ansiCodes.ReplaceAllString(line, "")
+		added = append(added, Entry{
+			ID:    store.lastID,
+			Miner: miner,
+			Time:  ParseTime(text, read),
+			Level: ParseLevel(text),
+			Text:  text,
+			Raw:   line,
+		})
+	}
+	store.miners[miner] = true
+
+	store.entries = append(store.entries, added...)
+	if len(store.entries) > store.capacity {
+		// Copied so that the dropped entries can be freed
+		store.entries = append([]Entry{}, store.entries[len(store.entries)-store.capacity:]...)
+	}
+	return added
+}
+
+// Search returns the entries selected by the query, oldest first
+func (store *Store) Search(query Query) ([]Entry, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var found []Entry
+	for _, entry := range store.entries {
+		if query.Matches(entry) {
+			found = append(found, entry)
+		}
+	}
+	if query.Limit > 0 && len(found) > query.Limit {
+		found = found[len(found)-query.Limit:]
+	}
+	return found, nil
+}
+
+// Miners returns the keys of the miners that logged entries, sorted
+func (store *Store) Miners() []string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	miners := make([]string, 0, len(store.miners))
+	for miner := range store.miners {
+		miners = append(miners, miner)
+	}
+	sort.Strings(miners)
+	return miners
+}
+
+// ParseLevel returns the level of the line from the words it contains
+func ParseLevel(line string) string {
+	switch {
+	case errorWords.MatchString(line):
+		return LevelError
+	case warningWords.MatchString(line):
+		return LevelWarning
+	case debugWords.MatchString(line):
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+// ParseTime returns the local time the line starts with, or read if it
+// has none
+func ParseTime(line string, read time.Time) time.Time {
+	match := lineTime.FindStringSubmatch(line)
+	if match == nil {
+		return read
+	}
+	logged, err := time.ParseInLocation("2006-01-02 15:04:05", strings.Replace(match[1], "T", " ", 1), time.Local)
+	if err != nil {
+		return read
+	}
+	return logged
+}
+
+// Export writes the entries to writer in the format
+func Export(writer io.Writer, entries []Entry, format string) error {
+	switch format {
+	case FormatText:
+		for _, entry := range entries {
+			_, err := fmt.Fprintf(
+				writer,
+				"%s [%s] %-7s %s\n",
+				entry.Time.Format("2006-01-02 15:04:05"),
+				entry.Miner,
+				strings.ToUpper(entry.Level),
+				entry.Text)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case FormatJSON:
+		if entries == nil {
+			entries = []Entry{}
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	return fmt.Errorf("The export format '%s' is invalid, it must be '%s' or '%s'", format, FormatText, FormatJSON)
+}
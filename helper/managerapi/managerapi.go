@@ -0,0 +1,325 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package managerapi connects to the miner controller's manager API. Every
+// installation has its own token that is presented with every request, and
+// optionally a self-signed certificate the connection is secured with. Both
+// are readable only by the user that installed MiningHQ.
+//
+// Checking the token and serving TLS is up to the miner controller, it
+// reports what it supports in its capabilities file once it is serving.
+// TLS is only used when the running controller reports it, see Capabilities
+package managerapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// TokenFilename is the file in the controller directory holding the
+	// token requests to the manager API must present
+	TokenFilename = "manager_token"
+	// CertificateFilename is the file in the controller directory holding
+	// the manager API's self-signed certificate
+	CertificateFilename = "manager.crt"
+	// KeyFilename is the file in the controller directory holding the
+	// private key of the certificate
+	KeyFilename = "manager.key"
+	// CapabilitiesFilename is the file in the controller directory the
+	// miner controller writes once its manager API is serving
+	CapabilitiesFilename = "manager_api.json"
+	// TokenMetadataKey is the gRPC metadata key the token is sent as
+	TokenMetadataKey = "authorization"
+	// UnixScheme prefixes addresses of Unix domain sockets, ie.
+	// 'unix:///opt/mininghq/miner-controller/manager.sock'
+	UnixScheme = "unix://"
+
+	// tokenBytes is the number of random bytes in a token
+	tokenBytes = 32
+	// certificateValidity is how long a generated certificate is valid
+	certificateValidity = time.Hour * 24 * 365 * 10
+)
+
+// TokenPath returns the path of the token of the installation
+func TokenPath(installPath string) string {
+	return filepath.Join(installPath, "miner-controller", TokenFilename)
+}
+
+// CertificatePath returns the path of the certificate of the installation
+func CertificatePath(installPath string) string {
+	return filepath.Join(installPath, "miner-controller", CertificateFilename)
+}
+
+// KeyPath returns the path of the certificate's private key
+func KeyPath(installPath string) string {
+	return filepath.Join(installPath, "miner-controller", KeyFilename)
+}
+
+// CapabilitiesPath returns the path of the running controller's
+// capabilities
+func CapabilitiesPath(installPath string) string {
+	return filepath.Join(installPath, "miner-controller", CapabilitiesFilename)
+}
+
+// Capabilities are the manager API security features of the running miner
+// controller. A controller that doesn't write them supports neither
+type Capabilities struct {
+	// Version is the version of the miner controller
+	Version string `json:"version"`
+	// Token is set when the controller rejects requests without the
+	// installation's token
+	Token bool `json:"token"`
+	// TLS is set when the controller serves TLS with the installation's
+	// certificate
+	TLS bool `json:"tls"`
+}
+
+// LoadCapabilities reads the capabilities of the running controller. A
+// controller that hasn't written them has no capabilities
+func LoadCapabilities(installPath string) (Capabilities, error) {
+	var capabilities Capabilities
+	capabilitiesBytes, err := ioutil.ReadFile(CapabilitiesPath(installPath))
+	if os.IsNotExist(err) {
+		return capabilities, nil
+	}
+	if err != nil {
+		return capabilities, fmt.Errorf("Unable to read the manager API capabilities: %s", err)
+	}
+	err = json.Unmarshal(capabilitiesBytes, &capabilities)
+	if err != nil {
+		return capabilities, fmt.Errorf("The manager API capabilities '%s' are malformed: %s",
+			CapabilitiesPath(installPath), err)
+	}
+	return capabilities, nil
+}
+
+// RemoveCapabilities removes the capabilities of a stopped controller, the
+// controller started next writes its own
+func RemoveCapabilities(installPath string) error {
+	err := os.Remove(CapabilitiesPath(installPath))
+	if err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	return nil
+}
+
+// GenerateToken writes a new random token for the installation, replacing
+// any existing token
+func GenerateToken(installPath string) error {
+	token := make([]byte, tokenBytes)
+	_, err := rand.Read(token)
+	if err != nil {
+		return fmt.Errorf("Unable to generate the manager API token: %s", err)
+	}
+	err = writePrivate(TokenPath(installPath), []byte(hex.EncodeToString(token)))
+	if err != nil {
+		return fmt.Errorf("Unable to write the manager API token: %s", err)
+	}
+	return nil
+}
+
+// GenerateCertificate writes a new self-signed certificate and private key
+// for the manager API, valid for localhost
+func GenerateCertificate(installPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("Unable to generate the manager API key: %s", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("Unable to generate the manager API certificate: %s", err)
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"MiningHQ"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("Unable to generate the manager API certificate: %s", err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("Unable to encode the manager API key: %s", err)
+	}
+
+	err = writePrivate(KeyPath(installPath), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}))
+	if err != nil {
+		return fmt.Errorf("Unable to write the manager API key: %s", err)
+	}
+	err = ioutil.WriteFile(
+		CertificatePath(installPath),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}),
+		0644)
+	if err != nil {
+		return fmt.Errorf("Unable to write the manager API certificate: %s", err)
+	}
+	return nil
+}
+
+// RemoveCredentials removes the token, certificate, key and controller
+// capabilities of the installation, files that don't exist are ignored
+func RemoveCredentials(installPath string) error {
+	paths := []string{
+		TokenPath(installPath),
+		CertificatePath(installPath),
+		KeyPath(installPath),
+		CapabilitiesPath(installPath),
+	}
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && os.IsNotExist(err) == false {
+			return err
+		}
+	}
+	return nil
+}
+
+// DialOptions returns the target and options to connect to the manager API
+// at address with the credentials of the installation at installPath. When
+// installPath is empty, or the installation has no token, requests are made
+// without a token. TLS is used when the running controller reports it
+// serves TLS, whether the installation has a certificate or not
+func DialOptions(installPath string, address string) (string, []grpc.DialOption, error) {
+	var options []grpc.DialOption
+	target := address
+	if strings.HasPrefix(address, UnixScheme) {
+		target = strings.TrimPrefix(address, UnixScheme)
+		if target == "" {
+			return "", nil, errors.New("The manager API socket address has no path")
+		}
+		options = append(options, grpc.WithDialer(dialUnix))
+	}
+	if installPath == "" {
+		return target, append(options, grpc.WithInsecure()), nil
+	}
+
+	tokenBytes, err := ioutil.ReadFile(TokenPath(installPath))
+	if err != nil && os.IsNotExist(err) == false {
+		return "", nil, fmt.Errorf("Unable to read the manager API token: %s", err)
+	}
+	if token := strings.TrimSpace(string(tokenBytes)); token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(tokenCredentials(token)))
+	}
+
+	capabilities, err := LoadCapabilities(installPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if capabilities.TLS == false {
+		return target, append(options, grpc.WithInsecure()), nil
+	}
+	certificate, err := ioutil.ReadFile(CertificatePath(installPath))
+	if err != nil {
+		return "", nil, fmt.Errorf("The miner controller serves TLS, but the manager API certificate can't be read: %s", err)
+	}
+	roots := x509.NewCertPool()
+	if roots.AppendCertsFromPEM(certificate) == false {
+		return "", nil, fmt.Errorf("The manager API certificate '%s' is malformed", CertificatePath(installPath))
+	}
+	options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		RootCAs:    roots,
+		ServerName: "localhost",
+	})))
+	return target, options, nil
+}
+
+// Dial connects to the manager API at address with the credentials of the
+// installation, extra options such as grpc.WithBlock are added
+func Dial(installPath string, address string, extra ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return DialContext(context.Background(), installPath, address, extra...)
+}
+
+// DialContext connects like Dial, ctx limits how long a blocking dial waits
+func DialContext(
+	ctx context.Context,
+	installPath string,
+	address string,
+	extra ...grpc.DialOption) (*grpc.ClientConn, error) {
+
+	target, options, err := DialOptions(installPath, address)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.DialContext(ctx, target, append(options, extra...)...)
+}
+
+// tokenCredentials presents the installation's token with every request
+type tokenCredentials string
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (token tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		TokenMetadataKey: "Bearer " + string(token),
+	}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials. The
+// token may be sent without TLS, the manager API only listens locally
+func (token tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// writePrivate writes a file only the current user may read
+func writePrivate(path string, contents []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// The file may have existed with wider permissions
+	err = file.Chmod(0600)
+	if err == nil {
+		_, err = file.Write(contents)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	// OutputText is the human readable, coloured output
+	OutputText = "text"
+	// OutputJSON outputs one JSON object per line for every step and
+	// a summary once done
+	OutputJSON = "json"
+)
+
+const (
+	// StepOK is the status of a step that completed
+	StepOK = "ok"
+	// StepNotice is the status of a step that had a problem that doesn't
+	// stop the process
+	StepNotice = "notice"
+	// StepFailed is the status of a step that failed
+	StepFailed = "failed"
+)
+
+// StepEvent is emitted in JSON output when a step completes
+type StepEvent struct {
+	// Type is always 'step'
+	Type string `json:"type"`
+	// Step is the ID of the step, ie. 'register_rig'
+	Step string `json:"step"`
+	// Status is one of StepOK, StepNotice or StepFailed
+	Status string `json:"status"`
+	// Message holds additional details of a completed step
+	Message string `json:"message,omitempty"`
+	// Error is the error that caused a notice or failure
+	Error string `json:"error,omitempty"`
+	// Hint tells the user how to resolve the error
+	Hint string `json:"hint,omitempty"`
+	// ElapsedMS is the time the step took in milliseconds
+	ElapsedMS int64 `json:"elapsed_ms"`
+}
+
+// SummaryEvent is emitted in JSON output once the process is done
+type SummaryEvent struct {
+	// Type is always 'summary'
+	Type string `json:"type"`
+	// Status is StepOK if the process completed, StepFailed otherwise
+	Status string `json:"status"`
+	// ExitCode is the exit code the process exits with
+	ExitCode int `json:"exit_code"`
+	// Error is the error the process failed with
+	Error string `json:"error,omitempty"`
+	// Steps counts the completed steps by status
+	Steps map[string]int `json:"steps"`
+	// FailedSteps lists the IDs of the steps that failed
+	FailedSteps []string `json:"failed_steps"`
+	// ElapsedMS is the time the process took in milliseconds
+	ElapsedMS int64 `json:"elapsed_ms"`
+}
+
+// Progress reports the progress of the installer and uninstaller steps,
+// either as the coloured OK/FAIL/NOTICE text or as JSON events
+type Progress struct {
+	// json is set when JSON events are output
+	json bool
+	// encoder writes the JSON events
+	encoder *json.Encoder
+	// out receives the text meant for the user
+	out io.Writer
+	// started is when the process started
+	started time.Time
+
+	// step is the ID of the current step
+	step string
+	// label is the text printed for the current step
+	label string
+	// stepStarted is when the current step started
+	stepStarted time.Time
+	// events holds the completed steps
+	events []StepEvent
+}
+
+// NewProgress creates a new progress reporter for the output format.
+//
+// In JSON mode stdout is reserved for the events. The text meant for the
+// user, including prompts, must be written to Output instead
+func NewProgress(output string) (*Progress, error) {
+	progress := Progress{
+		started: time.Now(),
+		out:     os.Stdout,
+	}
+	switch strings.ToLower(strings.TrimSpace(output)) {
+	case "", OutputText:
+	case OutputJSON:
+		progress.json = true
+		progress.encoder = json.NewEncoder(os.Stdout)
+		progress.out = os.Stderr
+	default:
+		return nil, fmt.Errorf("Output may only be '%s' or '%s'", OutputText, OutputJSON)
+	}
+	return &progress, nil
+}
+
+// JSON returns true if JSON events are output
+func (progress *Progress) JSON() bool {
+	return progress.json
+}
+
+// Output returns the writer for the text meant for the user, stdout in
+// text mode and stderr in JSON mode
+func (progress *Progress) Output() io.Writer {
+	return progress.out
+}
+
+// Start starts a new step. The label is printed in text mode, a step
+// without a label is only reported in JSON mode
+func (progress *Progress) Start(step string, label string) {
+	progress.step = step
+	progress.label = label
+	progress.stepStarted = time.Now()
+	if progress.json == false && label != "" {
+		fmt.Fprint(progress.out, label)
+	}
+}
+
+// OK completes the current step, message is optional
+func (progress *Progress) OK(message string) {
+	if progress.json == false && progress.label != "" {
+		color.New(color.FgHiGreen).Fprintln(progress.out, "OK")
+		if message != "" {
+			fmt.Fprintln(progress.out, message)
+		}
+	}
+	progress.complete(StepOK, message, nil, "")
+}
+
+// Notice completes the current step with a problem that doesn't stop the
+// process. The hint tells the user how to resolve it
+func (progress *Progress) Notice(err error, hint string) {
+	if progress.json == false {
+		if progress.label != "" {
+			color.New(color.FgHiYellow).Fprintln(progress.out, "NOTICE")
+		}
+		fmt.Fprintln(progress.out, hint)
+		color.New(color.FgHiYellow).Fprintf(progress.out, "Include the following error in your report '%s'", err.Error())
+		fmt.Fprintln(progress.out)
+		fmt.Fprintln(progress.out)
+	}
+	progress.complete(StepNotice, "", err, hint)
+}
+
+// diagnosticsHint tells the user how to collect the details support needs
+const diagnosticsHint = `Please attach a diagnostics bundle to your report, run the installer with
+the 'diagnostics' command or use Diagnostics in the Miner Manager to create one.`
+
+// Fail completes the current step with an error. The hint tells the user
+// how to resolve it
+func (progress *Progress) Fail(err error, hint string) {
+	if progress.json == false {
+		if progress.label != "" {
+			color.New(color.FgHiRed).Fprintln(progress.out, "FAIL")
+		}
+		fmt.Fprintln(progress.out, hint)
+		color.New(color.FgHiRed).Fprintf(progress.out, "Include the following error in your report '%s'", err.Error())
+		fmt.Fprintln(progress.out)
+		fmt.Fprintln(progress.out, diagnosticsHint)
+		fmt.Fprintln(progress.out)
+	}
+	progress.complete(StepFailed, "", err, hint)
+}
+
+// Finish outputs the summary in JSON mode, text mode has its own
+// closing messages
+func (progress *Progress) Finish(exitCode int, err error) {
+	if progress.json == false {
+		return
+	}
+
+	summary := SummaryEvent{
+		Type:        "summary",
+		Status:      StepOK,
+		ExitCode:    exitCode,
+		Steps:       map[string]int{StepOK: 0, StepNotice: 0, StepFailed: 0},
+		FailedSteps: []string{},
+		ElapsedMS:   time.Since(progress.started).Nanoseconds() / int64(time.Millisecond),
+	}
+	if err != nil || exitCode != 0 {
+		summary.Status = StepFailed
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	for _, event := range progress.events {
+		summary.Steps[event.Status]++
+		if event.Status == StepFailed {
+			summary.FailedSteps = append(summary.FailedSteps, event.Step)
+		}
+	}
+	progress.encoder.Encode(&summary)
+}
+
+// complete records the current step and outputs it in JSON mode
+func (progress *Progress) complete(status string, message string, err error, hint string) {
+	event := StepEvent{
+		Type:      "step",
+		Step:      progress.step,
+		Status:    status,
+		Message:   message,
+		Hint:      strings.TrimSpace(hint),
+		ElapsedMS: time.Since(progress.stepStarted).Nanoseconds() / int64(time.Millisecond),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	progress.events = append(progress.events, event)
+	if progress.json {
+		progress.encoder.Encode(&event)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package schedule implements the weekly mining timetable of a rig. The
+// schedule is kept in the installation directory so that the miner service
+// applies it without the manager running, and the manager can edit it
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Filename is the schedule file in the installation directory
+const Filename = "mining-schedule.json"
+
+// Actions a schedule applies
+const (
+	// ActionMine resumes mining
+	ActionMine = "mine"
+	// ActionPause pauses mining
+	ActionPause = "pause"
+)
+
+// days are the names of the days in schedules, indexed by time.Weekday
+var days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Rule applies an action between two times of the day on the given days
+type Rule struct {
+	// Days the rule starts on, ie. 'mon' or 'sat'. Every day when empty
+	Days []string `json:"days"`
+	// Start is the time of day the rule starts, ie. '08:00'
+	Start string `json:"start"`
+	// End is the time of day the rule ends. An end before the start ends
+	// the next day, ie. '22:00' to '06:00' for overnight rules, an end at
+	// the start runs for a full day
+	End string `json:"end"`
+	// Action is ActionMine or ActionPause
+	Action string `json:"action"`
+}
+
+// Schedule is the weekly mining timetable of a rig
+type Schedule struct {
+	// Enabled applies the schedule, mining is only paused and resumed
+	// manually when it is disabled
+	Enabled bool `json:"enabled"`
+	// Default is the action outside of the rules
+	Default string `json:"default"`
+	// Rules are checked in order, the first rule that applies is used
+	Rules []Rule `json:"rules"`
+}
+
+// Load reads the schedule from path. A missing file is a disabled schedule
+func Load(path string) (Schedule, error) {
+	schedule := Schedule{
+		Default: ActionMine,
+		Rules:   []Rule{},
+	}
+	scheduleBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return schedule, nil
+	}
+	if err != nil {
+		return schedule, fmt.Errorf("Unable to read the mining schedule '%s': %s", path, err)
+	}
+	err = json.Unmarshal(scheduleBytes, &schedule)
+	if err != nil {
+		return schedule, fmt.Errorf("The mining schedule '%s' is malformed: %s", path, err)
+	}
+	return schedule, schedule.Validate()
+}
+
+// Save validates the schedule and writes it to path
+func (schedule *Schedule) Save(path string) error {
+	err := schedule.Validate()
+	if err != nil {
+		return err
+	}
+	scheduleBytes, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The service reads the schedule while it is written, it is replaced
+	// at once
+	err = ioutil.WriteFile(path+".tmp", scheduleBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to save the mining schedule: %s", err)
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return fmt.Errorf("Unable to save the mining schedule: %s", err)
+	}
+	return nil
+}
+
+// Validate checks the schedule, the days of the rules are normalised to
+// lowercase
+func (schedule *Schedule) Validate() error {
+	if schedule.Default == "" {
+		schedule.Default = ActionMine
+	}
+	if validAction(schedule.Default) == false {
+		return fmt.Errorf("The default action '%s' is invalid, it must be '%s' or '%s'",
+			schedule.Default, ActionMine, ActionPause)
+	}
+	for i := range schedule.Rules {
+		rule := &schedule.Rules[i]
+		for j, day := range rule.Days {
+			rule.Days[j] = strings.ToLower(strings.TrimSpace(day))
+			if dayIndex(rule.Days[j]) < 0 {
+				return fmt.Errorf("Rule %d has an invalid day '%s', use one of %s",
+					i+1, day, strings.Join(days, ", "))
+			}
+		}
+		_, err := parseTimeOfDay(rule.Start)
+		if err != nil {
+			return fmt.Errorf("Rule %d has an invalid start: %s", i+1, err)
+		}
+		_, err = parseTimeOfDay(rule.End)
+		if err != nil {
+			return fmt.Errorf("Rule %d has an invalid end: %s", i+1, err)
+		}
+		if validAction(rule.Action) == false {
+			return fmt.Errorf("Rule %d has an invalid action '%s', it must be '%s' or '%s'",
+				i+1, rule.Action, ActionMine, ActionPause)
+		}
+	}
+	return nil
+}
+
+// ActionAt returns the action of the schedule at t and the rule it comes
+// from, nil for the default action
+func (schedule *Schedule) ActionAt(t time.Time) (string, *Rule) {
+	for i := range schedule.Rules {
+		if schedule.Rules[i].applies(t) {
+			return schedule.Rules[i].Action, &schedule.Rules[i]
+		}
+	}
+	return schedule.Default, nil
+}
+
+// NextChange returns when the action of the schedule next changes after t
+// and the action from then. The zero time is returned if it never changes
+func (schedule *Schedule) NextChange(t time.Time) (time.Time, string) {
+	current, _ := schedule.ActionAt(t)
+	// Rules change on the minute, a week covers every rule
+	next := t.Truncate(time.Minute)
+	for i := 0; i < 7*24*60; i++ {
+		next = next.Add(time.Minute)
+		action, _ := schedule.ActionAt(next)
+		if action != current {
+			return next, action
+		}
+	}
+	return time.Time{}, current
+}
+
+// applies checks if the rule applies at t
+func (rule *Rule) applies(t time.Time) bool {
+	// Rules are validated before they are used
+	start, _ := parseTimeOfDay(rule.Start)
+	end, _ := parseTimeOfDay(rule.End)
+	minute := t.Hour()*60 + t.Minute()
+	weekday := int(t.Weekday())
+
+	if start < end {
+		return rule.onDay(weekday) && minute >= start && minute < end
+	}
+	// The rule ends the day after it starts, a rule ending when it starts
+	// runs for a full day
+	if minute >= start {
+		return rule.onDay(weekday)
+	}
+	return minute < end && rule.onDay((weekday+6)%7)
+}
+
+// onDay checks if the rule starts on the weekday
+func (rule *Rule) onDay(weekday int) bool {
+	if len(rule.Days) == 0 {
+		return true
+	}
+	for _, day := range rule.Days {
+		if dayIndex(day) == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeOfDay parses a time of day such as '08:00' into minutes after
+// midnight
+func parseTimeOfDay(value string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time of day such as '08:00'", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// dayIndex returns the weekday of the day name, -1 if it is invalid
+func dayIndex(day string) int {
+	for i, name := range days {
+		if name == day {
+			return i
+		}
+	}
+	return -1
+}
+
+// validAction checks if the action is known
+func validAction(action string) bool {
+	return action == ActionMine || action == ActionPause
+}
@@ -0,0 +1,167 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns the time on the weekday of the week from Monday 2 March 2020
+// to Sunday 8 March 2020
+func at(weekday time.Weekday, hour int, minute int) time.Time {
+	day := 2 + (int(weekday)+6)%7
+	return time.Date(2020, time.March, day, hour, minute, 0, 0, time.UTC)
+}
+
+// pauseRule pauses mining from start to end on the days
+func pauseRule(start string, end string, days ...string) Rule {
+	return Rule{
+		Days:   days,
+		Start:  start,
+		End:    end,
+		Action: ActionPause,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		valid bool
+	}{
+		{name: "daytime", rule: pauseRule("08:00", "18:00", "mon"), valid: true},
+		{name: "overnight", rule: pauseRule("22:00", "06:00"), valid: true},
+		{name: "full day", rule: pauseRule("00:00", "00:00", "sat"), valid: true},
+		{name: "day from the morning", rule: pauseRule("08:00", "08:00", "mon"), valid: true},
+		{name: "uppercase day", rule: pauseRule("08:00", "18:00", "MON"), valid: true},
+		{name: "invalid day", rule: pauseRule("08:00", "18:00", "monday"), valid: false},
+		{name: "invalid start", rule: pauseRule("25:00", "18:00"), valid: false},
+		{name: "invalid end", rule: pauseRule("08:00", "6pm"), valid: false},
+		{name: "invalid action", rule: Rule{Start: "08:00", End: "18:00", Action: "stop"}, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := Schedule{
+				Enabled: true,
+				Rules:   []Rule{test.rule},
+			}
+			err := schedule.Validate()
+			if test.valid && err != nil {
+				t.Errorf("Expected the rule to be valid: %s", err)
+			}
+			if test.valid == false && err == nil {
+				t.Error("Expected the rule to be invalid")
+			}
+		})
+	}
+}
+
+func TestActionAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []Rule
+		at       time.Time
+		expected string
+	}{
+		{name: "before overnight", rules: []Rule{pauseRule("22:00", "06:00")}, at: at(time.Monday, 21, 59), expected: ActionMine},
+		{name: "overnight start", rules: []Rule{pauseRule("22:00", "06:00")}, at: at(time.Monday, 22, 0), expected: ActionPause},
+		{name: "overnight after midnight", rules: []Rule{pauseRule("22:00", "06:00")}, at: at(time.Tuesday, 5, 59), expected: ActionPause},
+		{name: "overnight end", rules: []Rule{pauseRule("22:00", "06:00")}, at: at(time.Tuesday, 6, 0), expected: ActionMine},
+		{name: "overnight on its day", rules: []Rule{pauseRule("22:00", "06:00", "fri")}, at: at(time.Friday, 23, 0), expected: ActionPause},
+		{name: "overnight into the next day", rules: []Rule{pauseRule("22:00", "06:00", "fri")}, at: at(time.Saturday, 3, 0), expected: ActionPause},
+		{name: "overnight not started the day before", rules: []Rule{pauseRule("22:00", "06:00", "fri")}, at: at(time.Friday, 3, 0), expected: ActionMine},
+		{name: "overnight not on the next day", rules: []Rule{pauseRule("22:00", "06:00", "fri")}, at: at(time.Saturday, 23, 0), expected: ActionMine},
+		{name: "overnight into the next week", rules: []Rule{pauseRule("22:00", "06:00", "sun")}, at: at(time.Monday, 2, 0), expected: ActionPause},
+		{name: "full day start", rules: []Rule{pauseRule("00:00", "00:00", "sat")}, at: at(time.Saturday, 0, 0), expected: ActionPause},
+		{name: "full day end", rules: []Rule{pauseRule("00:00", "00:00", "sat")}, at: at(time.Saturday, 23, 59), expected: ActionPause},
+		{name: "after full day", rules: []Rule{pauseRule("00:00", "00:00", "sat")}, at: at(time.Sunday, 0, 0), expected: ActionMine},
+		{name: "day from the morning", rules: []Rule{pauseRule("08:00", "08:00", "mon")}, at: at(time.Tuesday, 7, 59), expected: ActionPause},
+		{name: "after day from the morning", rules: []Rule{pauseRule("08:00", "08:00", "mon")}, at: at(time.Tuesday, 8, 0), expected: ActionMine},
+		{
+			name: "first rule applies",
+			rules: []Rule{
+				{Start: "12:00", End: "13:00", Action: ActionMine},
+				pauseRule("08:00", "18:00"),
+			},
+			at:       at(time.Wednesday, 12, 30),
+			expected: ActionMine,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := Schedule{
+				Enabled: true,
+				Default: ActionMine,
+				Rules:   test.rules,
+			}
+			err := schedule.Validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			action, _ := schedule.ActionAt(test.at)
+			if action != test.expected {
+				t.Errorf("Action at %s is '%s', expected '%s'", test.at, action, test.expected)
+			}
+		})
+	}
+}
+
+func TestNextChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []Rule
+		from     time.Time
+		expected time.Time
+		action   string
+	}{
+		{name: "to overnight", rules: []Rule{pauseRule("22:00", "06:00")}, from: at(time.Monday, 12, 0), expected: at(time.Monday, 22, 0), action: ActionPause},
+		{name: "from overnight", rules: []Rule{pauseRule("22:00", "06:00")}, from: at(time.Monday, 23, 0), expected: at(time.Tuesday, 6, 0), action: ActionMine},
+		{name: "from overnight after midnight", rules: []Rule{pauseRule("22:00", "06:00", "fri")}, from: at(time.Saturday, 1, 0), expected: at(time.Saturday, 6, 0), action: ActionMine},
+		{name: "overnight next week", rules: []Rule{pauseRule("22:00", "06:00", "fri")}, from: at(time.Saturday, 12, 0), expected: at(time.Friday, 22, 0).AddDate(0, 0, 7), action: ActionPause},
+		{name: "to full day", rules: []Rule{pauseRule("00:00", "00:00", "sat")}, from: at(time.Wednesday, 10, 30).Add(time.Second * 45), expected: at(time.Saturday, 0, 0), action: ActionPause},
+		{name: "from full day", rules: []Rule{pauseRule("00:00", "00:00", "sat")}, from: at(time.Saturday, 10, 0), expected: at(time.Sunday, 0, 0), action: ActionMine},
+		{name: "no rules", rules: []Rule{}, from: at(time.Monday, 0, 0), expected: time.Time{}, action: ActionMine},
+		{name: "every day all day", rules: []Rule{pauseRule("06:00", "06:00")}, from: at(time.Monday, 0, 0), expected: time.Time{}, action: ActionPause},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := Schedule{
+				Enabled: true,
+				Default: ActionMine,
+				Rules:   test.rules,
+			}
+			err := schedule.Validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, action := schedule.NextChange(test.from)
+			if next.Equal(test.expected) == false || action != test.action {
+				t.Errorf("Next change from %s is '%s' at %s, expected '%s' at %s",
+					test.from, action, next, test.action, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package helper
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	ps "github.com/mitchellh/go-ps"
+)
+
+// ServiceProcessNames returns the names of the MiningHQ service processes
+// in the order they must be stopped
+func ServiceProcessNames() []string {
+	if strings.ToLower(runtime.GOOS) == "windows" {
+		return []string{"miner-service.exe"}
+	}
+	// The service is stopped first, otherwise it restarts the controller.
+	// Process names are truncated on Linux
+	return []string{"miner-serv", "miner-cont"}
+}
+
+// StopServices stops the running MiningHQ services and their miners. It
+// returns the PIDs that were terminated. findErr is set if a service
+// wasn't running, killErr if a service could not be stopped
+func StopServices() (terminated []int, findErr error, killErr error) {
+	for _, processName := range ServiceProcessNames() {
+		process, err := FindProcessByName(processName)
+		if err != nil {
+			findErr = err
+			continue
+		}
+		pids, err := KillProcessTree(process.Pid(), DefaultKillGracePeriod)
+		terminated = append(terminated, pids...)
+		if err != nil {
+			killErr = err
+		}
+	}
+	return terminated, findErr, killErr
+}
+
+// FindProcessByName finds and returns the process information by name
+func FindProcessByName(name string) (ps.Process, error) {
+	processes, err := ps.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, process := range processes {
+		if strings.Contains(process.Executable(), name) {
+			return process, nil
+		}
+	}
+	return nil, fmt.Errorf("Unable to find process with name '%s'", name)
+}
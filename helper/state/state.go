@@ -0,0 +1,259 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package state records what has been installed. The record replaces the
+// legacy ~/.mhqpath file, which only held the installation path, and is
+// shared by the installers, the uninstaller and the Miner Manager
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// RecordFilename is the filename of the installation record
+	RecordFilename = "install.json"
+	// LegacyFilename is the file in the user's home directory that held the
+	// installation path before the installation record was introduced
+	LegacyFilename = ".mhqpath"
+)
+
+// ErrNotInstalled is returned when no installation record was found
+var ErrNotInstalled = errors.New("MiningHQ is not installed")
+
+// AutostartEntry is an application started on login by the installation
+type AutostartEntry struct {
+	// Name is the name of the autostart entry
+	Name string `json:"name"`
+	// DisplayName is the name shown to the user
+	DisplayName string `json:"display_name"`
+	// Exec is the command that is started
+	Exec []string `json:"exec"`
+}
+
+// Record describes an installation of MiningHQ
+type Record struct {
+	// InstallPath is the directory MiningHQ is installed in
+	InstallPath string `json:"install_path"`
+	// Version is the version of MiningHQ that was installed, it is empty for
+	// installations migrated from the legacy file
+	Version string `json:"version"`
+	// RigID is the ID MiningHQ registered the rig as
+	RigID string `json:"rig_id"`
+	// InstalledAt is when MiningHQ was installed
+	InstalledAt time.Time `json:"installed_at"`
+	// Components lists the files installed in InstallPath
+	Components []string `json:"components"`
+	// Autostart lists the autostart entries created by the installation
+	Autostart []AutostartEntry `json:"autostart"`
+	// SystemWide is set when MiningHQ was installed for all users
+	SystemWide bool `json:"system_wide"`
+
+	// path is where the record is stored
+	path string
+}
+
+// NewRecord creates a new, unsaved record for an installation to
+// installPath. A system-wide record is stored in the system configuration
+// directory, otherwise in the user's configuration directory
+func NewRecord(homeDir string, installPath string, systemWide bool) *Record {
+	record := Record{
+		InstallPath: installPath,
+		InstalledAt: time.Now(),
+		SystemWide:  systemWide,
+		path:        UserRecordPath(homeDir),
+	}
+	if systemWide {
+		record.path = SystemRecordPaths()[0]
+	}
+	return &record
+}
+
+// UserRecordPath returns the path of the per-user record
+func UserRecordPath(homeDir string) string {
+	return filepath.Join(userConfigDir(homeDir), RecordFilename)
+}
+
+// SystemRecordPaths returns the paths a system-wide record is looked up in,
+// new system-wide records are stored in the first
+func SystemRecordPaths() []string {
+	var paths []string
+	for _, configDir := range systemConfigDirs() {
+		paths = append(paths, filepath.Join(configDir, RecordFilename))
+	}
+	return paths
+}
+
+// LegacyPath returns the path of the legacy ~/.mhqpath file
+func LegacyPath(homeDir string) string {
+	return filepath.Join(homeDir, LegacyFilename)
+}
+
+// Load finds the installation record. The user's record is preferred over
+// a system-wide one, unless its installation directory no longer exists.
+// A legacy ~/.mhqpath file is migrated to a new record. ErrNotInstalled is
+// returned if nothing is installed, a record that can't be read is an
+// error
+func Load(homeDir string) (*Record, error) {
+	paths := append([]string{UserRecordPath(homeDir)}, SystemRecordPaths()...)
+	// stale is a record of an installation that was removed without the
+	// uninstaller, it is only returned if no other record is found
+	var stale *Record
+	for _, path := range paths {
+		record, err := loadRecord(path)
+		if err != nil && os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Installed() == false {
+			if stale == nil {
+				stale = record
+			}
+			continue
+		}
+		return record, nil
+	}
+	record, err := migrateLegacy(homeDir)
+	if err == ErrNotInstalled && stale != nil {
+		return stale, nil
+	}
+	return record, err
+}
+
+// IsInstalled checks if MiningHQ is installed for the user or system-wide.
+// An error is returned if an installation record exists but can't be
+// read, the installation must not be treated as missing
+func IsInstalled(homeDir string) (bool, error) {
+	record, err := Load(homeDir)
+	if err == ErrNotInstalled {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return record.Installed(), nil
+}
+
+// Path returns where the record is stored
+func (record *Record) Path() string {
+	return record.path
+}
+
+// Installed checks that the installation directory still exists
+func (record *Record) Installed() bool {
+	if record.InstallPath == "" {
+		return false
+	}
+	info, err := os.Stat(record.InstallPath)
+	if err != nil {
+		return false
+	}
+	return info.IsDir()
+}
+
+// Save writes the record, creating the configuration directory if needed
+func (record *Record) Save() error {
+	err := os.MkdirAll(filepath.Dir(record.path), 0755)
+	if err != nil {
+		return fmt.Errorf("Unable to create the configuration directory: %s", err)
+	}
+	recordBytes, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	// A system-wide record must be readable by every user, a user's record
+	// is kept private
+	perm := os.FileMode(0600)
+	if record.SystemWide {
+		perm = 0644
+	}
+	err = ioutil.WriteFile(record.path, recordBytes, perm)
+	if err != nil {
+		return fmt.Errorf("Unable to write the installation record '%s': %s", record.path, err)
+	}
+	return nil
+}
+
+// Remove removes the record. Records that don't exist are ignored
+func (record *Record) Remove() error {
+	err := os.Remove(record.path)
+	if err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	return nil
+}
+
+// loadRecord reads the record at path
+func loadRecord(path string) (*Record, error) {
+	recordBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record Record
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("The installation record '%s' is malformed: %s", path, err)
+	}
+	record.InstallPath = strings.TrimSpace(record.InstallPath)
+	record.path = path
+	return &record, nil
+}
+
+// migrateLegacy creates a record from the legacy ~/.mhqpath file. The
+// legacy file is only removed once the new record has been saved, if that
+// fails the migrated record is still returned and migration is retried
+// next time
+func migrateLegacy(homeDir string) (*Record, error) {
+	legacyPath := LegacyPath(homeDir)
+	legacyBytes, err := ioutil.ReadFile(legacyPath)
+	if err != nil {
+		// if the mhqpath file doesn't exist, nothing is installed
+		return nil, ErrNotInstalled
+	}
+	installPath := strings.TrimSpace(string(legacyBytes))
+	if installPath == "" {
+		return nil, ErrNotInstalled
+	}
+
+	record := NewRecord(homeDir, installPath, false)
+	if info, err := os.Stat(legacyPath); err == nil {
+		record.InstalledAt = info.ModTime()
+	}
+	rigIDBytes, err := ioutil.ReadFile(filepath.Join(installPath, "miner-controller", "rig_id"))
+	if err == nil {
+		record.RigID = strings.TrimSpace(string(rigIDBytes))
+	}
+
+	err = record.Save()
+	if err == nil {
+		os.Remove(legacyPath)
+	}
+	return record, nil
+}
@@ -0,0 +1,59 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SystemInstallPath returns the default installation directory for a
+// system-wide installation
+func SystemInstallPath() string {
+	return filepath.Join("/opt", "mininghq")
+}
+
+// userConfigDir returns $XDG_CONFIG_HOME/mininghq, defaulting to
+// ~/.config/mininghq
+func userConfigDir(homeDir string) string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if filepath.IsAbs(configHome) == false {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "mininghq")
+}
+
+// systemConfigDirs returns mininghq in every directory of $XDG_CONFIG_DIRS,
+// defaulting to /etc/xdg/mininghq
+func systemConfigDirs() []string {
+	var dirs []string
+	for _, configDir := range strings.Split(os.Getenv("XDG_CONFIG_DIRS"), ":") {
+		if filepath.IsAbs(configDir) {
+			dirs = append(dirs, filepath.Join(configDir, "mininghq"))
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = append(dirs, filepath.Join("/etc", "xdg", "mininghq"))
+	}
+	return dirs
+}
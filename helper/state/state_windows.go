@@ -0,0 +1,55 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SystemInstallPath returns the default installation directory for a
+// system-wide installation
+func SystemInstallPath() string {
+	programFiles := os.Getenv("ProgramFiles")
+	if programFiles == "" {
+		programFiles = filepath.Join("C:\\", "Program Files")
+	}
+	return filepath.Join(programFiles, "MiningHQ")
+}
+
+// userConfigDir returns %APPDATA%\MiningHQ
+func userConfigDir(homeDir string) string {
+	appData := os.Getenv("APPDATA")
+	if appData == "" {
+		appData = filepath.Join(homeDir, "AppData", "Roaming")
+	}
+	return filepath.Join(appData, "MiningHQ")
+}
+
+// systemConfigDirs returns %ProgramData%\MiningHQ
+func systemConfigDirs() []string {
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		programData = filepath.Join("C:\\", "ProgramData")
+	}
+	return []string{filepath.Join(programData, "MiningHQ")}
+}
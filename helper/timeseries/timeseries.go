@@ -0,0 +1,422 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package timeseries stores the hashrate and share history of the rig in a
+// compact append-only file. Points are kept at three resolutions: every
+// sample for an hour, one minute averages for a day and fifteen minute
+// averages for a month. The file is compacted to drop expired points
+package timeseries
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Filename is the history file in the installation directory
+const Filename = "stats-history.db"
+
+// Resolution is a resolution points are kept at
+type Resolution struct {
+	// Step is the time between points
+	Step time.Duration
+	// Retention is how long points are kept
+	Retention time.Duration
+}
+
+// Resolutions are the resolutions points are kept at, finest first. The
+// first resolution holds the samples as they are added
+var Resolutions = []Resolution{
+	{Step: time.Second * 5, Retention: time.Hour},
+	{Step: time.Minute, Retention: time.Hour * 24},
+	{Step: time.Minute * 15, Retention: time.Hour * 24 * 30},
+}
+
+// header starts every history file, the last byte is the format version
+var header = []byte("MHQTS\x00\x00\x01")
+
+// compactRetryInterval is the time after which a failed compaction is
+// tried again, samples are appended to the uncompacted file meanwhile
+const compactRetryInterval = time.Minute
+
+// recordSize is the size of a point in the file: the resolution, the Unix
+// time in seconds, the hashrate and the three share counters
+const recordSize = 1 + 8 + 8 + 8 + 8 + 8
+
+// Point is the hashrate and shares of the rig at a time
+type Point struct {
+	// Time is the start of the point
+	Time time.Time `json:"time"`
+	// Hashrate is the average hashrate in hashes per second
+	Hashrate float64 `json:"hashrate"`
+	// TotalShares is the number of shares submitted by the miners
+	TotalShares int64 `json:"total_shares"`
+	// AcceptedShares is the number of shares accepted by the pool
+	AcceptedShares int64 `json:"accepted_shares"`
+	// RejectedShares is the number of shares rejected by the pool
+	RejectedShares int64 `json:"rejected_shares"`
+}
+
+// bucket averages the samples of a downsampled resolution
+type bucket struct {
+	// start is the start of the bucket, zero when it holds no samples
+	start time.Time
+	// hashrate is the sum of the sampled hashrates
+	hashrate float64
+	// samples counts the samples
+	samples int
+	// last is the latest sample, the share counters are kept as is
+	last Point
+}
+
+// Store appends samples to the history file. Only a single Store may write
+// to a file, any number of readers can Query it
+type Store struct {
+	// path of the history file
+	path string
+	// now returns the current time
+	now func() time.Time
+
+	// mutex guards the fields below
+	mutex sync.Mutex
+	// file is the history file opened for appending
+	file *os.File
+	// buckets hold the samples of the downsampled resolutions
+	buckets []bucket
+	// compactAt is when the file is compacted next
+	compactAt time.Time
+}
+
+// Open opens the history file at path for appending, creating it if it
+// doesn't exist. Expired points are removed first
+func Open(path string) (*Store, error) {
+	return open(path, time.Now)
+}
+
+// open opens the history file at path with the clock now
+func open(path string, now func() time.Time) (*Store, error) {
+	store := Store{
+		path:    path,
+		now:     now,
+		buckets: make([]bucket, len(Resolutions)),
+	}
+	err := store.compact()
+	if err != nil {
+		if store.file != nil {
+			store.file.Close()
+		}
+		return nil, err
+	}
+	return &store, nil
+}
+
+// Add adds a sample. Points for the downsampled resolutions are appended
+// once their step has passed
+func (store *Store) Add(sample Point) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// The file is closed when a compaction couldn't reopen it, the
+	// pending points are kept until it can be written again
+	if store.file == nil {
+		err := store.openLocked()
+		if err != nil {
+			return err
+		}
+	}
+
+	if sample.Time.IsZero() {
+		sample.Time = store.now()
+	}
+	var records bytes.Buffer
+	writeRecord(&records, 0, sample)
+	for resolution := 1; resolution < len(Resolutions); resolution++ {
+		step := Resolutions[resolution].Step
+		current := &store.buckets[resolution]
+		start := sample.Time.Truncate(step)
+		if current.samples > 0 && current.start.Equal(start) == false {
+			writeRecord(&records, resolution, current.point())
+			*current = bucket{}
+		}
+		if current.samples == 0 {
+			current.start = start
+		}
+		current.hashrate += sample.Hashrate
+		current.samples++
+		current.last = sample
+	}
+
+	_, err := store.file.Write(records.Bytes())
+	if err != nil {
+		return fmt.Errorf("Unable to write to the stats history: %s", err)
+	}
+
+	// Once the finest resolution has been replaced, expired points make up
+	// most of the file, however often samples are added
+	if store.now().Before(store.compactAt) == false {
+		return store.compactLocked()
+	}
+	return nil
+}
+
+// Close flushes the pending downsampled points and closes the file
+func (store *Store) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.file == nil {
+		err := store.openLocked()
+		if err != nil {
+			return err
+		}
+	}
+	var records bytes.Buffer
+	for resolution := 1; resolution < len(Resolutions); resolution++ {
+		if store.buckets[resolution].samples > 0 {
+			writeRecord(&records, resolution, store.buckets[resolution].point())
+			store.buckets[resolution] = bucket{}
+		}
+	}
+	_, err := store.file.Write(records.Bytes())
+	closeErr := store.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// compact rewrites the history file without the expired points
+func (store *Store) compact() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.compactLocked()
+}
+
+// compactLocked compacts the file, the mutex must be held. When the file
+// can't be compacted, samples are appended to the current file and the
+// compaction is tried again after compactRetryInterval
+func (store *Store) compactLocked() error {
+	now := store.now()
+	err := store.rewriteLocked(now)
+	if err != nil {
+		store.compactAt = now.Add(compactRetryInterval)
+	} else {
+		store.compactAt = now.Add(Resolutions[0].Retention)
+	}
+	if store.file == nil {
+		openErr := store.openLocked()
+		if err == nil {
+			err = openErr
+		}
+	}
+	return err
+}
+
+// rewriteLocked replaces the history file with one without the points
+// expired at now. The file is only closed to be replaced, the mutex must
+// be held
+func (store *Store) rewriteLocked(now time.Time) error {
+	points, err := readAll(store.path)
+	if err != nil {
+		return err
+	}
+	var records bytes.Buffer
+	records.Write(header)
+	for resolution, resolutionPoints := range points {
+		expires := now.Add(-Resolutions[resolution].Retention)
+		for _, point := range resolutionPoints {
+			if point.Time.After(expires) {
+				writeRecord(&records, resolution, point)
+			}
+		}
+	}
+
+	// The compacted file replaces the history at once, readers never see
+	// a partial file
+	compactedPath := store.path + ".tmp"
+	err = ioutil.WriteFile(compactedPath, records.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to compact the stats history: %s", err)
+	}
+	// Windows can't replace a file that is open
+	if store.file != nil {
+		store.file.Close()
+		store.file = nil
+	}
+	err = os.Rename(compactedPath, store.path)
+	if err != nil {
+		os.Remove(compactedPath)
+		return fmt.Errorf("Unable to compact the stats history: %s", err)
+	}
+	return nil
+}
+
+// openLocked opens the history file for appending, creating it with the
+// header if it doesn't exist. The mutex must be held
+func (store *Store) openLocked() error {
+	file, err := os.OpenFile(store.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to open the stats history: %s", err)
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() == 0 {
+		_, err = file.Write(header)
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Unable to open the stats history: %s", err)
+	}
+	store.file = file
+	return nil
+}
+
+// Query returns the points of the last period from the history file at
+// path, oldest first. The finest resolution that covers the period is used
+func Query(path string, period time.Duration) ([]Point, Resolution, error) {
+	return query(path, period, time.Now())
+}
+
+// Query returns the points of the last period written by the store, using
+// the store's clock. Pending downsampled points are only written by Add
+// and Close
+func (store *Store) Query(period time.Duration) ([]Point, Resolution, error) {
+	return query(store.path, period, store.now())
+}
+
+// query returns the points of the period before now from the history file
+// at path
+func query(path string, period time.Duration, now time.Time) ([]Point, Resolution, error) {
+	resolution := len(Resolutions) - 1
+	for i := range Resolutions {
+		if period <= Resolutions[i].Retention {
+			resolution = i
+			break
+		}
+	}
+
+	points, err := readAll(path)
+	if err != nil {
+		return nil, Resolutions[resolution], err
+	}
+	since := now.Add(-period)
+	result := []Point{}
+	for _, point := range points[resolution] {
+		if point.Time.After(since) {
+			result = append(result, point)
+		}
+	}
+	return result, Resolutions[resolution], nil
+}
+
+// ParsePeriod parses a query period. Periods are Go durations such as
+// '1h' or '90m', or a number of days such as '30d'
+func ParsePeriod(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("'%s' is not a valid number of days", value)
+		}
+		return time.Duration(days) * time.Hour * 24, nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("'%s' is not a valid period, use a period such as '1h', '24h' or '30d'", value)
+	}
+	return period, nil
+}
+
+// point returns the averaged point of the bucket
+func (current *bucket) point() Point {
+	point := current.last
+	point.Time = current.start
+	point.Hashrate = current.hashrate / float64(current.samples)
+	return point
+}
+
+// readAll reads the points of every resolution from the history file, a
+// file that doesn't exist has no points. A partially written last point
+// is ignored
+func readAll(path string) ([][]Point, error) {
+	points := make([][]Point, len(Resolutions))
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return points, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the stats history: %s", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	fileHeader := make([]byte, len(header))
+	_, err = io.ReadFull(reader, fileHeader)
+	if err == io.EOF {
+		return points, nil
+	}
+	if err != nil || bytes.Equal(fileHeader, header) == false {
+		return nil, errors.New("The stats history is not a supported history file")
+	}
+
+	record := make([]byte, recordSize)
+	for {
+		_, err = io.ReadFull(reader, record)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return points, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the stats history: %s", err)
+		}
+		resolution := int(record[0])
+		if resolution >= len(Resolutions) {
+			continue
+		}
+		points[resolution] = append(points[resolution], Point{
+			Time:           time.Unix(int64(binary.LittleEndian.Uint64(record[1:9])), 0),
+			Hashrate:       math.Float64frombits(binary.LittleEndian.Uint64(record[9:17])),
+			TotalShares:    int64(binary.LittleEndian.Uint64(record[17:25])),
+			AcceptedShares: int64(binary.LittleEndian.Uint64(record[25:33])),
+			RejectedShares: int64(binary.LittleEndian.Uint64(record[33:41])),
+		})
+	}
+}
+
+// writeRecord writes the point as a record of the resolution
+func writeRecord(buffer *bytes.Buffer, resolution int, point Point) {
+	record := make([]byte, recordSize)
+	record[0] = byte(resolution)
+	binary.LittleEndian.PutUint64(record[1:9], uint64(point.Time.Unix()))
+	binary.LittleEndian.PutUint64(record[9:17], math.Float64bits(point.Hashrate))
+	binary.LittleEndian.PutUint64(record[17:25], uint64(point.TotalShares))
+	binary.LittleEndian.PutUint64(record[25:33], uint64(point.AcceptedShares))
+	binary.LittleEndian.PutUint64(record[33:41], uint64(point.RejectedShares))
+	buffer.Write(record)
+}
@@ -0,0 +1,477 @@
+/*
+  MiningHQ Miner Manager - The MiningHQ Miner Manager GUI
+  https://mininghq.io
+
+	Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package timeseries
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// epoch is the start of the tests, far from the current time so that the
+// store's clock is used
+var epoch = time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+
+// testClock is a clock the tests move forward
+type testClock struct {
+	now time.Time
+}
+
+// Now returns the time of the clock
+func (clock *testClock) Now() time.Time {
+	return clock.now
+}
+
+// tempHistory returns the path of a history file in a new directory, the
+// caller removes the directory
+func tempHistory(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "timeseries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, Filename)
+}
+
+// writeHistory writes a history file with the records and extra bytes
+// after them
+func writeHistory(t *testing.T, path string, points [][]Point, extra []byte) {
+	var records bytes.Buffer
+	records.Write(header)
+	for resolution, resolutionPoints := range points {
+		for _, point := range resolutionPoints {
+			writeRecord(&records, resolution, point)
+		}
+	}
+	records.Write(extra)
+	err := ioutil.WriteFile(path, records.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownsampling(t *testing.T) {
+	tests := []struct {
+		name string
+		// offsets of the samples after epoch
+		offsets []time.Duration
+		// hashrates of the samples
+		hashrates []float64
+		// minutes are the expected one minute points
+		minutes []Point
+		// quarters are the expected fifteen minute points
+		quarters []Point
+	}{
+		{
+			name:      "single minute",
+			offsets:   []time.Duration{0, time.Second * 5, time.Second * 10},
+			hashrates: []float64{100, 200, 300},
+			minutes:   []Point{{Time: epoch, Hashrate: 200, TotalShares: 2}},
+			quarters:  []Point{{Time: epoch, Hashrate: 200, TotalShares: 2}},
+		},
+		{
+			name:      "minute boundary",
+			offsets:   []time.Duration{time.Second * 50, time.Second * 55, time.Minute},
+			hashrates: []float64{100, 200, 600},
+			minutes: []Point{
+				{Time: epoch, Hashrate: 150, TotalShares: 1},
+				{Time: epoch.Add(time.Minute), Hashrate: 600, TotalShares: 2},
+			},
+			quarters: []Point{{Time: epoch, Hashrate: 300, TotalShares: 2}},
+		},
+		{
+			name:      "gap between samples",
+			offsets:   []time.Duration{0, time.Minute * 20},
+			hashrates: []float64{100, 500},
+			minutes: []Point{
+				{Time: epoch, Hashrate: 100},
+				{Time: epoch.Add(time.Minute * 20), Hashrate: 500, TotalShares: 1},
+			},
+			quarters: []Point{
+				{Time: epoch, Hashrate: 100},
+				{Time: epoch.Add(time.Minute * 15), Hashrate: 500, TotalShares: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := tempHistory(t)
+			defer os.RemoveAll(filepath.Dir(path))
+			clock := testClock{now: epoch}
+			store, err := open(path, clock.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, offset := range test.offsets {
+				clock.now = epoch.Add(offset)
+				err = store.Add(Point{
+					Hashrate:    test.hashrates[i],
+					TotalShares: int64(i),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			samples, _, err := store.Query(time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(samples) != len(test.offsets) {
+				t.Errorf("Query returned %d samples, expected %d", len(samples), len(test.offsets))
+			}
+
+			err = store.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			points, err := readAll(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			comparePoints(t, "one minute", points[1], test.minutes)
+			comparePoints(t, "fifteen minute", points[2], test.quarters)
+		})
+	}
+}
+
+// comparePoints checks the time, hashrate and total shares of the points
+func comparePoints(t *testing.T, name string, points []Point, expected []Point) {
+	t.Helper()
+	if len(points) != len(expected) {
+		t.Fatalf("%s points: got %d, expected %d: %v", name, len(points), len(expected), points)
+	}
+	for i := range expected {
+		if points[i].Time.Equal(expected[i].Time) == false ||
+			points[i].Hashrate != expected[i].Hashrate ||
+			points[i].TotalShares != expected[i].TotalShares {
+			t.Errorf("%s point %d: got %+v, expected %+v", name, i, points[i], expected[i])
+		}
+	}
+}
+
+func TestCompactOnOpen(t *testing.T) {
+	tests := []struct {
+		name string
+		// ages of the points before epoch, per resolution
+		ages [][]time.Duration
+		// expected is the number of points kept per resolution
+		expected []int
+	}{
+		{
+			name:     "empty",
+			ages:     [][]time.Duration{nil, nil, nil},
+			expected: []int{0, 0, 0},
+		},
+		{
+			name: "expired points",
+			ages: [][]time.Duration{
+				{time.Hour * 2, time.Hour, time.Minute * 59, time.Second * 5},
+				{time.Hour * 25, time.Hour * 23},
+				{time.Hour * 24 * 31, time.Hour * 24 * 29, time.Hour},
+			},
+			expected: []int{2, 1, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := tempHistory(t)
+			defer os.RemoveAll(filepath.Dir(path))
+			points := make([][]Point, len(Resolutions))
+			for resolution, ages := range test.ages {
+				for _, age := range ages {
+					points[resolution] = append(points[resolution], Point{Time: epoch.Add(-age)})
+				}
+			}
+			writeHistory(t, path, points, nil)
+
+			clock := testClock{now: epoch}
+			store, err := open(path, clock.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			compacted, err := readAll(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for resolution, count := range test.expected {
+				if len(compacted[resolution]) != count {
+					t.Errorf("Resolution %d: got %d points, expected %d",
+						resolution, len(compacted[resolution]), count)
+				}
+			}
+		})
+	}
+}
+
+func TestCompactWhileAdding(t *testing.T) {
+	tests := []struct {
+		name string
+		// interval between the samples
+		interval time.Duration
+		// duration samples are added for
+		duration time.Duration
+	}{
+		{name: "every second", interval: time.Second, duration: time.Hour * 2},
+		{name: "every five seconds", interval: time.Second * 5, duration: time.Hour * 3},
+		{name: "every thirty seconds", interval: time.Second * 30, duration: time.Hour * 8},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := tempHistory(t)
+			defer os.RemoveAll(filepath.Dir(path))
+			clock := testClock{now: epoch}
+			store, err := open(path, clock.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			for elapsed := time.Duration(0); elapsed < test.duration; elapsed += test.interval {
+				clock.now = epoch.Add(elapsed)
+				err = store.Add(Point{Hashrate: 100})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			points, err := readAll(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Expired samples are kept for at most another retention
+			// period before the file is compacted
+			oldest := clock.now.Add(-Resolutions[0].Retention * 2)
+			if len(points[0]) == 0 || points[0][0].Time.Before(oldest) {
+				t.Errorf("The oldest sample is from %s, expected after %s",
+					points[0][0].Time, oldest)
+			}
+			maxSamples := int(Resolutions[0].Retention * 2 / test.interval)
+			if len(points[0]) > maxSamples {
+				t.Errorf("The history holds %d samples, expected at most %d", len(points[0]), maxSamples)
+			}
+		})
+	}
+}
+
+func TestPartialRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		// points written before the partial record
+		points int
+		// extra is the length of the partial record
+		extra int
+	}{
+		{name: "complete records", points: 3, extra: 0},
+		{name: "single byte", points: 3, extra: 1},
+		{name: "all but one byte", points: 3, extra: recordSize - 1},
+		{name: "only a partial record", points: 0, extra: recordSize / 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := tempHistory(t)
+			defer os.RemoveAll(filepath.Dir(path))
+			points := make([][]Point, len(Resolutions))
+			for i := 0; i < test.points; i++ {
+				points[0] = append(points[0], Point{
+					Time:     epoch.Add(-time.Minute * time.Duration(test.points-i)),
+					Hashrate: float64(i + 1),
+				})
+			}
+			writeHistory(t, path, points, bytes.Repeat([]byte{0xff}, test.extra))
+
+			read, err := readAll(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(read[0]) != test.points {
+				t.Fatalf("Read %d points, expected %d", len(read[0]), test.points)
+			}
+
+			// Opening the store drops the partial record, points added
+			// afterwards are read back intact
+			clock := testClock{now: epoch}
+			store, err := open(path, clock.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.Add(Point{Hashrate: 42})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err = readAll(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(read[0]) != test.points+1 {
+				t.Fatalf("Read %d points, expected %d", len(read[0]), test.points+1)
+			}
+			last := read[0][len(read[0])-1]
+			if last.Hashrate != 42 || last.Time.Equal(epoch) == false {
+				t.Errorf("The added point was read as %+v", last)
+			}
+		})
+	}
+}
+
+func TestFailedCompaction(t *testing.T) {
+	tests := []struct {
+		name string
+		// block makes the history unwritable in a way, closeFile closes
+		// the store's file first
+		block     func(t *testing.T, path string)
+		unblock   func(t *testing.T, path string)
+		closeFile bool
+		// recorded is set when samples added while blocked are written
+		recorded bool
+	}{
+		{
+			name: "temporary file blocked",
+			block: func(t *testing.T, path string) {
+				err := os.MkdirAll(filepath.Join(path+".tmp", "blocked"), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			unblock: func(t *testing.T, path string) {
+				err := os.RemoveAll(path + ".tmp")
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			recorded: true,
+		},
+		{
+			name: "history file unavailable",
+			block: func(t *testing.T, path string) {
+				err := os.Rename(path, path+".bak")
+				if err == nil {
+					err = os.Mkdir(path, 0755)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			unblock: func(t *testing.T, path string) {
+				err := os.Remove(path)
+				if err == nil {
+					err = os.Rename(path+".bak", path)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			closeFile: true,
+		},
+	}
+
+	blockAt := time.Minute * 30
+	unblockAt := time.Minute * 90
+	duration := time.Hour * 2
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := tempHistory(t)
+			defer os.RemoveAll(filepath.Dir(path))
+			clock := testClock{now: epoch}
+			store, err := open(path, clock.Now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// minutes holds the Unix time of the minutes samples were
+			// recorded in
+			minutes := make(map[int64]bool)
+			var samples []time.Time
+			step := Resolutions[0].Step
+			for elapsed := time.Duration(0); elapsed < duration; elapsed += step {
+				clock.now = epoch.Add(elapsed)
+				blocked := elapsed >= blockAt && elapsed < unblockAt
+				if elapsed == blockAt {
+					if test.closeFile {
+						store.file.Close()
+						store.file = nil
+					}
+					test.block(t, path)
+				}
+				if elapsed == unblockAt {
+					test.unblock(t, path)
+				}
+
+				err = store.Add(Point{Hashrate: 100})
+				if err != nil && blocked == false {
+					t.Fatalf("Unable to add a sample after %s: %s", elapsed, err)
+				}
+				if blocked == false || test.recorded {
+					minutes[clock.now.Truncate(Resolutions[1].Step).Unix()] = true
+					samples = append(samples, clock.now)
+				}
+			}
+			err = store.Close()
+			if err != nil {
+				t.Fatalf("Unable to close the store: %s", err)
+			}
+
+			points, err := readAll(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Every sample of the last hour is kept
+			expires := clock.now.Add(-Resolutions[0].Retention)
+			var expected []Point
+			for _, sampled := range samples {
+				if sampled.After(expires) {
+					expected = append(expected, Point{Time: sampled, Hashrate: 100})
+				}
+			}
+			var kept []Point
+			for _, point := range points[0] {
+				if point.Time.After(expires) {
+					kept = append(kept, point)
+				}
+			}
+			comparePoints(t, "samples", kept, expected)
+
+			// Every minute with samples is kept, none were lost while the
+			// history was blocked
+			if len(points[1]) != len(minutes) {
+				t.Errorf("The history holds %d minutes, expected %d", len(points[1]), len(minutes))
+			}
+			for _, point := range points[1] {
+				if minutes[point.Time.Unix()] == false {
+					t.Errorf("The history holds the minute %s without samples", point.Time)
+				}
+			}
+		})
+	}
+}
@@ -22,7 +22,14 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/mininghq/miner/miner-service/src/miner"
 )
@@ -31,16 +38,127 @@ import (
 // The Controller runs all the mining logic.
 func main() {
 
-	// Set up the new miner
-	minerService, err := miner.New()
+	installPath, err := miner.InstallPath()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Run
-	err = minerService.Run()
+	// Settings are read from the config file first, then overridden by
+	// the environment and finally by any flags given on the command line
+	configPath := flag.String(
+		"config",
+		filepath.Join(installPath, miner.ConfigFilename),
+		"Path to the service config file")
+	clientID := flag.String("client-id", "", "Override the update client ID")
+	updateEndpoint := flag.String("update-endpoint", "", "Override the update endpoint")
+	updateChannel := flag.String("update-channel", "", "Override the update channel, ie. 'stable' or 'beta'")
+	updateInterval := flag.Duration("update-interval", 0, "Override the update check interval, ie. '30m'")
+	bundlePath := flag.String("bundle", "", "Install the controller from a local update bundle, a directory or tarball")
+	metricsAddress := flag.String("metrics-address", "", "Serve Prometheus metrics on this address, ie. 'localhost:9630'")
+	testAlerts := flag.Bool("test-alerts", false, "Send a test alert through the configured alert sinks and exit")
+	flag.Parse()
+
+	// loadConfig is used at startup and again when the config is reloaded
+	loadConfig := func() (miner.Config, error) {
+		config, err := miner.LoadConfig(*configPath)
+		if err != nil {
+			return config, err
+		}
+		err = config.ApplyEnvironment()
+		if err != nil {
+			return config, err
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "client-id":
+				config.ClientID = *clientID
+			case "update-endpoint":
+				config.UpdateEndpoint = *updateEndpoint
+			case "update-channel":
+				config.UpdateChannel = *updateChannel
+			case "update-interval":
+				config.UpdateCheckInterval = miner.Duration(*updateInterval)
+			case "bundle":
+				config.BundlePath = *bundlePath
+			case "metrics-address":
+				config.MetricsAddress = *metricsAddress
+			}
+		})
+
+		if config.ClientID == "" {
+			config.ClientID, err = miner.ClientIDFromRigID(installPath)
+			if err != nil {
+				return config, err
+			}
+		}
+		return config, config.Validate()
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid miner service config: %s", err)
+	}
+
+	// Set up the new miner
+	minerService, err := miner.New(installPath, config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *testAlerts {
+		err = minerService.TestAlerts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(reload, reloadSignals...)
+	}
+
+	// Run
+	runResult := make(chan error, 1)
+	go func() {
+		runResult <- minerService.Run()
+	}()
+
+	for {
+		select {
+		case err = <-runResult:
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+
+		case received := <-shutdown:
+			log.Printf("Received %s, shutting down", received)
+			ctx, cancel := context.WithTimeout(
+				context.Background(),
+				time.Duration(config.ShutdownTimeout))
+			err = minerService.Stop(ctx)
+			cancel()
+			if err != nil {
+				log.Fatalf("Unable to stop cleanly: %s", err)
+			}
+			return
+
+		case received := <-reload:
+			log.Printf("Received %s, reloading config and checking for updates", received)
+			reloaded, err := loadConfig()
+			if err != nil {
+				log.Printf("Not reloading, invalid miner service config: %s", err)
+				continue
+			}
+			err = minerService.Reload(reloaded)
+			if err != nil {
+				log.Printf("Unable to reload: %s", err)
+				continue
+			}
+			config = reloaded
+		}
+	}
 }
@@ -0,0 +1,489 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/rpcproto/rpcproto"
+	"google.golang.org/grpc"
+)
+
+// Kinds of alerts
+const (
+	// alertUnreachable is raised while the controller can't be reached
+	alertUnreachable = "controller_unreachable"
+	// alertControllerExited is raised when the controller exits unexpectedly
+	alertControllerExited = "controller_exited"
+	// alertStopped is raised while the miners aren't hashing even though
+	// the controller reports mining
+	alertStopped = "mining_stopped"
+	// alertHashrateDrop is raised while the hashrate is below the baseline
+	alertHashrateDrop = "hashrate_drop"
+	// alertRejectedShares is raised while too many shares are rejected
+	alertRejectedShares = "rejected_shares"
+)
+
+const (
+	// alertInterval is the time between checks of the controller
+	alertInterval = 15 * time.Second
+	// hashrateSettle is how long miners get to reach their hashrate after
+	// mining starts, the baseline isn't updated before then
+	hashrateSettle = 2 * time.Minute
+	// baselineWarmup is how long the rig must mine before the baseline is
+	// trusted enough to alert on drops
+	baselineWarmup = 10 * time.Minute
+	// baselineWindow is roughly the period the baseline averages over
+	baselineWindow = time.Hour
+	// dropWindow is the period the hashrate is averaged over before it is
+	// compared to the baseline, short dips don't raise alerts
+	dropWindow = 5 * time.Minute
+	// rejectWindow is the period the rejected share rate is measured over
+	rejectWindow = 15 * time.Minute
+	// minRejectShares is the number of shares that must be submitted in
+	// the reject window before the rate is meaningful
+	minRejectShares = 10
+)
+
+// alertObservation is the state of the controller at a single check
+type alertObservation struct {
+	// time of the check
+	time time.Time
+	// err is set when the controller couldn't be reached
+	err error
+	// state is the mining state the controller reports
+	state rpcproto.MinerState
+	// hashrate is the combined hashrate of the miners
+	hashrate float64
+	// acceptedShares is the total of accepted shares of the miners
+	acceptedShares int64
+	// rejectedShares is the total of rejected shares of the miners
+	rejectedShares int64
+}
+
+// hashrateSample is the hashrate at a check
+type hashrateSample struct {
+	time     time.Time
+	hashrate float64
+}
+
+// shareSample is the share totals at a check
+type shareSample struct {
+	time     time.Time
+	accepted int64
+	rejected int64
+}
+
+// alertMonitor raises alerts from the observations of the controller. An
+// alert is raised once when its problem starts and resolved once when it
+// ends, so that the user isn't notified on every check
+type alertMonitor struct {
+	// active holds the kinds of the alerts currently raised
+	active map[string]bool
+	// unreachableSince is when the controller became unreachable
+	unreachableSince time.Time
+	// miningSince is when the controller started mining
+	miningSince time.Time
+	// stoppedSince is when the miners stopped hashing while mining
+	stoppedSince time.Time
+	// baseline is the average hashrate while mining normally
+	baseline float64
+	// hashrates holds the samples in the drop window
+	hashrates []hashrateSample
+	// shares holds the samples in the reject window
+	shares []shareSample
+}
+
+// newAlertMonitor creates a monitor with no alerts raised
+func newAlertMonitor() *alertMonitor {
+	return &alertMonitor{
+		active: make(map[string]bool),
+	}
+}
+
+// observe checks the observation against the config and returns the
+// alerts raised and resolved by it
+func (monitor *alertMonitor) observe(config AlertConfig, observation alertObservation) []alert {
+	var alerts []alert
+	add := func(raised *alert) {
+		if raised != nil {
+			raised.Time = observation.time
+			alerts = append(alerts, *raised)
+		}
+	}
+	now := observation.time
+
+	if observation.err != nil {
+		if monitor.unreachableSince.IsZero() {
+			monitor.unreachableSince = now
+		}
+		if now.Sub(monitor.unreachableSince) >= time.Duration(config.UnreachableAfter) {
+			add(monitor.raise(
+				alertUnreachable,
+				"Miner controller unreachable",
+				fmt.Sprintf(
+					"The miner controller has not responded for %s, mining may have stopped: %s",
+					now.Sub(monitor.unreachableSince).Round(time.Second),
+					observation.err)))
+		}
+		// Nothing else can be checked without the controller
+		monitor.resetMining()
+		return alerts
+	}
+	monitor.unreachableSince = time.Time{}
+	add(monitor.resolve(
+		alertUnreachable,
+		"Miner controller reachable",
+		"The miner controller is responding again"))
+
+	// Paused or stopped rigs don't hash, the alerts below resolve once
+	// mining resumes
+	if observation.state != rpcproto.MinerState_Mining {
+		monitor.resetMining()
+		return alerts
+	}
+	if monitor.miningSince.IsZero() {
+		monitor.miningSince = now
+	}
+
+	if observation.hashrate <= 0 {
+		if monitor.stoppedSince.IsZero() {
+			monitor.stoppedSince = now
+		}
+		if now.Sub(monitor.stoppedSince) >= time.Duration(config.StoppedAfter) {
+			add(monitor.raise(
+				alertStopped,
+				"Mining stopped",
+				fmt.Sprintf(
+					"The miner controller reports mining, but no miner has reported a hashrate for %s",
+					now.Sub(monitor.stoppedSince).Round(time.Second))))
+		}
+	} else {
+		monitor.stoppedSince = time.Time{}
+		add(monitor.resolve(
+			alertStopped,
+			"Mining resumed",
+			fmt.Sprintf("The miners are hashing again at %.2f H/s", observation.hashrate)))
+	}
+
+	// Miners that stopped hashing raise the stopped alert instead
+	if config.HashrateDrop > 0 && observation.hashrate > 0 {
+		add(monitor.checkHashrate(config, observation))
+	}
+	if config.MaxRejectRate > 0 {
+		add(monitor.checkShares(config, observation))
+	}
+	return alerts
+}
+
+// checkHashrate compares the average hashrate of the drop window to the
+// baseline. The baseline follows the hashrate slowly, but not while the
+// hashrate is too low, or it would drift down to the drop
+func (monitor *alertMonitor) checkHashrate(config AlertConfig, observation alertObservation) *alert {
+	now := observation.time
+	monitor.hashrates = append(monitor.hashrates, hashrateSample{
+		time:     now,
+		hashrate: observation.hashrate,
+	})
+	for len(monitor.hashrates) > 0 && now.Sub(monitor.hashrates[0].time) > dropWindow {
+		monitor.hashrates = monitor.hashrates[1:]
+	}
+
+	mining := now.Sub(monitor.miningSince)
+	if mining < hashrateSettle {
+		return nil
+	}
+	if monitor.active[alertHashrateDrop] == false && observation.hashrate > 0 {
+		if monitor.baseline == 0 {
+			monitor.baseline = observation.hashrate
+		} else {
+			weight := float64(alertInterval) / float64(baselineWindow)
+			monitor.baseline += (observation.hashrate - monitor.baseline) * weight
+		}
+	}
+	// The window must be full, mining may have just resumed
+	if mining < baselineWarmup || now.Sub(monitor.hashrates[0].time) < dropWindow-alertInterval {
+		return nil
+	}
+
+	var total float64
+	for _, sample := range monitor.hashrates {
+		total += sample.hashrate
+	}
+	average := total / float64(len(monitor.hashrates))
+	if average < monitor.baseline*(1-config.HashrateDrop/100) {
+		return monitor.raise(
+			alertHashrateDrop,
+			"Hashrate dropped",
+			fmt.Sprintf(
+				"The hashrate averaged %.2f H/s over the last %s, %.0f%% below the usual %.2f H/s",
+				average,
+				dropWindow,
+				(1-average/monitor.baseline)*100,
+				monitor.baseline))
+	}
+	// The hashrate must recover to half the drop, or an alert would be
+	// raised and resolved repeatedly around the threshold
+	if average < monitor.baseline*(1-config.HashrateDrop/200) {
+		return nil
+	}
+	return monitor.resolve(
+		alertHashrateDrop,
+		"Hashrate recovered",
+		fmt.Sprintf(
+			"The hashrate averaged %.2f H/s over the last %s, the usual is %.2f H/s",
+			average,
+			dropWindow,
+			monitor.baseline))
+}
+
+// checkShares compares the rate of shares rejected in the reject window
+// to the limit
+func (monitor *alertMonitor) checkShares(config AlertConfig, observation alertObservation) *alert {
+	now := observation.time
+	// The totals start over when the controller or a miner restarts
+	if len(monitor.shares) > 0 {
+		last := monitor.shares[len(monitor.shares)-1]
+		if observation.acceptedShares < last.accepted || observation.rejectedShares < last.rejected {
+			monitor.shares = nil
+		}
+	}
+	monitor.shares = append(monitor.shares, shareSample{
+		time:     now,
+		accepted: observation.acceptedShares,
+		rejected: observation.rejectedShares,
+	})
+	for len(monitor.shares) > 1 && now.Sub(monitor.shares[0].time) > rejectWindow {
+		monitor.shares = monitor.shares[1:]
+	}
+
+	first := monitor.shares[0]
+	accepted := observation.acceptedShares - first.accepted
+	rejected := observation.rejectedShares - first.rejected
+	if accepted+rejected < minRejectShares {
+		return nil
+	}
+	rate := helper.RejectionRate(accepted, rejected)
+	if rate >= config.MaxRejectRate {
+		return monitor.raise(
+			alertRejectedShares,
+			"Rejected shares spiked",
+			fmt.Sprintf(
+				"%.1f%% of the %d shares submitted in the last %s were rejected, the limit is %g%%",
+				rate,
+				accepted+rejected,
+				now.Sub(first.time).Round(time.Minute),
+				config.MaxRejectRate))
+	}
+	return monitor.resolve(
+		alertRejectedShares,
+		"Rejected shares back to normal",
+		fmt.Sprintf(
+			"%.1f%% of the %d shares submitted in the last %s were rejected",
+			rate,
+			accepted+rejected,
+			now.Sub(first.time).Round(time.Minute)))
+}
+
+// resetMining forgets the samples taken while mining, they don't apply
+// once mining is interrupted. The baseline is kept
+func (monitor *alertMonitor) resetMining() {
+	monitor.miningSince = time.Time{}
+	monitor.stoppedSince = time.Time{}
+	monitor.hashrates = nil
+	monitor.shares = nil
+}
+
+// raise returns the alert unless it is already raised
+func (monitor *alertMonitor) raise(kind string, title string, message string) *alert {
+	if monitor.active[kind] {
+		return nil
+	}
+	monitor.active[kind] = true
+	return &alert{
+		Kind:    kind,
+		Title:   title,
+		Message: message,
+	}
+}
+
+// resolve returns the resolved alert if it was raised
+func (monitor *alertMonitor) resolve(kind string, title string, message string) *alert {
+	if monitor.active[kind] == false {
+		return nil
+	}
+	delete(monitor.active, kind)
+	return &alert{
+		Kind:     kind,
+		Resolved: true,
+		Title:    title,
+		Message:  message,
+	}
+}
+
+// watchAlerts checks the controller every alert interval until the service
+// stops and sends the alerts raised
+func (miner *Miner) watchAlerts() {
+	monitor := newAlertMonitor()
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+
+	var conn *grpc.ClientConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-miner.stop:
+			return
+		case <-ticker.C:
+		}
+
+		config := miner.currentConfig().Alerts
+		if config.Enabled == false {
+			continue
+		}
+
+		// The connection reconnects by itself once established
+		var observation alertObservation
+		var err error
+		if conn == nil {
+			conn, err = miner.dialController(controllerRequestTimeout)
+		}
+		if err == nil {
+			observation = observeController(conn)
+		} else {
+			observation.err = err
+		}
+		observation.time = time.Now()
+		if miner.isStopping() {
+			return
+		}
+
+		for _, raised := range monitor.observe(config, observation) {
+			miner.sendAlert(config, raised)
+		}
+	}
+}
+
+// observeController reads the mining state and stats of the controller
+func observeController(conn *grpc.ClientConn) alertObservation {
+	ctx, cancel := context.WithTimeout(context.Background(), controllerRequestTimeout)
+	defer cancel()
+
+	var observation alertObservation
+	client := rpcproto.NewManagerServiceClient(conn)
+	stateResponse, err := client.GetState(ctx, &rpcproto.StateRequest{})
+	if err != nil {
+		observation.err = err
+		return observation
+	}
+	observation.state = stateResponse.State
+
+	statsResponse, err := client.GetStats(ctx, &rpcproto.StatsRequest{})
+	if err != nil {
+		observation.err = err
+		return observation
+	}
+	for _, stats := range statsResponse.Stats {
+		observation.hashrate += stats.Hashrate
+		observation.acceptedShares += stats.AcceptedShares
+		observation.rejectedShares += stats.RejectedShares
+	}
+	return observation
+}
+
+// sendAlert records the alert in the alert history and delivers it to the
+// configured sinks in the background, slow sinks don't delay the checks
+func (miner *Miner) sendAlert(config AlertConfig, raised alert) {
+	if config.Enabled == false {
+		return
+	}
+	if raised.Time.IsZero() {
+		raised.Time = time.Now()
+	}
+	raised.Rig, _ = os.Hostname()
+
+	eventType := "alert"
+	if raised.Resolved {
+		eventType = "resolved"
+		miner.log.Infof("%s: %s", raised.Title, raised.Message)
+	} else {
+		miner.log.Warnf("%s: %s", raised.Title, raised.Message)
+	}
+	err := helper.AppendEvent(filepath.Join(miner.installPath, helper.AlertHistoryFilename), helper.Event{
+		Time:    raised.Time,
+		Type:    eventType,
+		Message: fmt.Sprintf("%s: %s", raised.Title, raised.Message),
+	})
+	if err != nil {
+		miner.log.Errorf("Unable to record alert history: %s", err)
+	}
+
+	go func() {
+		for _, sink := range alertSinks(config) {
+			err := sink.send(raised)
+			if err != nil {
+				miner.log.Errorf("Unable to send alert through %s: %s", sink.name(), err)
+			}
+		}
+	}()
+}
+
+// TestAlerts sends a test alert through every configured sink and waits
+// for them, so that the sinks can be checked before a problem occurs
+func (miner *Miner) TestAlerts() error {
+	config := miner.currentConfig().Alerts
+	sinks := alertSinks(config)
+	if len(sinks) == 0 {
+		return fmt.Errorf("No alert sinks are configured")
+	}
+
+	test := alert{
+		Kind:    "test",
+		Title:   "Test alert",
+		Message: "This is a test alert from the MiningHQ Miner service, alerts are delivered here",
+		Time:    time.Now(),
+	}
+	test.Rig, _ = os.Hostname()
+	var failures []string
+	for _, sink := range sinks {
+		err := sink.send(test)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", sink.name(), err))
+			continue
+		}
+		miner.log.Infof("Sent test alert through %s", sink.name())
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Unable to send the test alert through %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
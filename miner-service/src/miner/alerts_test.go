@@ -0,0 +1,181 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mininghq/rpcproto/rpcproto"
+)
+
+// alertStep repeats an observation of the controller every alert interval
+type alertStep struct {
+	// duration the observation is repeated for, at least once
+	duration time.Duration
+	// unreachable makes the controller unreachable
+	unreachable bool
+	// state is the mining state the controller reports
+	state rpcproto.MinerState
+	// hashrate is the combined hashrate of the miners
+	hashrate float64
+	// accepted is the number of shares accepted between checks
+	accepted int64
+	// rejected is the number of shares rejected between checks
+	rejected int64
+}
+
+// TestObserve checks that the alerts are raised once their problem lasts
+// long enough and resolved once it ends
+func TestObserve(t *testing.T) {
+	defaults := DefaultConfig().Alerts
+	noDrops := DefaultConfig().Alerts
+	noDrops.HashrateDrop = 0
+	noDrops.MaxRejectRate = 0
+
+	tests := []struct {
+		name   string
+		config AlertConfig
+		steps  []alertStep
+		// expected lists the alerts raised, ie. '+mining_stopped', and
+		// resolved, ie. '-mining_stopped', in order
+		expected []string
+	}{
+		{
+			name:   "short outage",
+			config: defaults,
+			steps: []alertStep{
+				{duration: 45 * time.Second, unreachable: true},
+				{duration: time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100},
+			},
+			expected: nil,
+		},
+		{
+			name:   "unreachable controller",
+			config: defaults,
+			steps: []alertStep{
+				{duration: 2 * time.Minute, unreachable: true},
+				{duration: time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100},
+			},
+			expected: []string{"+" + alertUnreachable, "-" + alertUnreachable},
+		},
+		{
+			name:   "mining stopped",
+			config: defaults,
+			steps: []alertStep{
+				{duration: 3 * time.Minute, state: rpcproto.MinerState_Mining},
+				{duration: time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100},
+			},
+			expected: []string{"+" + alertStopped, "-" + alertStopped},
+		},
+		{
+			name:   "pause interrupts a stop",
+			config: defaults,
+			steps: []alertStep{
+				{duration: 90 * time.Second, state: rpcproto.MinerState_Mining},
+				{duration: time.Minute, state: rpcproto.MinerState_PauseMining},
+				{duration: 90 * time.Second, state: rpcproto.MinerState_Mining},
+			},
+			expected: nil,
+		},
+		{
+			name:   "hashrate drop",
+			config: defaults,
+			steps: []alertStep{
+				{duration: 15 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100},
+				{duration: 6 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 50},
+				{duration: 6 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100},
+			},
+			expected: []string{"+" + alertHashrateDrop, "-" + alertHashrateDrop},
+		},
+		{
+			name:   "hashrate drop during warmup",
+			config: defaults,
+			steps: []alertStep{
+				{duration: 3 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100},
+				{duration: 6 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 50},
+			},
+			expected: nil,
+		},
+		{
+			name:   "rejected shares",
+			config: defaults,
+			steps: []alertStep{
+				{duration: 5 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100, accepted: 10},
+				{duration: 15 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100, accepted: 8, rejected: 2},
+				{duration: 20 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100, accepted: 10},
+			},
+			expected: []string{"+" + alertRejectedShares, "-" + alertRejectedShares},
+		},
+		{
+			name:   "disabled checks",
+			config: noDrops,
+			steps: []alertStep{
+				{duration: 15 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 100, accepted: 10},
+				{duration: 15 * time.Minute, state: rpcproto.MinerState_Mining, hashrate: 50, accepted: 5, rejected: 5},
+			},
+			expected: nil,
+		},
+	}
+
+	start := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			monitor := newAlertMonitor()
+			now := start
+			var accepted, rejected int64
+			var raised []string
+			for _, step := range test.steps {
+				for elapsed := time.Duration(0); elapsed == 0 || elapsed < step.duration; elapsed += alertInterval {
+					accepted += step.accepted
+					rejected += step.rejected
+					observation := alertObservation{
+						time:           now,
+						state:          step.state,
+						hashrate:       step.hashrate,
+						acceptedShares: accepted,
+						rejectedShares: rejected,
+					}
+					if step.unreachable {
+						observation.err = errors.New("connection refused")
+					}
+					for _, alert := range monitor.observe(test.config, observation) {
+						if alert.Time.Equal(now) == false {
+							t.Errorf("Expected alert '%s' at %s, got %s", alert.Kind, now, alert.Time)
+						}
+						if alert.Resolved {
+							raised = append(raised, "-"+alert.Kind)
+						} else {
+							raised = append(raised, "+"+alert.Kind)
+						}
+					}
+					now = now.Add(alertInterval)
+				}
+			}
+			if reflect.DeepEqual(raised, test.expected) == false {
+				t.Errorf("Expected alerts %v, got %v", test.expected, raised)
+			}
+		})
+	}
+}
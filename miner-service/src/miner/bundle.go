@@ -0,0 +1,380 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BundleManifestFilename is the name of the manifest in the root of a
+// local update bundle
+const BundleManifestFilename = "manifest.json"
+
+// reservedDirectories are directories inside the versions path that
+// don't contain controller versions
+var reservedDirectories = map[string]bool{
+	"miners": true,
+}
+
+// BundleManifest describes the controller versions in a local update bundle
+type BundleManifest struct {
+	// AppID must match the Unattended AppID of this platform,
+	// ie. 'miner-controller-linux'
+	AppID string `json:"app_id"`
+	// Versions lists the controller versions in the bundle
+	Versions []BundleVersion `json:"versions"`
+}
+
+// BundleVersion is a single controller version inside a bundle
+type BundleVersion struct {
+	// Version is the version number, it is used as the directory name
+	// inside the versions path
+	Version string `json:"version"`
+	// Path is the directory of the version relative to the bundle root.
+	// Defaults to the version number
+	Path string `json:"path,omitempty"`
+	// Files maps the path of every file, relative to the version directory,
+	// to its SHA256 checksum in hex
+	Files map[string]string `json:"files"`
+}
+
+// InstallBundle installs the controller versions from a local bundle into
+// the versions path. The bundle may be a directory or a tarball (.tar,
+// .tar.gz or .tgz) containing a manifest.json in its root.
+//
+// Versions that are already installed are skipped, the versions that were
+// installed are returned
+func InstallBundle(
+	bundlePath string,
+	versionsPath string,
+	appID string) ([]string, error) {
+
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open bundle '%s': %s", bundlePath, err)
+	}
+
+	bundleRoot := bundlePath
+	if info.IsDir() == false {
+		bundleRoot, err = ioutil.TempDir("", "mininghq-bundle")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(bundleRoot)
+
+		err = extractTarball(bundlePath, bundleRoot)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to extract bundle '%s': %s", bundlePath, err)
+		}
+	}
+
+	manifestBytes, err := ioutil.ReadFile(filepath.Join(bundleRoot, BundleManifestFilename))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the bundle manifest: %s", err)
+	}
+	var manifest BundleManifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("The bundle manifest is malformed: %s", err)
+	}
+	if manifest.AppID != appID {
+		return nil, fmt.Errorf(
+			"The bundle is for '%s', this rig requires '%s'",
+			manifest.AppID,
+			appID)
+	}
+	if len(manifest.Versions) == 0 {
+		return nil, errors.New("The bundle doesn't contain any versions")
+	}
+
+	err = os.MkdirAll(versionsPath, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []string
+	for _, version := range manifest.Versions {
+		if isValidVersionName(version.Version) == false {
+			return installed, fmt.Errorf("The bundle contains an invalid version '%s'", version.Version)
+		}
+
+		targetPath := filepath.Join(versionsPath, version.Version)
+		if _, err := os.Stat(targetPath); err == nil {
+			// Already installed, online or from an earlier bundle
+			continue
+		}
+
+		sourcePath := version.Path
+		if sourcePath == "" {
+			sourcePath = version.Version
+		}
+		// The version must be inside the bundle
+		cleanSource, ok := cleanRelativePath(sourcePath)
+		if ok == false {
+			return installed, fmt.Errorf("The manifest contains an invalid path '%s' for version '%s'", version.Path, version.Version)
+		}
+		sourcePath = filepath.Join(bundleRoot, cleanSource)
+
+		// Copy to a temporary directory first so that a failed copy never
+		// leaves a partial version for Unattended to run
+		partialPath := targetPath + ".partial"
+		os.RemoveAll(partialPath)
+		err = copyBundleVersion(sourcePath, partialPath, version.Files)
+		if err != nil {
+			os.RemoveAll(partialPath)
+			return installed, fmt.Errorf("Unable to install version '%s': %s", version.Version, err)
+		}
+		err = os.Rename(partialPath, targetPath)
+		if err != nil {
+			os.RemoveAll(partialPath)
+			return installed, fmt.Errorf("Unable to install version '%s': %s", version.Version, err)
+		}
+		installed = append(installed, version.Version)
+	}
+	return installed, nil
+}
+
+// InstalledVersions returns the controller versions in the versions path,
+// sorted from oldest to newest
+func InstalledVersions(versionsPath string) ([]string, error) {
+	entries, err := ioutil.ReadDir(versionsPath)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, entry := range entries {
+		if entry.IsDir() == false || isValidVersionName(entry.Name()) == false {
+			continue
+		}
+		versions = append(versions, entry.Name())
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) < 0
+	})
+	return versions, nil
+}
+
+// isValidVersionName checks that a version can be used as a directory name
+// inside the versions path
+func isValidVersionName(version string) bool {
+	if version == "" || version == "." || version == ".." {
+		return false
+	}
+	if strings.ContainsAny(version, `/\`) || strings.HasSuffix(version, ".partial") {
+		return false
+	}
+	if strings.HasPrefix(version, ".") {
+		return false
+	}
+	return reservedDirectories[version] == false
+}
+
+// compareVersions compares two dotted version numbers such as '1.2.10',
+// returning -1, 0 or 1. Non-numeric parts are compared as strings
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart string
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		aNumber, aErr := strconv.Atoi(aPart)
+		bNumber, bErr := strconv.Atoi(bPart)
+		if aErr == nil && bErr == nil {
+			if aNumber != bNumber {
+				if aNumber < bNumber {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// copyBundleVersion copies a version directory from the bundle, verifying
+// the checksum of every file listed in the manifest
+func copyBundleVersion(
+	sourcePath string,
+	targetPath string,
+	checksums map[string]string) error {
+
+	if len(checksums) == 0 {
+		return errors.New("The manifest doesn't list any files for this version")
+	}
+
+	for relativePath, expected := range checksums {
+		cleanPath, ok := cleanRelativePath(relativePath)
+		if ok == false {
+			return fmt.Errorf("The manifest contains an invalid path '%s'", relativePath)
+		}
+
+		source := filepath.Join(sourcePath, cleanPath)
+		target := filepath.Join(targetPath, cleanPath)
+		info, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		checksum, err := copyFileWithChecksum(source, target, info.Mode())
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(checksum, expected) == false {
+			return fmt.Errorf(
+				"The checksum of '%s' doesn't match the manifest, the bundle might be corrupt",
+				relativePath)
+		}
+	}
+	return nil
+}
+
+// copyFileWithChecksum copies a file, keeping its mode, and returns the
+// SHA256 checksum of the copied contents
+func copyFileWithChecksum(
+	source string,
+	target string,
+	mode os.FileMode) (string, error) {
+
+	in, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, mode.Perm())
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), out.Close()
+}
+
+// extractTarball extracts a tarball, optionally gzipped, to the
+// target directory
+func extractTarball(tarballPath string, targetPath string) error {
+	file, err := os.Open(tarballPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(tarballPath, ".gz") || strings.HasSuffix(tarballPath, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Never write outside of the target directory
+		cleanName, ok := cleanRelativePath(header.Name)
+		if ok == false {
+			return fmt.Errorf("The tarball contains an invalid path '%s'", header.Name)
+		}
+		target := filepath.Join(targetPath, cleanName)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+			if err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+			if err != nil {
+				return err
+			}
+			out, err := os.OpenFile(
+				target,
+				os.O_WRONLY|os.O_TRUNC|os.O_CREATE,
+				os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tarReader)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// cleanRelativePath cleans the slash separated path. It returns false if the
+// path is absolute or leads outside of the directory it is relative to
+func cleanRelativePath(relativePath string) (string, bool) {
+	cleanPath := filepath.Clean(filepath.FromSlash(relativePath))
+	if filepath.IsAbs(cleanPath) || filepath.VolumeName(cleanPath) != "" {
+		return "", false
+	}
+	if cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return cleanPath, true
+}
@@ -0,0 +1,375 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCleanRelativePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+		ok       bool
+		// windowsOnly paths are only rejected on Windows, elsewhere they
+		// are plain names inside the directory
+		windowsOnly bool
+	}{
+		{path: "1.0.0/miner-controller", expected: filepath.Join("1.0.0", "miner-controller"), ok: true},
+		{path: "./a/b", expected: filepath.Join("a", "b"), ok: true},
+		{path: "a/../b", expected: "b", ok: true},
+		{path: "..", ok: false},
+		{path: "../x", ok: false},
+		{path: "a/../../x", ok: false},
+		{path: "a/b/../../../x", ok: false},
+		{path: "/etc/passwd", ok: false},
+		{path: `C:\Windows\System32\x`, ok: false, windowsOnly: true},
+		{path: "C:/Windows/x", ok: false, windowsOnly: true},
+		{path: `C:x`, ok: false, windowsOnly: true},
+		{path: `\\server\share\x`, ok: false, windowsOnly: true},
+		{path: `..\x`, ok: false, windowsOnly: true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			cleanPath, ok := cleanRelativePath(test.path)
+			if test.windowsOnly && runtime.GOOS != "windows" {
+				// Still relative, it can't leave the directory
+				if ok == false || filepath.IsAbs(cleanPath) || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+					t.Errorf("Expected '%s' to be a relative name, got '%s' %t", test.path, cleanPath, ok)
+				}
+				return
+			}
+			if ok != test.ok {
+				t.Fatalf("Expected ok to be %t for '%s', got %t ('%s')", test.ok, test.path, ok, cleanPath)
+			}
+			if ok && cleanPath != test.expected {
+				t.Errorf("Expected '%s', got '%s'", test.expected, cleanPath)
+			}
+		})
+	}
+}
+
+// tarEntry is a single entry of a test tarball
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+// writeTarball writes the entries as a tarball to path, gzipped if the
+// path ends with '.gz'
+func writeTarball(t *testing.T, path string, entries []tarEntry) {
+	var buffer bytes.Buffer
+	var gzipWriter *gzip.Writer
+	tarWriter := tar.NewWriter(&buffer)
+	if strings.HasSuffix(path, ".gz") {
+		gzipWriter = gzip.NewWriter(&buffer)
+		tarWriter = tar.NewWriter(gzipWriter)
+	}
+	for _, entry := range entries {
+		header := tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Mode:     0644,
+			Size:     int64(len(entry.body)),
+		}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		err := tarWriter.WriteHeader(&header)
+		if err == nil && header.Size > 0 {
+			_, err = tarWriter.Write([]byte(entry.body))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tarWriter.Close()
+	if err == nil && gzipWriter != nil {
+		err = gzipWriter.Close()
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, buffer.Bytes(), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractTarball(t *testing.T) {
+	tests := []struct {
+		name      string
+		tarball   string
+		entries   []tarEntry
+		expectErr bool
+		// files are expected in the target directory with their contents
+		files map[string]string
+	}{
+		{
+			name:    "nested files",
+			tarball: "bundle.tar",
+			entries: []tarEntry{
+				{name: "1.0.0/", typeflag: tar.TypeDir},
+				{name: "1.0.0/bin/miner-controller", typeflag: tar.TypeReg, body: "controller"},
+				{name: "manifest.json", typeflag: tar.TypeReg, body: "{}"},
+			},
+			files: map[string]string{
+				"1.0.0/bin/miner-controller": "controller",
+				"manifest.json":              "{}",
+			},
+		},
+		{
+			name:    "gzipped",
+			tarball: "bundle.tar.gz",
+			entries: []tarEntry{
+				{name: "manifest.json", typeflag: tar.TypeReg, body: "{}"},
+			},
+			files: map[string]string{"manifest.json": "{}"},
+		},
+		{
+			name:    "parent directory",
+			tarball: "bundle.tar",
+			entries: []tarEntry{
+				{name: "../x", typeflag: tar.TypeReg, body: "outside"},
+			},
+			expectErr: true,
+		},
+		{
+			name:    "parent directory after a subdirectory",
+			tarball: "bundle.tar",
+			entries: []tarEntry{
+				{name: "a/../../x", typeflag: tar.TypeReg, body: "outside"},
+			},
+			expectErr: true,
+		},
+		{
+			name:    "absolute path",
+			tarball: "bundle.tar",
+			entries: []tarEntry{
+				{name: "/tmp/x", typeflag: tar.TypeReg, body: "outside"},
+			},
+			expectErr: true,
+		},
+		{
+			// The link isn't created, the file is written to a directory
+			// of the same name inside the target
+			name:    "symlink",
+			tarball: "bundle.tar",
+			entries: []tarEntry{
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+				{name: "link/x", typeflag: tar.TypeReg, body: "inside"},
+			},
+			files: map[string]string{"link/x": "inside"},
+		},
+		{
+			name:    "hard link",
+			tarball: "bundle.tar",
+			entries: []tarEntry{
+				{name: "passwd", typeflag: tar.TypeLink, linkname: "/etc/passwd"},
+			},
+			files: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "bundle")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			outside := filepath.Join(dir, "outside")
+			targetPath := filepath.Join(dir, "target", "extracted")
+			err = os.MkdirAll(outside, 0755)
+			if err == nil {
+				err = os.MkdirAll(targetPath, 0755)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range test.entries {
+				test.entries[i].linkname = strings.Replace(test.entries[i].linkname, "OUTSIDE", outside, 1)
+			}
+			tarballPath := filepath.Join(dir, test.tarball)
+			writeTarball(t, tarballPath, test.entries)
+
+			err = extractTarball(tarballPath, targetPath)
+			if test.expectErr && err == nil {
+				t.Fatal("Expected an error")
+			}
+			if test.expectErr == false && err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			// Nothing may be written outside of the target
+			for _, outsidePath := range []string{filepath.Join(dir, "x"), filepath.Join(dir, "target", "x"), filepath.Join(outside, "x")} {
+				if _, err := os.Lstat(outsidePath); err == nil {
+					t.Errorf("'%s' was written outside of the target directory", outsidePath)
+				}
+			}
+			var extracted []string
+			filepath.Walk(targetPath, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.Mode()&os.ModeSymlink != 0 {
+					t.Errorf("The link '%s' was extracted", path)
+				}
+				if info.Mode().IsRegular() {
+					relativePath, _ := filepath.Rel(targetPath, path)
+					extracted = append(extracted, filepath.ToSlash(relativePath))
+				}
+				return nil
+			})
+			if test.expectErr {
+				return
+			}
+			if len(extracted) != len(test.files) {
+				t.Errorf("Expected the files %v, got %v", test.files, extracted)
+			}
+			for name, contents := range test.files {
+				read, err := ioutil.ReadFile(filepath.Join(targetPath, filepath.FromSlash(name)))
+				if err != nil || string(read) != contents {
+					t.Errorf("Expected '%s' to contain '%s', got '%s' %v", name, contents, read, err)
+				}
+			}
+		})
+	}
+}
+
+// checksum returns the SHA256 checksum of contents in hex
+func checksum(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInstallBundle(t *testing.T) {
+	tests := []struct {
+		name string
+		// files are written to the bundle's version directory
+		files map[string]string
+		// checksums are listed in the manifest
+		checksums map[string]string
+		expectErr bool
+	}{
+		{
+			name:      "valid",
+			files:     map[string]string{"miner-controller": "controller", "lib/a.so": "library"},
+			checksums: map[string]string{"miner-controller": checksum("controller"), "lib/a.so": checksum("library")},
+		},
+		{
+			name:      "checksum mismatch",
+			files:     map[string]string{"miner-controller": "tampered", "lib/a.so": "library"},
+			checksums: map[string]string{"miner-controller": checksum("controller"), "lib/a.so": checksum("library")},
+			expectErr: true,
+		},
+		{
+			name:      "missing file",
+			files:     map[string]string{"miner-controller": "controller"},
+			checksums: map[string]string{"miner-controller": checksum("controller"), "lib/a.so": checksum("library")},
+			expectErr: true,
+		},
+		{
+			name:      "path outside the version",
+			files:     map[string]string{"miner-controller": "controller"},
+			checksums: map[string]string{"../../escaped": checksum("controller")},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "bundle")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			bundlePath := filepath.Join(dir, "bundle")
+			versionsPath := filepath.Join(dir, "versions")
+			for name, contents := range test.files {
+				filePath := filepath.Join(bundlePath, "1.2.0", filepath.FromSlash(name))
+				err = os.MkdirAll(filepath.Dir(filePath), 0755)
+				if err == nil {
+					err = ioutil.WriteFile(filePath, []byte(contents), 0755)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			manifest, err := json.Marshal(BundleManifest{
+				AppID: "miner-controller-test",
+				Versions: []BundleVersion{{
+					Version: "1.2.0",
+					Files:   test.checksums,
+				}},
+			})
+			if err == nil {
+				err = ioutil.WriteFile(filepath.Join(bundlePath, BundleManifestFilename), manifest, 0644)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			installed, err := InstallBundle(bundlePath, versionsPath, "miner-controller-test")
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				// A failed version is never left for Unattended to run
+				versions, _ := ioutil.ReadDir(versionsPath)
+				if len(installed) != 0 || len(versions) != 0 {
+					t.Errorf("Expected nothing to be installed, got %v and %d entries", installed, len(versions))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if len(installed) != 1 || installed[0] != "1.2.0" {
+				t.Fatalf("Expected 1.2.0 to be installed, got %v", installed)
+			}
+			for name, contents := range test.files {
+				read, err := ioutil.ReadFile(filepath.Join(versionsPath, "1.2.0", filepath.FromSlash(name)))
+				if err != nil || string(read) != contents {
+					t.Errorf("Expected '%s' to contain '%s', got '%s' %v", name, contents, read, err)
+				}
+			}
+
+			// Installing again skips the installed version
+			installed, err = InstallBundle(bundlePath, versionsPath, "miner-controller-test")
+			if err != nil || len(installed) != 0 {
+				t.Errorf("Expected the installed version to be skipped, got %v %v", installed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/miner/helper/timeseries"
+	"github.com/mininghq/rpcproto/rpcproto"
+	"google.golang.org/grpc"
+)
+
+// collectStats records the hashrate and shares of the rig in the stats
+// history every sample step until the service stops. Samples are skipped
+// while the controller is not running
+func (miner *Miner) collectStats() {
+	historyPath := filepath.Join(miner.installPath, timeseries.Filename)
+	store, err := timeseries.Open(historyPath)
+	if err != nil {
+		miner.log.Errorf("Unable to open the stats history, history will not be recorded: %s", err)
+		return
+	}
+	defer func() {
+		err := store.Close()
+		if err != nil {
+			miner.log.Errorf("Unable to close the stats history: %s", err)
+		}
+	}()
+
+	ticker := time.NewTicker(timeseries.Resolutions[0].Step)
+	defer ticker.Stop()
+
+	var conn *grpc.ClientConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-miner.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// The controller may not be running yet, connect once it is. The
+		// connection reconnects by itself afterwards
+		if conn == nil {
+			conn, err = miner.dialController(controllerRequestTimeout)
+			if err != nil {
+				continue
+			}
+		}
+
+		sample, err := sampleStats(conn)
+		if err != nil {
+			miner.log.Debugf("Unable to get stats from miner-controller: %s", err)
+			continue
+		}
+		err = store.Add(sample)
+		if err != nil {
+			miner.log.Errorf("Unable to record stats history: %s", err)
+		}
+	}
+}
+
+// dialController connects to the controller's manager API with the
+// installation's credentials
+func (miner *Miner) dialController(timeout time.Duration) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return managerapi.DialContext(ctx, miner.installPath, ControllerAddress, grpc.WithBlock())
+}
+
+// sampleStats returns the combined stats of the running miners
+func sampleStats(conn *grpc.ClientConn) (timeseries.Point, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), controllerRequestTimeout)
+	defer cancel()
+
+	sample := timeseries.Point{
+		Time: time.Now(),
+	}
+	client := rpcproto.NewManagerServiceClient(conn)
+	statsResponse, err := client.GetStats(ctx, &rpcproto.StatsRequest{})
+	if err != nil {
+		return sample, err
+	}
+	for _, stats := range statsResponse.Stats {
+		sample.Hashrate += stats.Hashrate
+		sample.TotalShares += stats.TotalShares
+		sample.AcceptedShares += stats.AcceptedShares
+		sample.RejectedShares += stats.RejectedShares
+	}
+	return sample, nil
+}
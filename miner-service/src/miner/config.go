@@ -0,0 +1,605 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+)
+
+const (
+	// ConfigFilename is the name of the service config file in the
+	// installation directory
+	ConfigFilename = helper.ServiceConfigFilename
+
+	// DefaultUpdateEndpoint is the Unattended endpoint used when none is
+	// configured
+	DefaultUpdateEndpoint = "https://unattended.mininghq.io"
+	// DefaultUpdateChannel is the update channel used when none is configured
+	DefaultUpdateChannel = "stable"
+	// DefaultUpdateCheckInterval is the time between update checks used when
+	// none is configured
+	DefaultUpdateCheckInterval = time.Hour
+	// MinUpdateCheckInterval is the shortest update check interval we allow,
+	// anything shorter would hammer the update server
+	MinUpdateCheckInterval = time.Minute
+	// DefaultVerifyInterval is the time between verifying the installed
+	// files used when none is configured
+	DefaultVerifyInterval = 15 * time.Minute
+	// DefaultCrashLoopExits is the number of controller exits within the
+	// crash loop window that triggers a rollback
+	DefaultCrashLoopExits = 3
+	// DefaultCrashLoopWindow is the period controller exits are counted in
+	DefaultCrashLoopWindow = 10 * time.Minute
+	// DefaultShutdownTimeout is the time the controller and miners get to
+	// exit before they are killed
+	DefaultShutdownTimeout = 30 * time.Second
+	// DefaultIdleAfter is how long the user must be inactive before mining
+	// resumes when idle mining is enabled
+	DefaultIdleAfter = 5 * time.Minute
+	// MinIdleAfter is the shortest idle period we allow, mining would start
+	// and stop while the user is reading
+	MinIdleAfter = 30 * time.Second
+	// DefaultMaxLoad is the load average per CPU above which mining isn't
+	// resumed, the rig is busy with other work
+	DefaultMaxLoad = 0.75
+	// DefaultMaxTemperature is the temperature in °C at which mining is
+	// throttled when thermal throttling is enabled
+	DefaultMaxTemperature = 85
+	// DefaultResumeTemperature is the temperature in °C every sensor must
+	// cool down to before throttled mining resumes
+	DefaultResumeTemperature = 75
+	// DefaultMaxCompetingLoad is the share of the CPUs used by other
+	// processes at which mining is throttled
+	DefaultMaxCompetingLoad = 0.5
+	// DefaultResumeCompetingLoad is the share of the CPUs other processes
+	// must drop to before throttled mining resumes
+	DefaultResumeCompetingLoad = 0.25
+	// DefaultThermalInterval is the time between thermal and load checks
+	DefaultThermalInterval = 10 * time.Second
+	// MinThermalInterval is the shortest thermal check interval we allow,
+	// the load is measured over the interval and gets noisy below it
+	MinThermalInterval = 2 * time.Second
+	// DefaultHashrateDrop is the percentage below the baseline hashrate at
+	// which an alert is raised
+	DefaultHashrateDrop = 30
+	// DefaultMaxRejectRate is the percentage of rejected shares at which an
+	// alert is raised
+	DefaultMaxRejectRate = 10
+	// DefaultUnreachableAfter is how long the controller must be unreachable
+	// before an alert is raised
+	DefaultUnreachableAfter = time.Minute
+	// DefaultStoppedAfter is how long the miners must stop hashing while
+	// mining before an alert is raised
+	DefaultStoppedAfter = 2 * time.Minute
+	// MinAlertDelay is the shortest unreachable and stopped periods we
+	// allow, the controller is checked every alertInterval
+	MinAlertDelay = 30 * time.Second
+)
+
+// Sources of the user's idle time
+const (
+	// IdleSourceAuto uses the first source available, in the order below
+	IdleSourceAuto = "auto"
+	// IdleSourceX11 asks the X server using xprintidle
+	IdleSourceX11 = "x11"
+	// IdleSourceLogind uses the idle hint of the logind session active on
+	// seat0, set by desktops such as GNOME
+	IdleSourceLogind = "logind"
+	// IdleSourceInput uses the last time an input device was used
+	IdleSourceInput = "input"
+)
+
+// Environment variables that override the config file
+const (
+	// EnvClientID overrides the Unattended client ID
+	EnvClientID = "MHQ_CLIENT_ID"
+	// EnvUpdateEndpoint overrides the Unattended update endpoint
+	EnvUpdateEndpoint = "MHQ_UPDATE_ENDPOINT"
+	// EnvUpdateChannel overrides the update channel
+	EnvUpdateChannel = "MHQ_UPDATE_CHANNEL"
+	// EnvUpdateCheckInterval overrides the update check interval, it must
+	// be a Go duration such as '30m' or '2h'
+	EnvUpdateCheckInterval = "MHQ_UPDATE_CHECK_INTERVAL"
+	// EnvBundlePath overrides the local update bundle path
+	EnvBundlePath = "MHQ_BUNDLE_PATH"
+	// EnvMetricsAddress overrides the address the Prometheus metrics are
+	// served on
+	EnvMetricsAddress = "MHQ_METRICS_ADDRESS"
+	// EnvSMTPPassword sets the password of the SMTP alert sink, so that it
+	// doesn't need to be stored in the config file
+	EnvSMTPPassword = "MHQ_SMTP_PASSWORD"
+)
+
+// validUpdateChannel matches the update channel names Unattended accepts
+var validUpdateChannel = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Duration is a time.Duration that is read from and written to JSON as
+// a Go duration string such as '1h' or '15m'
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return fmt.Errorf("durations must be a string such as '1h': %s", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*duration = Duration(parsed)
+	return nil
+}
+
+// IdleConfig holds the settings for mining only while the rig is not in use
+type IdleConfig struct {
+	// Enabled pauses mining while the user is active and resumes it once
+	// the user has been idle for IdleAfter
+	Enabled bool `json:"enabled"`
+	// IdleAfter is how long the user must be inactive before mining resumes
+	IdleAfter Duration `json:"idle_after"`
+	// Source is where the user's idle time is read from, one of the
+	// IdleSource values
+	Source string `json:"source"`
+	// MaxLoad is the load average per CPU above which mining isn't resumed
+	// while the user is idle. Zero ignores the load
+	MaxLoad float64 `json:"max_load"`
+	// PauseOnBattery pauses mining while the rig runs on battery power,
+	// whether or not idle mining is enabled. It is disabled by default
+	PauseOnBattery bool `json:"pause_on_battery"`
+}
+
+// ThermalConfig holds the settings for throttling mining when the rig runs
+// hot or other processes need the CPUs. Mining is throttled when a limit is
+// reached and resumes once every reading drops to its resume threshold
+type ThermalConfig struct {
+	// Enabled throttles mining on the temperatures and load below
+	Enabled bool `json:"enabled"`
+	// MaxTemperature is the temperature in °C of any sensor at which mining
+	// is throttled. Zero ignores the temperatures
+	MaxTemperature float64 `json:"max_temperature"`
+	// ResumeTemperature is the temperature in °C every sensor must cool
+	// down to before mining resumes, it must be below MaxTemperature
+	ResumeTemperature float64 `json:"resume_temperature"`
+	// MaxLoad is the share of the CPUs, from 0 to 1, used by processes
+	// other than the miners at which mining is throttled. Zero ignores the
+	// load
+	MaxLoad float64 `json:"max_load"`
+	// ResumeLoad is the share of the CPUs other processes must drop to
+	// before mining resumes, it must be below MaxLoad
+	ResumeLoad float64 `json:"resume_load"`
+	// Sensors limits the temperature sensors checked to those whose name
+	// contains one of the values, ie. 'coretemp' or 'amdgpu'. All sensors
+	// are checked when empty
+	Sensors []string `json:"sensors,omitempty"`
+	// Interval is the time between checks
+	Interval Duration `json:"interval"`
+}
+
+// SMTPConfig holds the settings for sending alerts by email
+type SMTPConfig struct {
+	// Address is the host and port of the SMTP server, ie.
+	// 'smtp.example.com:587'. Alerts are not emailed when empty
+	Address string `json:"address,omitempty"`
+	// Username authenticates with the server when set. Servers other than
+	// localhost must support STARTTLS to authenticate
+	Username string `json:"username,omitempty"`
+	// Password authenticates with the server, it can be set with
+	// MHQ_SMTP_PASSWORD instead
+	Password string `json:"password,omitempty"`
+	// From is the sender address
+	From string `json:"from,omitempty"`
+	// To lists the recipient addresses
+	To []string `json:"to,omitempty"`
+}
+
+// AlertConfig holds the settings for alerting the user of rig problems
+type AlertConfig struct {
+	// Enabled watches the controller and raises alerts on problems
+	Enabled bool `json:"enabled"`
+	// Desktop makes the Miner Manager show alerts as desktop notifications
+	// while it runs
+	Desktop bool `json:"desktop"`
+	// WebhookURL receives every alert as a JSON POST request when set
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// SMTP emails every alert when an address is set
+	SMTP SMTPConfig `json:"smtp"`
+	// HashrateDrop is the percentage below the baseline hashrate at which
+	// an alert is raised. Zero disables the alert
+	HashrateDrop float64 `json:"hashrate_drop"`
+	// MaxRejectRate is the percentage of rejected shares at which an alert
+	// is raised. Zero disables the alert
+	MaxRejectRate float64 `json:"max_reject_rate"`
+	// UnreachableAfter is how long the controller must be unreachable
+	// before an alert is raised
+	UnreachableAfter Duration `json:"unreachable_after"`
+	// StoppedAfter is how long the miners must stop hashing while the
+	// controller reports mining before an alert is raised
+	StoppedAfter Duration `json:"stopped_after"`
+}
+
+// Config holds the settings for the miner service
+type Config struct {
+	// ClientID identifies this rig to the Unattended update server. When empty
+	// it is derived from the rig_id written by the installers
+	ClientID string `json:"client_id,omitempty"`
+	// UpdateEndpoint is the Unattended update server
+	UpdateEndpoint string `json:"update_endpoint"`
+	// UpdateChannel is the release channel to follow, ie. 'stable' or 'beta'
+	UpdateChannel string `json:"update_channel"`
+	// UpdateCheckInterval is the time between update checks
+	UpdateCheckInterval Duration `json:"update_check_interval"`
+	// BundlePath is an optional local update bundle, a directory or tarball,
+	// that is installed before checking for updates online. It allows rigs
+	// without internet access to run the controller
+	BundlePath string `json:"bundle_path,omitempty"`
+	// VerifyInterval is the time between re-verifying the signatures of the
+	// installed controller and miners
+	VerifyInterval Duration `json:"verify_interval"`
+	// CrashLoopExits is the number of controller exits within
+	// CrashLoopWindow after which an update is rolled back
+	CrashLoopExits int `json:"crash_loop_exits"`
+	// CrashLoopWindow is the period controller exits are counted in. A
+	// version that runs for this long is recorded as the last known good
+	CrashLoopWindow Duration `json:"crash_loop_window"`
+	// ShutdownTimeout is the time the controller and miners get to exit when
+	// the service stops before they are killed
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// MetricsAddress is the address, such as 'localhost:9630', to serve
+	// Prometheus metrics on at /metrics. Metrics are disabled when empty
+	MetricsAddress string `json:"metrics_address,omitempty"`
+	// Idle configures pausing mining while the rig is in use or runs on
+	// battery power
+	Idle IdleConfig `json:"idle"`
+	// Thermal configures throttling mining on the temperatures and load
+	// of the rig
+	Thermal ThermalConfig `json:"thermal"`
+	// Alerts configures the alerts raised on rig problems
+	Alerts AlertConfig `json:"alerts"`
+}
+
+// DefaultConfig returns the config used when no config file exists
+func DefaultConfig() Config {
+	return Config{
+		UpdateEndpoint:      DefaultUpdateEndpoint,
+		UpdateChannel:       DefaultUpdateChannel,
+		UpdateCheckInterval: Duration(DefaultUpdateCheckInterval),
+		VerifyInterval:      Duration(DefaultVerifyInterval),
+		CrashLoopExits:      DefaultCrashLoopExits,
+		CrashLoopWindow:     Duration(DefaultCrashLoopWindow),
+		ShutdownTimeout:     Duration(DefaultShutdownTimeout),
+		Idle: IdleConfig{
+			IdleAfter: Duration(DefaultIdleAfter),
+			Source:    IdleSourceAuto,
+			MaxLoad:   DefaultMaxLoad,
+		},
+		Thermal: ThermalConfig{
+			MaxTemperature:    DefaultMaxTemperature,
+			ResumeTemperature: DefaultResumeTemperature,
+			MaxLoad:           DefaultMaxCompetingLoad,
+			ResumeLoad:        DefaultResumeCompetingLoad,
+			Interval:          Duration(DefaultThermalInterval),
+		},
+		Alerts: AlertConfig{
+			Enabled:          true,
+			Desktop:          true,
+			HashrateDrop:     DefaultHashrateDrop,
+			MaxRejectRate:    DefaultMaxRejectRate,
+			UnreachableAfter: Duration(DefaultUnreachableAfter),
+			StoppedAfter:     Duration(DefaultStoppedAfter),
+		},
+	}
+}
+
+// LoadConfig reads the config from the given path. Settings missing from
+// the file keep their default values. If the file doesn't exist the
+// default config is returned
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+
+	configBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("Unable to read config file '%s': %s", path, err)
+	}
+
+	err = json.Unmarshal(configBytes, &config)
+	if err != nil {
+		return config, fmt.Errorf("Config file '%s' is malformed: %s", path, err)
+	}
+	return config, nil
+}
+
+// ApplyEnvironment overrides the config with the values of any of the
+// MHQ_* environment variables that are set
+func (config *Config) ApplyEnvironment() error {
+	if value, ok := os.LookupEnv(EnvClientID); ok {
+		config.ClientID = value
+	}
+	if value, ok := os.LookupEnv(EnvUpdateEndpoint); ok {
+		config.UpdateEndpoint = value
+	}
+	if value, ok := os.LookupEnv(EnvUpdateChannel); ok {
+		config.UpdateChannel = value
+	}
+	if value, ok := os.LookupEnv(EnvUpdateCheckInterval); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s is invalid: %s", EnvUpdateCheckInterval, err)
+		}
+		config.UpdateCheckInterval = Duration(interval)
+	}
+	if value, ok := os.LookupEnv(EnvBundlePath); ok {
+		config.BundlePath = value
+	}
+	if value, ok := os.LookupEnv(EnvMetricsAddress); ok {
+		config.MetricsAddress = value
+	}
+	if value, ok := os.LookupEnv(EnvSMTPPassword); ok {
+		config.Alerts.SMTP.Password = value
+	}
+	return nil
+}
+
+// Validate checks that the config can be used to run the service
+func (config *Config) Validate() error {
+	config.ClientID = strings.TrimSpace(config.ClientID)
+	config.UpdateEndpoint = strings.TrimSpace(config.UpdateEndpoint)
+	config.UpdateChannel = strings.TrimSpace(config.UpdateChannel)
+	config.BundlePath = strings.TrimSpace(config.BundlePath)
+	config.MetricsAddress = strings.TrimSpace(config.MetricsAddress)
+
+	if config.ClientID == "" {
+		return errors.New("A client ID must be set, either in the config or by installing the rig")
+	}
+
+	endpoint, err := url.Parse(config.UpdateEndpoint)
+	if err != nil {
+		return fmt.Errorf("The update endpoint '%s' is invalid: %s", config.UpdateEndpoint, err)
+	}
+	if endpoint.Scheme != "https" && endpoint.Scheme != "http" {
+		return fmt.Errorf(
+			"The update endpoint '%s' must be an http or https URL",
+			config.UpdateEndpoint)
+	}
+	if endpoint.Host == "" {
+		return fmt.Errorf("The update endpoint '%s' has no host", config.UpdateEndpoint)
+	}
+
+	if validUpdateChannel.MatchString(config.UpdateChannel) == false {
+		return fmt.Errorf(
+			"The update channel '%s' is invalid. It may only contain lowercase letters, digits, '-' and '_'",
+			config.UpdateChannel)
+	}
+
+	if time.Duration(config.UpdateCheckInterval) < MinUpdateCheckInterval {
+		return fmt.Errorf(
+			"The update check interval '%s' is too short, it must be at least %s",
+			time.Duration(config.UpdateCheckInterval),
+			MinUpdateCheckInterval)
+	}
+
+	if time.Duration(config.VerifyInterval) < time.Minute {
+		return fmt.Errorf(
+			"The verify interval '%s' is too short, it must be at least %s",
+			time.Duration(config.VerifyInterval),
+			time.Minute)
+	}
+
+	if config.CrashLoopExits < 1 {
+		return fmt.Errorf(
+			"The crash loop exits '%d' is invalid, it must be at least 1",
+			config.CrashLoopExits)
+	}
+	if time.Duration(config.CrashLoopWindow) < time.Minute {
+		return fmt.Errorf(
+			"The crash loop window '%s' is too short, it must be at least %s",
+			time.Duration(config.CrashLoopWindow),
+			time.Minute)
+	}
+
+	if time.Duration(config.ShutdownTimeout) <= controllerRequestTimeout {
+		return fmt.Errorf(
+			"The shutdown timeout '%s' is too short, it must be longer than %s",
+			time.Duration(config.ShutdownTimeout),
+			controllerRequestTimeout)
+	}
+
+	if config.MetricsAddress != "" {
+		_, _, err := net.SplitHostPort(config.MetricsAddress)
+		if err != nil {
+			return fmt.Errorf(
+				"The metrics address '%s' is invalid, it must be a host and port such as 'localhost:9630': %s",
+				config.MetricsAddress,
+				err)
+		}
+	}
+
+	config.Idle.Source = strings.ToLower(strings.TrimSpace(config.Idle.Source))
+	if config.Idle.Source == "" {
+		config.Idle.Source = IdleSourceAuto
+	}
+	switch config.Idle.Source {
+	case IdleSourceAuto, IdleSourceX11, IdleSourceLogind, IdleSourceInput:
+	default:
+		return fmt.Errorf(
+			"The idle source '%s' is invalid, it must be '%s', '%s', '%s' or '%s'",
+			config.Idle.Source,
+			IdleSourceAuto,
+			IdleSourceX11,
+			IdleSourceLogind,
+			IdleSourceInput)
+	}
+	if time.Duration(config.Idle.IdleAfter) < MinIdleAfter {
+		return fmt.Errorf(
+			"The idle period '%s' is too short, it must be at least %s",
+			time.Duration(config.Idle.IdleAfter),
+			MinIdleAfter)
+	}
+	if config.Idle.MaxLoad < 0 {
+		return fmt.Errorf(
+			"The maximum load '%g' is invalid, it must be 0 or more",
+			config.Idle.MaxLoad)
+	}
+
+	if config.Thermal.MaxTemperature < 0 {
+		return fmt.Errorf(
+			"The maximum temperature '%g' is invalid, it must be 0 or more",
+			config.Thermal.MaxTemperature)
+	}
+	if config.Thermal.MaxTemperature > 0 && config.Thermal.ResumeTemperature >= config.Thermal.MaxTemperature {
+		return fmt.Errorf(
+			"The resume temperature '%g' is invalid, it must be below the maximum temperature '%g'",
+			config.Thermal.ResumeTemperature,
+			config.Thermal.MaxTemperature)
+	}
+	if config.Thermal.MaxLoad < 0 || config.Thermal.MaxLoad > 1 {
+		return fmt.Errorf(
+			"The maximum thermal load '%g' is invalid, it must be between 0 and 1",
+			config.Thermal.MaxLoad)
+	}
+	if config.Thermal.MaxLoad > 0 && config.Thermal.ResumeLoad >= config.Thermal.MaxLoad {
+		return fmt.Errorf(
+			"The resume load '%g' is invalid, it must be below the maximum thermal load '%g'",
+			config.Thermal.ResumeLoad,
+			config.Thermal.MaxLoad)
+	}
+	if time.Duration(config.Thermal.Interval) < MinThermalInterval {
+		return fmt.Errorf(
+			"The thermal check interval '%s' is too short, it must be at least %s",
+			time.Duration(config.Thermal.Interval),
+			MinThermalInterval)
+	}
+
+	err = config.Alerts.validate()
+	if err != nil {
+		return err
+	}
+
+	if config.BundlePath != "" {
+		_, err := os.Stat(config.BundlePath)
+		if err != nil {
+			return fmt.Errorf("The update bundle '%s' can't be read: %s", config.BundlePath, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the alert thresholds and sinks
+func (alerts *AlertConfig) validate() error {
+	alerts.WebhookURL = strings.TrimSpace(alerts.WebhookURL)
+	alerts.SMTP.Address = strings.TrimSpace(alerts.SMTP.Address)
+
+	if alerts.HashrateDrop < 0 || alerts.HashrateDrop >= 100 {
+		return fmt.Errorf(
+			"The alert hashrate drop '%g' is invalid, it must be a percentage from 0 to below 100",
+			alerts.HashrateDrop)
+	}
+	if alerts.MaxRejectRate < 0 || alerts.MaxRejectRate > 100 {
+		return fmt.Errorf(
+			"The alert reject rate '%g' is invalid, it must be a percentage from 0 to 100",
+			alerts.MaxRejectRate)
+	}
+	if time.Duration(alerts.UnreachableAfter) < MinAlertDelay {
+		return fmt.Errorf(
+			"The alert unreachable period '%s' is too short, it must be at least %s",
+			time.Duration(alerts.UnreachableAfter),
+			MinAlertDelay)
+	}
+	if time.Duration(alerts.StoppedAfter) < MinAlertDelay {
+		return fmt.Errorf(
+			"The alert stopped period '%s' is too short, it must be at least %s",
+			time.Duration(alerts.StoppedAfter),
+			MinAlertDelay)
+	}
+
+	if alerts.WebhookURL != "" {
+		webhook, err := url.Parse(alerts.WebhookURL)
+		if err != nil {
+			return fmt.Errorf("The alert webhook '%s' is invalid: %s", alerts.WebhookURL, err)
+		}
+		if (webhook.Scheme != "https" && webhook.Scheme != "http") || webhook.Host == "" {
+			return fmt.Errorf(
+				"The alert webhook '%s' must be an http or https URL",
+				alerts.WebhookURL)
+		}
+	}
+
+	if alerts.SMTP.Address != "" {
+		_, _, err := net.SplitHostPort(alerts.SMTP.Address)
+		if err != nil {
+			return fmt.Errorf(
+				"The SMTP address '%s' is invalid, it must be a host and port such as 'smtp.example.com:587': %s",
+				alerts.SMTP.Address,
+				err)
+		}
+		if alerts.SMTP.From == "" || len(alerts.SMTP.To) == 0 {
+			return errors.New("The SMTP alert sink needs a from address and at least one to address")
+		}
+	}
+	return nil
+}
+
+// ClientIDFromRigID derives the Unattended client ID from the rig_id file
+// the installers write to the miner-controller directory. The ID stays the
+// same for as long as the rig is registered
+func ClientIDFromRigID(installPath string) (string, error) {
+	rigIDPath := filepath.Join(installPath, "miner-controller", "rig_id")
+	rigIDBytes, err := ioutil.ReadFile(rigIDPath)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read rig ID from '%s': %s", rigIDPath, err)
+	}
+	rigID := strings.TrimSpace(string(rigIDBytes))
+	if rigID == "" {
+		return "", fmt.Errorf("The rig ID in '%s' is empty", rigIDPath)
+	}
+	return fmt.Sprintf("rig-%s", rigID), nil
+}
+
+// InstallPath returns the directory the miner service is installed in
+func InstallPath() (string, error) {
+	executablePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("Unable to get executable path: %s", err)
+	}
+	return filepath.Dir(executablePath), nil
+}
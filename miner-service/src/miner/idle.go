@@ -0,0 +1,116 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"fmt"
+	"time"
+)
+
+// idleInterval is how often the user's activity and the power supply are
+// checked
+const idleInterval = time.Second * 5
+
+// applyIdlePolicy pauses mining while the user is active or the rig runs
+// on battery power until the service stops. Mining resumes once the user
+// has been idle long enough and the rig isn't busy with other work
+func (miner *Miner) applyIdlePolicy() {
+	ticker := time.NewTicker(idleInterval)
+	defer ticker.Stop()
+
+	// The same error would be logged on every check, only changes are
+	// logged
+	lastIdleErr := ""
+	lastBatteryErr := ""
+	for {
+		config := miner.currentConfig().Idle
+
+		if config.PauseOnBattery {
+			onBattery, err := onBatteryPower()
+			if err != nil {
+				if err.Error() != lastBatteryErr {
+					miner.log.Warnf("Unable to read the power supply, not pausing on battery power: %s", err)
+				}
+				lastBatteryErr = err.Error()
+			} else if onBattery {
+				miner.updatePolicy(policyBattery, true, "the rig is running on battery power")
+			} else {
+				miner.updatePolicy(policyBattery, false, "the rig is connected to power")
+			}
+		} else {
+			miner.updatePolicy(policyBattery, false, "pausing on battery power was disabled")
+		}
+
+		if config.Enabled {
+			err := miner.checkIdle(config)
+			if err != nil {
+				if err.Error() != lastIdleErr {
+					miner.log.Warnf("Unable to read the user's idle time, keeping the mining state: %s", err)
+				}
+				lastIdleErr = err.Error()
+			} else {
+				lastIdleErr = ""
+			}
+		} else {
+			miner.updatePolicy(policyIdle, false, "idle mining was disabled")
+		}
+
+		select {
+		case <-miner.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkIdle pauses mining while the user is active. Mining resumes after
+// the user has been idle for the configured period, unless the load shows
+// the rig is busy. The load is only checked while mining is paused, the
+// miners themselves load the rig
+func (miner *Miner) checkIdle(config IdleConfig) error {
+	idle, err := userIdleTime(config.Source)
+	if err != nil {
+		return err
+	}
+	if idle < time.Duration(config.IdleAfter) {
+		miner.updatePolicy(policyIdle, true, "the user is active")
+		return nil
+	}
+
+	if config.MaxLoad > 0 && miner.pausedBy(policyIdle) {
+		load, err := loadPerCPU()
+		if err != nil {
+			miner.log.Debugf("Unable to read the system load: %s", err)
+		} else if load > config.MaxLoad {
+			miner.updatePolicy(
+				policyIdle,
+				true,
+				fmt.Sprintf("the rig is busy with a load of %.2f per CPU", load))
+			return nil
+		}
+	}
+	miner.updatePolicy(
+		policyIdle,
+		false,
+		fmt.Sprintf("the user has been idle for %s", idle.Round(time.Second)))
+	return nil
+}
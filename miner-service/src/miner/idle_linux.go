@@ -0,0 +1,230 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// powerSupplyPath lists the power supplies of the rig
+const powerSupplyPath = "/sys/class/power_supply"
+
+// userIdleTime returns how long the user has been inactive, read from the
+// source. The auto source uses the first source that is available
+func userIdleTime(source string) (time.Duration, error) {
+	switch source {
+	case IdleSourceX11:
+		return x11IdleTime()
+	case IdleSourceLogind:
+		return logindIdleTime()
+	case IdleSourceInput:
+		return inputIdleTime()
+	}
+
+	var failures []string
+	for _, idleTime := range []func() (time.Duration, error){
+		x11IdleTime,
+		logindIdleTime,
+		inputIdleTime,
+	} {
+		idle, err := idleTime()
+		if err == nil {
+			return idle, nil
+		}
+		failures = append(failures, err.Error())
+	}
+	return 0, fmt.Errorf("No idle source is available: %s", strings.Join(failures, ", "))
+}
+
+// x11IdleTime asks the X server for the idle time using xprintidle
+func x11IdleTime() (time.Duration, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return 0, errors.New("no X11 display is set")
+	}
+	output, err := exec.Command("xprintidle").Output()
+	if err != nil {
+		return 0, fmt.Errorf("unable to run xprintidle: %s", err)
+	}
+	milliseconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("xprintidle returned '%s'", strings.TrimSpace(string(output)))
+	}
+	return time.Duration(milliseconds) * time.Millisecond, nil
+}
+
+// logindIdleTime reads the idle hint of the active session on the rig's
+// seat. The service runs outside the user's session, the session is the
+// one shown on seat0 unless XDG_SESSION_ID is set. An error is returned
+// when the desktop doesn't report the idle hint, it would always appear
+// active
+func logindIdleTime() (time.Duration, error) {
+	session := os.Getenv("XDG_SESSION_ID")
+	if session == "" {
+		seat, err := loginctlProperties("show-seat", "seat0", "--property=ActiveSession")
+		if err != nil {
+			return 0, fmt.Errorf("unable to read the logind seat: %s", err)
+		}
+		session = seat["ActiveSession"]
+		if session == "" {
+			return 0, errors.New("no logind session is active on seat0")
+		}
+	}
+	properties, err := loginctlProperties(
+		"show-session",
+		session,
+		"--property=IdleHint",
+		"--property=IdleSinceHint")
+	if err != nil {
+		return 0, fmt.Errorf("unable to read the logind session: %s", err)
+	}
+
+	// IdleSinceHint is in microseconds since the epoch, it is when the
+	// hint last changed and zero if it was never set
+	idleSince, err := strconv.ParseInt(properties["IdleSinceHint"], 10, 64)
+	if err != nil || idleSince == 0 {
+		return 0, fmt.Errorf("the desktop of logind session %s doesn't report the idle hint", session)
+	}
+	if properties["IdleHint"] != "yes" {
+		return 0, nil
+	}
+	return time.Since(time.Unix(0, idleSince*int64(time.Microsecond))), nil
+}
+
+// loginctlProperties runs loginctl with the arguments and returns the
+// properties it prints
+func loginctlProperties(args ...string) (map[string]string, error) {
+	output, err := exec.Command("loginctl", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	properties := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			properties[parts[0]] = parts[1]
+		}
+	}
+	return properties, nil
+}
+
+// inputIdleTime returns the time since an input device was last used,
+// read from the access and modification times of the input devices
+func inputIdleTime() (time.Duration, error) {
+	devices, err := filepath.Glob("/dev/input/event*")
+	if err != nil || len(devices) == 0 {
+		return 0, errors.New("no input devices found in /dev/input")
+	}
+	var lastUsed time.Time
+	for _, device := range devices {
+		var stat syscall.Stat_t
+		if syscall.Stat(device, &stat) != nil {
+			continue
+		}
+		for _, used := range []time.Time{
+			time.Unix(stat.Atim.Unix()),
+			time.Unix(stat.Mtim.Unix()),
+		} {
+			if used.After(lastUsed) {
+				lastUsed = used
+			}
+		}
+	}
+	if lastUsed.IsZero() {
+		return 0, errors.New("unable to read the input devices in /dev/input")
+	}
+	return time.Since(lastUsed), nil
+}
+
+// onBatteryPower checks if the rig runs on battery power. Rigs with a mains
+// supply are on battery power when it is offline, otherwise when a battery
+// is discharging. Batteries of devices such as mice are ignored
+func onBatteryPower() (bool, error) {
+	supplies, err := ioutil.ReadDir(powerSupplyPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	hasMains := false
+	mainsOnline := false
+	discharging := false
+	for _, supply := range supplies {
+		supplyPath := filepath.Join(powerSupplyPath, supply.Name())
+		switch readSysFile(filepath.Join(supplyPath, "type")) {
+		case "Mains":
+			hasMains = true
+			if readSysFile(filepath.Join(supplyPath, "online")) == "1" {
+				mainsOnline = true
+			}
+		case "Battery":
+			if readSysFile(filepath.Join(supplyPath, "scope")) == "Device" {
+				continue
+			}
+			if readSysFile(filepath.Join(supplyPath, "status")) == "Discharging" {
+				discharging = true
+			}
+		}
+	}
+	if hasMains {
+		return mainsOnline == false, nil
+	}
+	return discharging, nil
+}
+
+// loadPerCPU returns the one minute load average divided by the number
+// of CPUs
+func loadPerCPU() (float64, error) {
+	loadBytes, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(loadBytes))
+	if len(fields) == 0 {
+		return 0, errors.New("/proc/loadavg is empty")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return load / float64(runtime.NumCPU()), nil
+}
+
+// readSysFile reads a single value from sysfs, empty if it can't be read
+func readSysFile(path string) string {
+	valueBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(valueBytes))
+}
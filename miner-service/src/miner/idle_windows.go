@@ -0,0 +1,45 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"errors"
+	"time"
+)
+
+// errIdleUnsupported is returned by the idle policy on Windows
+var errIdleUnsupported = errors.New("Idle mining and pausing on battery power are only supported on Linux")
+
+// userIdleTime is not supported on Windows
+func userIdleTime(source string) (time.Duration, error) {
+	return 0, errIdleUnsupported
+}
+
+// onBatteryPower is not supported on Windows
+func onBatteryPower() (bool, error) {
+	return false, errIdleUnsupported
+}
+
+// loadPerCPU is not supported on Windows
+func loadPerCPU() (float64, error) {
+	return 0, errIdleUnsupported
+}
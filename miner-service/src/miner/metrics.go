@@ -0,0 +1,240 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/rpcproto/rpcproto"
+)
+
+// metricsControllerTimeout limits how long a scrape waits for the
+// controller, the controller is reported as down when it doesn't respond
+const metricsControllerTimeout = time.Second * 2
+
+// Results of update checks, used as the result label of the update metrics
+const (
+	updateCheckUpdated  = "updated"
+	updateCheckNoUpdate = "no_update"
+	updateCheckFailed   = "failed"
+)
+
+// serviceHealth holds the controller and update state reported as metrics
+type serviceHealth struct {
+	// controllerVersion is the controller version that was last started
+	controllerVersion string
+	// controllerExits counts the unexpected controller exits
+	controllerExits int
+	// rollbacks counts the controller versions that were rolled back
+	rollbacks int
+	// updateChecks counts the update checks by result
+	updateChecks map[string]int
+	// lastUpdateCheck is when updates were last checked
+	lastUpdateCheck time.Time
+	// lastUpdateResult is the result of the last update check
+	lastUpdateResult string
+}
+
+// recordUpdateCheck records the result of checking for controller updates
+func (miner *Miner) recordUpdateCheck(hasUpdate bool, err error) {
+	result := updateCheckNoUpdate
+	if err != nil {
+		result = updateCheckFailed
+	} else if hasUpdate {
+		result = updateCheckUpdated
+	}
+
+	miner.mutex.Lock()
+	defer miner.mutex.Unlock()
+	if miner.health.updateChecks == nil {
+		miner.health.updateChecks = make(map[string]int)
+	}
+	miner.health.updateChecks[result]++
+	miner.health.lastUpdateCheck = time.Now()
+	miner.health.lastUpdateResult = result
+}
+
+// serveMetrics serves the Prometheus metrics at /metrics on address until
+// the service stops
+func (miner *Miner) serveMetrics(address string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		miner.log.Errorf("Unable to serve metrics on '%s': %s", address, err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", miner.handleMetrics)
+	server := http.Server{
+		Handler:      mux,
+		ReadTimeout:  time.Second * 10,
+		WriteTimeout: time.Second * 10,
+	}
+	go func() {
+		<-miner.stop
+		server.Close()
+	}()
+
+	miner.log.Infof("Serving metrics on http://%s/metrics", listener.Addr())
+	err = server.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
+		miner.log.Errorf("Unable to serve metrics: %s", err)
+	}
+}
+
+// handleMetrics writes the metrics in the Prometheus text format
+func (miner *Miner) handleMetrics(writer http.ResponseWriter, request *http.Request) {
+	var metrics metricsWriter
+
+	miner.mutex.Lock()
+	health := miner.health
+	updateChecks := make(map[string]int)
+	for result, count := range miner.health.updateChecks {
+		updateChecks[result] = count
+	}
+	miner.mutex.Unlock()
+
+	metrics.family("mininghq_service_info", "gauge", "Version of the MiningHQ Miner service")
+	metrics.sample("mininghq_service_info", 1, "version", helper.Version)
+	metrics.family("mininghq_service_uptime_seconds", "gauge", "Time since the MiningHQ Miner service started")
+	metrics.sample("mininghq_service_uptime_seconds", time.Since(miner.started).Seconds())
+
+	metrics.family("mininghq_controller_info", "gauge", "Version of the running miner controller")
+	if health.controllerVersion != "" {
+		metrics.sample("mininghq_controller_info", 1, "version", health.controllerVersion)
+	}
+	metrics.family("mininghq_controller_exits_total", "counter", "Unexpected exits of the miner controller")
+	metrics.sample("mininghq_controller_exits_total", float64(health.controllerExits))
+	metrics.family("mininghq_controller_rollbacks_total", "counter", "Miner controller versions rolled back after crash looping")
+	metrics.sample("mininghq_controller_rollbacks_total", float64(health.rollbacks))
+
+	metrics.family("mininghq_update_checks_total", "counter", "Miner controller update checks by result")
+	for _, result := range []string{updateCheckUpdated, updateCheckNoUpdate, updateCheckFailed} {
+		metrics.sample("mininghq_update_checks_total", float64(updateChecks[result]), "result", result)
+	}
+	if health.lastUpdateCheck.IsZero() == false {
+		metrics.family("mininghq_update_last_check_timestamp_seconds", "gauge", "Time of the last update check")
+		metrics.sample("mininghq_update_last_check_timestamp_seconds", float64(health.lastUpdateCheck.Unix()))
+		metrics.family("mininghq_update_last_check_success", "gauge", "Whether the last update check succeeded")
+		success := 1.0
+		if health.lastUpdateResult == updateCheckFailed {
+			success = 0
+		}
+		metrics.sample("mininghq_update_last_check_success", success)
+	}
+
+	// The controller is asked for the miner stats on every scrape, only the
+	// metrics above are reported while it isn't running
+	err := miner.controllerMetrics(&metrics)
+	metrics.family("mininghq_controller_up", "gauge", "Whether the miner controller responded")
+	if err != nil {
+		miner.log.Debugf("Unable to get metrics from miner-controller: %s", err)
+		metrics.sample("mininghq_controller_up", 0)
+	} else {
+		metrics.sample("mininghq_controller_up", 1)
+	}
+
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer.Write(metrics.buffer.Bytes())
+}
+
+// controllerMetrics writes the mining state and the stats of every miner
+func (miner *Miner) controllerMetrics(metrics *metricsWriter) error {
+	conn, err := miner.dialController(metricsControllerTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsControllerTimeout)
+	defer cancel()
+	client := rpcproto.NewManagerServiceClient(conn)
+	stateResponse, err := client.GetState(ctx, &rpcproto.StateRequest{})
+	if err != nil {
+		return err
+	}
+	statsResponse, err := client.GetStats(ctx, &rpcproto.StatsRequest{})
+	if err != nil {
+		return err
+	}
+
+	metrics.family("mininghq_mining_state", "gauge", "Mining state of the rig, the state label names the value")
+	metrics.sample(
+		"mininghq_mining_state",
+		float64(stateResponse.State),
+		"state", strings.ToLower(stateResponse.State.String()))
+
+	stats := statsResponse.Stats
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Key < stats[j].Key
+	})
+	metrics.family("mininghq_miner_hashrate", "gauge", "Hashrate of the miner in hashes per second")
+	for _, minerStats := range stats {
+		metrics.sample("mininghq_miner_hashrate", minerStats.Hashrate, "miner", minerStats.Key)
+	}
+	metrics.family("mininghq_miner_shares_total", "counter", "Shares submitted by the miner, by pool result")
+	for _, minerStats := range stats {
+		metrics.sample("mininghq_miner_shares_total", float64(minerStats.AcceptedShares), "miner", minerStats.Key, "result", "accepted")
+		metrics.sample("mininghq_miner_shares_total", float64(minerStats.RejectedShares), "miner", minerStats.Key, "result", "rejected")
+	}
+	metrics.family("mininghq_miner_submitted_shares_total", "counter", "Total shares submitted by the miner")
+	for _, minerStats := range stats {
+		metrics.sample("mininghq_miner_submitted_shares_total", float64(minerStats.TotalShares), "miner", minerStats.Key)
+	}
+	return nil
+}
+
+// metricsWriter writes metrics in the Prometheus text format
+type metricsWriter struct {
+	// buffer holds the written metrics
+	buffer bytes.Buffer
+}
+
+// family writes the help and type of a metric, its samples must follow
+func (metrics *metricsWriter) family(name string, metricType string, help string) {
+	fmt.Fprintf(&metrics.buffer, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(&metrics.buffer, "# TYPE %s %s\n", name, metricType)
+}
+
+// sample writes a sample of the metric, labels are name and value pairs
+func (metrics *metricsWriter) sample(name string, value float64, labels ...string) {
+	metrics.buffer.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1])))
+		}
+		fmt.Fprintf(&metrics.buffer, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(&metrics.buffer, " %g\n", value)
+}
+
+// labelEscaper escapes label values as the text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -22,17 +22,35 @@
 package miner
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	unattended "github.com/ProjectLimitless/go-unattended"
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/managerapi"
 	logrus "github.com/sirupsen/logrus"
 )
 
+// badVersionCheckInterval is how often the versions path is checked for
+// rolled back versions downloaded again while the controller runs
+const badVersionCheckInterval = time.Second * 10
+
+const (
+	// restartDelay is the time the rig gets before the controller is
+	// restarted after it exited
+	restartDelay = time.Second * 5
+	// maxRestartDelay limits the delay between restarts of a controller
+	// that keeps crash looping with no version to roll back to
+	maxRestartDelay = time.Minute * 5
+)
+
 // Miner is the primary MiningHQ service on a user's rig that manages and
 // updates the Miner controller
 type Miner struct {
@@ -40,16 +58,47 @@ type Miner struct {
 	log *logrus.Entry
 	// updateWrapper handles the automatic updates of the miner controller
 	updateWrapper *unattended.Unattended
-}
+	// installPath is the directory the service is installed in
+	installPath string
+	// config holds the validated service settings
+	config Config
+	// stop is closed when the service stops to end background tasks
+	stop chan struct{}
+	// stopOnce ensures stop is only closed once
+	stopOnce sync.Once
+	// started is when the service started
+	started time.Time
+	// policies combines the policies that pause mining, it has its own
+	// mutex
+	policies pausePolicies
 
-// New creates a new instance of the Miner
-func New() (*Miner, error) {
-	miner := Miner{}
-	return &miner, nil
+	// mutex guards the fields below, they change while the controller runs
+	mutex sync.Mutex
+	// stopping is set once Stop is called, exits of the controller are
+	// then expected and not counted as crashes
+	stopping bool
+	// configChanged is set when a reloaded config requires a new
+	// update wrapper
+	configChanged bool
+	// health holds the controller and update state reported as metrics
+	health serviceHealth
+	// verifier verifies the controller versions and miners, it is nil
+	// until the service has started
+	verifier *Verifier
 }
 
-// Run starts the miner download and runner
-func (miner *Miner) Run() error {
+// New creates a new instance of the Miner
+func New(installPath string, config Config) (*Miner, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	miner := Miner{
+		installPath: installPath,
+		config:      config,
+		stop:        make(chan struct{}),
+		started:     time.Now(),
+	}
 
 	// TODO Unattended wants a Logrus log, it should rather take a standard
 	// Go log interface
@@ -65,50 +114,369 @@ func (miner *Miner) Run() error {
 	})
 	logrus.SetOutput(os.Stdout)
 
+	// The service runs without a terminal, the log is kept in the
+	// installation directory to include in diagnostics
+	logFile, err := helper.OpenLogFile(
+		filepath.Join(installPath, helper.ServiceLogFilename),
+		helper.MaxServiceLogSize)
+	if err != nil {
+		miner.log.Warnf("Unable to open the service log, logging to stdout only: %s", err)
+	} else {
+		logrus.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	}
+
+	return &miner, nil
+}
+
+// Run starts the miner download and runner
+func (miner *Miner) Run() error {
+
 	// Set up unattended updates
 	miner.log.Info("Setting up Unattended updates")
 
-	executablePath, err := os.Executable()
+	versionsPath := filepath.Join(miner.installPath, "miner-controller")
+	config := miner.currentConfig()
+
+	if config.MetricsAddress != "" {
+		go miner.serveMetrics(config.MetricsAddress)
+	}
+
+	// A local bundle is installed first so that rigs without internet access
+	// have a controller to run. Online updates take over once available
+	if config.BundlePath != "" {
+		installed, err := InstallBundle(config.BundlePath, versionsPath, controllerAppID())
+		if err != nil {
+			miner.log.Errorf("Unable to install local update bundle: %s", err)
+		} else if len(installed) > 0 {
+			miner.log.Infof("Installed miner-controller %s from local bundle", strings.Join(installed, ", "))
+		} else {
+			miner.log.Infof("Local bundle contains no new miner-controller versions")
+		}
+	}
+
+	err := miner.setupUpdateWrapper(config)
+	if err != nil {
+		miner.log.Fatalf("Unable to create Unattended update manager: %s", err)
+	}
+
+	// During construction we check for any updates as well, this has the
+	// side effect that *if* the software isn't available, it will be downloaded
+	hasUpdate, err := miner.updateWrapper.ApplyUpdates()
+	miner.recordUpdateCheck(hasUpdate, err)
+	if err != nil {
+		// If updates can't be applied we can still run an installed version,
+		// it's only a real problem if nothing is installed yet
+		versions, _ := InstalledVersions(versionsPath)
+		if len(versions) == 0 {
+			miner.log.Errorf("Unable to apply controller updates: %s", err)
+			return fmt.Errorf(
+				"Unable to download the miner controller and no local bundle is installed: %s",
+				err)
+		}
+		miner.log.Warnf(
+			"Unable to apply controller updates, running installed version %s: %s",
+			versions[len(versions)-1],
+			err)
+	} else if hasUpdate == false {
+		miner.log.Infof("No updates available for miner-controller")
+	}
+
+	tracker, err := NewVersionTracker(
+		miner.installPath,
+		versionsPath,
+		config.CrashLoopExits,
+		time.Duration(config.CrashLoopWindow))
 	if err != nil {
-		miner.log.Fatalf("Unable to get executable path: %s", err)
+		miner.log.Errorf("Unable to load controller version state: %s", err)
+		return err
+	}
+	// Versions that were rolled back must not run again, even if they were
+	// downloaded again by the update check above
+	for _, version := range tracker.RemoveBadVersions() {
+		miner.log.Warnf("Removed miner-controller %s, it was rolled back earlier", version)
 	}
 
-	basePath := filepath.Dir(executablePath)
+	// Only software signed by MiningHQ may be executed
+	err = miner.setupVerifier(versionsPath)
+	if err != nil {
+		miner.log.Error(err)
+		return err
+	}
 
-	miner.updateWrapper, err = unattended.New(
-		"TEST001", // TODO clientID
+	go miner.collectStats()
+	go miner.applySchedule()
+	go miner.applyIdlePolicy()
+	go miner.applyThermalPolicy()
+	go miner.watchAlerts()
+
+	return miner.supervise(tracker)
+}
+
+// supervise runs the miner controller with updates enabled, restarting it
+// when it exits. A version that crash loops is rolled back to the last
+// known good version. Without a version to roll back to, the controller
+// keeps being restarted with a growing delay, the cause may be transient
+func (miner *Miner) supervise(tracker *VersionTracker) error {
+	delay := restartDelay
+	for {
+		config := miner.currentConfig()
+		window := time.Duration(config.CrashLoopWindow)
+
+		// Settings such as the update endpoint can only be changed by
+		// recreating the update wrapper between runs
+		miner.mutex.Lock()
+		configChanged := miner.configChanged
+		miner.configChanged = false
+		miner.mutex.Unlock()
+		if configChanged {
+			err := miner.setupUpdateWrapper(config)
+			if err != nil {
+				miner.log.Errorf("Unable to apply reloaded config, keeping previous update settings: %s", err)
+			}
+		}
+
+		for _, version := range tracker.RemoveBadVersions() {
+			miner.log.Warnf("Removed miner-controller %s, it was rolled back earlier", version)
+		}
+
+		// Updates downloaded while the previous controller ran, or applied on
+		// reload, are verified before they run
+		err := miner.verifyInstalled(tracker.versionsPath)
+		if err != nil {
+			miner.log.Error(err)
+			return err
+		}
+
+		// The capabilities of the previous controller must not be used for
+		// the next one, it reports its own once its manager API is serving
+		err = managerapi.RemoveCapabilities(miner.installPath)
+		if err != nil {
+			miner.log.Warnf("Unable to remove the manager API capabilities: %s", err)
+		}
+
+		// A version that keeps running for a full crash loop window is healthy
+		version := tracker.CurrentVersion()
+		miner.mutex.Lock()
+		miner.health.controllerVersion = version
+		miner.mutex.Unlock()
+		healthyTimer := time.AfterFunc(window, func() {
+			err := tracker.MarkHealthy(version)
+			if err != nil {
+				miner.log.Errorf("Unable to record healthy controller version: %s", err)
+			}
+		})
+
+		// Start the miner controller with updates enabled. Unattended may
+		// download a rolled back version again while the controller runs
+		guardDone := make(chan struct{})
+		badDownloaded := make(chan string, 1)
+		go miner.guardBadVersions(tracker, badDownloaded, guardDone)
+		// The new controller mines until it is paused again
+		go miner.reapplyPolicies(guardDone)
+		started := time.Now()
+		err = miner.updateWrapper.Run()
+		close(guardDone)
+		healthyTimer.Stop()
+		if miner.isStopping() {
+			miner.log.Info("miner-controller stopped")
+			return nil
+		}
+		select {
+		case bad := <-badDownloaded:
+			// Stopped by the guard, this is not a crash
+			miner.log.Warnf("Restarting miner-controller after removing %s, it was rolled back earlier", bad)
+			continue
+		default:
+		}
+		if err != nil {
+			miner.log.Errorf("Unable to run miner controller %s: %s", version, err)
+		} else {
+			miner.log.Warnf("miner-controller %s exited", version)
+		}
+
+		rollbackTo, rollbackErr := tracker.RecordExit(version, err)
+		miner.mutex.Lock()
+		miner.health.controllerExits++
+		if rollbackTo != "" {
+			miner.health.rollbacks++
+		}
+		miner.mutex.Unlock()
+		exitMessage := fmt.Sprintf("miner-controller %s exited unexpectedly and is being restarted", version)
+		if err != nil {
+			exitMessage = fmt.Sprintf("%s: %s", exitMessage, err)
+		}
+		// A controller that ran for a full window recovered, earlier crash
+		// loops don't delay its restart
+		if time.Since(started) >= window {
+			delay = restartDelay
+		}
+		if rollbackErr != nil && rollbackTo == "" {
+			// Crash looping with nothing to roll back to, the delay doubles
+			// until the controller runs again
+			if delay < maxRestartDelay {
+				delay *= 2
+			}
+			if delay > maxRestartDelay {
+				delay = maxRestartDelay
+			}
+			miner.log.Errorf("%s, restarting in %s", rollbackErr, delay)
+			exitMessage = fmt.Sprintf("%s, restarting in %s", rollbackErr, delay)
+		} else {
+			delay = restartDelay
+		}
+		if rollbackTo != "" {
+			if rollbackErr != nil {
+				miner.log.Errorf("Unable to record rollback: %s", rollbackErr)
+			}
+			miner.log.Warnf(
+				"miner-controller %s is crash looping, rolled back to %s",
+				version,
+				rollbackTo)
+			exitMessage = fmt.Sprintf(
+				"miner-controller %s is crash looping and was rolled back to %s",
+				version,
+				rollbackTo)
+		}
+		miner.sendAlert(config.Alerts, alert{
+			Kind:    alertControllerExited,
+			Title:   "Miner controller exited",
+			Message: exitMessage,
+		})
+
+		// Give the rig a moment before restarting
+		select {
+		case <-miner.stop:
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// guardBadVersions removes rolled back versions that Unattended downloads
+// again while the controller runs, until done is closed. The controller is
+// then restarted so that it can't keep running the bad version, the removed
+// version is sent on downloaded
+func (miner *Miner) guardBadVersions(
+	tracker *VersionTracker,
+	downloaded chan<- string,
+	done <-chan struct{}) {
+
+	ticker := time.NewTicker(badVersionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		removed := tracker.RemoveBadVersions()
+		if len(removed) == 0 {
+			continue
+		}
+		downloaded <- strings.Join(removed, ", ")
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			time.Duration(miner.currentConfig().ShutdownTimeout))
+		err := miner.stopController(ctx)
+		cancel()
+		if err != nil {
+			miner.log.Errorf("Unable to stop miner-controller to remove %s: %s", strings.Join(removed, ", "), err)
+		}
+		return
+	}
+}
+
+// setupUpdateWrapper creates the Unattended update wrapper for the config
+func (miner *Miner) setupUpdateWrapper(config Config) error {
+	miner.log.WithFields(logrus.Fields{
+		"client_id":       config.ClientID,
+		"update_endpoint": config.UpdateEndpoint,
+		"update_channel":  config.UpdateChannel,
+		"update_interval": time.Duration(config.UpdateCheckInterval).String(),
+	}).Debug("Loaded service config")
+
+	updateWrapper, err := unattended.New(
+		config.ClientID,
 		unattended.Target{ // target
-			VersionsPath:   filepath.Join(basePath, "miner-controller"),
-			AppID:          fmt.Sprintf("miner-controller-%s", strings.ToLower(runtime.GOOS)),
-			UpdateEndpoint: "https://unattended.mininghq.io",
-			//UpdateEndpoint:        "https://unattended-old.local",
-			UpdateChannel:         "stable",
+			VersionsPath:          filepath.Join(miner.installPath, "miner-controller"),
+			AppID:                 controllerAppID(),
+			UpdateEndpoint:        config.UpdateEndpoint,
+			UpdateChannel:         config.UpdateChannel,
 			ApplicationName:       "miner-controller",
 			ApplicationParameters: []string{},
 		},
-		time.Hour, // UpdateCheckInterval
+		time.Duration(config.UpdateCheckInterval),
 		miner.log,
 	)
 	if err != nil {
-		miner.log.Fatalf("Unable to create Unattended update manager: %s", err)
+		return err
 	}
+	miner.mutex.Lock()
+	miner.updateWrapper = updateWrapper
+	miner.mutex.Unlock()
+	return nil
+}
 
-	// During construction we check for any updates as well, this has the
-	// side effect that *if* the software isn't available, it will be downloaded
-	hasUpdate, err := miner.updateWrapper.ApplyUpdates()
+// currentConfig returns the config currently in use
+func (miner *Miner) currentConfig() Config {
+	miner.mutex.Lock()
+	defer miner.mutex.Unlock()
+	return miner.config
+}
+
+// controllerAppID returns the Unattended AppID of the controller for
+// this platform
+func controllerAppID() string {
+	return fmt.Sprintf("miner-controller-%s", strings.ToLower(runtime.GOOS))
+}
+
+// setupVerifier creates the verifier for the release public key and keeps
+// re-verifying the installed files in the background. Without a release
+// public key the service refuses to run
+func (miner *Miner) setupVerifier(versionsPath string) error {
+	if ReleasePublicKey == "" {
+		return errNoReleasePublicKey
+	}
+
+	verifier, err := NewVerifier(ReleasePublicKey, miner.installPath, miner.log)
 	if err != nil {
-		// If unattended updates can't be applied, it's a real problem
-		miner.log.Errorf("Unable to apply controller updates: %s", err)
-		panic(err)
+		return err
 	}
-	if hasUpdate == false {
-		miner.log.Infof("No updates available for miner-controller")
+	miner.mutex.Lock()
+	miner.verifier = verifier
+	miner.mutex.Unlock()
+
+	go verifier.Watch(
+		versionsPath,
+		time.Duration(miner.currentConfig().VerifyInterval),
+		miner.stop)
+	return nil
+}
+
+// verifyInstalled verifies the signatures of the installed controller
+// versions and miners, quarantining those that fail. It fails if no
+// verified controller version remains
+func (miner *Miner) verifyInstalled(versionsPath string) error {
+	miner.mutex.Lock()
+	verifier := miner.verifier
+	miner.mutex.Unlock()
+	if verifier == nil {
+		return errNoReleasePublicKey
+	}
+
+	validVersions, err := verifier.VerifyVersions(versionsPath)
+	if err != nil {
+		return fmt.Errorf("Unable to verify miner-controller versions: %s", err)
+	}
+	if len(validVersions) == 0 {
+		return errNoValidVersions
 	}
+	miner.log.Infof("Verified miner-controller %s", validVersions[len(validVersions)-1])
 
-	// Start the miner controller with updates enabled
-	err = miner.updateWrapper.Run()
+	err = verifier.VerifyMiners(filepath.Join(versionsPath, "miners"))
 	if err != nil {
-		miner.log.Errorf("Unable to run miner controller: %s", err)
+		miner.log.Errorf("Unable to verify miners: %s", err)
 	}
-	return err
+	return nil
 }
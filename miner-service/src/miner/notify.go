@@ -0,0 +1,162 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sinkTimeout is the time a webhook or SMTP server gets to accept an alert
+const sinkTimeout = 15 * time.Second
+
+// alert is a rig problem raised or resolved by the alert monitor
+type alert struct {
+	// Kind identifies the problem, one of the alert kinds
+	Kind string `json:"kind"`
+	// Resolved is set when the problem went away
+	Resolved bool `json:"resolved"`
+	// Title summarises the alert
+	Title string `json:"title"`
+	// Message describes the problem
+	Message string `json:"message"`
+	// Rig is the hostname of the rig
+	Rig string `json:"rig"`
+	// Time is when the alert was raised
+	Time time.Time `json:"time"`
+}
+
+// alertSink delivers alerts to the user
+type alertSink interface {
+	// name describes the sink in errors
+	name() string
+	// send delivers the alert
+	send(alert alert) error
+}
+
+// alertSinks returns the sinks enabled in the config. Desktop notifications
+// are shown by the Miner Manager from the alert history, the service runs
+// outside the user's desktop session
+func alertSinks(config AlertConfig) []alertSink {
+	var sinks []alertSink
+	if config.WebhookURL != "" {
+		sinks = append(sinks, webhookSink{url: config.WebhookURL})
+	}
+	if config.SMTP.Address != "" {
+		sinks = append(sinks, smtpSink{config: config.SMTP})
+	}
+	return sinks
+}
+
+// webhookSink posts alerts as JSON to a URL
+type webhookSink struct {
+	// url receives the alerts
+	url string
+}
+
+// name implements alertSink
+func (sink webhookSink) name() string {
+	return "the webhook"
+}
+
+// send implements alertSink
+func (sink webhookSink) send(alert alert) error {
+	alertBytes, err := json.Marshal(&alert)
+	if err != nil {
+		return err
+	}
+	client := http.Client{
+		Timeout: sinkTimeout,
+	}
+	response, err := client.Post(sink.url, "application/json", bytes.NewReader(alertBytes))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("The webhook responded with %s", response.Status)
+	}
+	return nil
+}
+
+// smtpSink emails alerts
+type smtpSink struct {
+	// config holds the server and addresses
+	config SMTPConfig
+}
+
+// name implements alertSink
+func (sink smtpSink) name() string {
+	return "email"
+}
+
+// send implements alertSink. STARTTLS is used when the server supports it
+func (sink smtpSink) send(alert alert) error {
+	host, _, err := net.SplitHostPort(sink.config.Address)
+	if err != nil {
+		return err
+	}
+	for _, address := range append([]string{sink.config.From}, sink.config.To...) {
+		if strings.ContainsAny(address, "\r\n") {
+			return errors.New("SMTP addresses can't contain line breaks")
+		}
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", sink.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(sink.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: [MiningHQ] %s on %s\r\n", alert.Title, alert.Rig)
+	fmt.Fprintf(&message, "Date: %s\r\n", alert.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&message, "%s\r\n\r\nRig: %s\r\nTime: %s\r\n",
+		alert.Message,
+		alert.Rig,
+		alert.Time.Format(time.RFC1123))
+
+	var auth smtp.Auth
+	if sink.config.Username != "" {
+		auth = smtp.PlainAuth("", sink.config.Username, sink.config.Password, host)
+	}
+
+	// smtp.SendMail has no timeout, a server that never answers would
+	// block every later alert
+	result := make(chan error, 1)
+	go func() {
+		result <- smtp.SendMail(sink.config.Address, auth, sink.config.From, sink.config.To, message.Bytes())
+	}()
+	select {
+	case err = <-result:
+		return err
+	case <-time.After(sinkTimeout):
+		return fmt.Errorf("The SMTP server '%s' did not respond within %s", sink.config.Address, sinkTimeout)
+	}
+}
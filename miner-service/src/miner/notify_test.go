@@ -0,0 +1,255 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAlert is the alert the sinks are tested with
+var testAlert = alert{
+	Kind:    alertHashrateDrop,
+	Title:   "Hashrate dropped",
+	Message: "The hashrate averaged 50.00 H/s over the last 5m0s",
+	Rig:     "rig1",
+	Time:    time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC),
+}
+
+// TestWebhookSink checks that the alert is posted as JSON and that
+// responses other than 2xx fail
+func TestWebhookSink(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		expectErr bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "server error", status: http.StatusInternalServerError, expectErr: true},
+		{name: "not found", status: http.StatusNotFound, expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received := make(chan alert, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("Expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+				}
+				var posted alert
+				err := json.NewDecoder(r.Body).Decode(&posted)
+				if err != nil {
+					t.Errorf("Unable to decode the posted alert: %s", err)
+				}
+				received <- posted
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			err := webhookSink{url: server.URL}.send(testAlert)
+			if test.expectErr && err == nil {
+				t.Fatalf("Expected an error for status %d", test.status)
+			}
+			if test.expectErr == false && err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			posted := <-received
+			if reflect.DeepEqual(posted, testAlert) == false {
+				t.Errorf("Expected %+v to be posted, got %+v", testAlert, posted)
+			}
+		})
+	}
+}
+
+// smtpSession is what a fake SMTP server received
+type smtpSession struct {
+	// auth holds the credentials of AUTH PLAIN, separated by NUL
+	auth string
+	// from is the MAIL FROM address
+	from string
+	// to holds the RCPT TO addresses
+	to []string
+	// data is the message
+	data string
+}
+
+// serveSMTP answers a single SMTP session on the listener and sends what
+// it received once the client quits. AUTH PLAIN is offered, STARTTLS is
+// not. Recipients are refused when rejectRecipients is set
+func serveSMTP(listener net.Listener, rejectRecipients bool, received chan<- smtpSession) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(sinkTimeout))
+
+	var session smtpSession
+	defer func() {
+		received <- session
+	}()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH PLAIN "):
+			auth, err := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			if err != nil {
+				text.PrintfLine("501 Invalid credentials")
+				continue
+			}
+			session.auth = string(auth)
+			text.PrintfLine("235 Authenticated")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			session.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			if rejectRecipients {
+				text.PrintfLine("550 No such user")
+				continue
+			}
+			session.to = append(session.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			session.data = string(data)
+			text.PrintfLine("250 Queued")
+		case command == "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+// TestSMTPSink checks the alert email against a fake SMTP server
+func TestSMTPSink(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           SMTPConfig
+		rejectRecipients bool
+		expectErr        bool
+		// expectSession is set when the alert must reach the server
+		expectSession bool
+		// expectAuth is the AUTH PLAIN credentials expected
+		expectAuth string
+	}{
+		{
+			name: "no auth",
+			config: SMTPConfig{
+				From: "rig@example.com",
+				To:   []string{"me@example.com", "ops@example.com"},
+			},
+			expectSession: true,
+		},
+		{
+			name: "plain auth",
+			config: SMTPConfig{
+				Username: "rig@example.com",
+				Password: "secret",
+				From:     "rig@example.com",
+				To:       []string{"me@example.com"},
+			},
+			expectSession: true,
+			expectAuth:    "\x00rig@example.com\x00secret",
+		},
+		{
+			name: "rejected recipient",
+			config: SMTPConfig{
+				From: "rig@example.com",
+				To:   []string{"me@example.com"},
+			},
+			rejectRecipients: true,
+			expectErr:        true,
+		},
+		{
+			name: "line break in address",
+			config: SMTPConfig{
+				From: "rig@example.com",
+				To:   []string{"me@example.com\r\nBcc: other@example.com"},
+			},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			received := make(chan smtpSession, 1)
+			go serveSMTP(listener, test.rejectRecipients, received)
+
+			config := test.config
+			config.Address = listener.Addr().String()
+			err = smtpSink{config: config}.send(testAlert)
+			if test.expectErr && err == nil {
+				t.Fatal("Expected an error")
+			}
+			if test.expectErr == false && err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if test.expectSession == false {
+				return
+			}
+
+			session := <-received
+			if session.auth != test.expectAuth {
+				t.Errorf("Expected the credentials %q, got %q", test.expectAuth, session.auth)
+			}
+			if session.from != config.From || reflect.DeepEqual(session.to, config.To) == false {
+				t.Errorf("Expected mail from %s to %v, got %s to %v", config.From, config.To, session.from, session.to)
+			}
+			for _, expected := range []string{
+				"To: " + strings.Join(config.To, ", "),
+				"Subject: [MiningHQ] Hashrate dropped on rig1",
+				testAlert.Message,
+			} {
+				if strings.Contains(session.data, expected) == false {
+					t.Errorf("Expected the message to contain %q, got %q", expected, session.data)
+				}
+			}
+		})
+	}
+}
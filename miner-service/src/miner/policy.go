@@ -0,0 +1,178 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/rpcproto/rpcproto"
+)
+
+// Policies that pause mining, used as the source of a pause request
+const (
+	// policySchedule pauses mining on the mining schedule
+	policySchedule = "schedule"
+	// policyIdle pauses mining while the user is active
+	policyIdle = "idle"
+	// policyBattery pauses mining on battery power
+	policyBattery = "battery"
+	// policyThermal throttles mining while the rig runs hot or is busy
+	policyThermal = "thermal"
+)
+
+// policyRetryInterval is how often a restarted controller is asked to
+// pause mining again until it is reachable
+const policyRetryInterval = time.Second * 2
+
+// pausePolicies combines the policies that pause mining. Mining is paused
+// while any policy asks for it and resumed once none do. The controller is
+// only asked to change state when the combined decision changes, so mining
+// paused or resumed manually stays that way until then. A restarted
+// controller is told the decision again, it starts mining otherwise
+type pausePolicies struct {
+	// mutex guards the fields below, policies run in their own goroutines
+	mutex sync.Mutex
+	// pausing maps the policies asking to pause mining to their reason
+	pausing map[string]string
+	// paused is set once mining was paused by the policies
+	paused bool
+	// applied is set once the running controller was told the combined
+	// decision
+	applied bool
+}
+
+// updatePolicy records whether the policy asks to pause mining and applies
+// the combined decision. Policies call it on every check, a decision that
+// couldn't be applied is retried then
+func (miner *Miner) updatePolicy(policy string, pause bool, reason string) {
+	policies := &miner.policies
+	policies.mutex.Lock()
+	defer policies.mutex.Unlock()
+
+	if policies.pausing == nil {
+		policies.pausing = make(map[string]string)
+	}
+	if pause {
+		policies.pausing[policy] = reason
+	} else {
+		delete(policies.pausing, policy)
+	}
+
+	shouldPause := len(policies.pausing) > 0
+	if shouldPause == policies.paused {
+		miner.reapplyPoliciesLocked()
+		return
+	}
+
+	state := rpcproto.MinerState_ResumeMining
+	eventType := "resumed"
+	message := fmt.Sprintf("Mining resumed, %s", reason)
+	if shouldPause {
+		state = rpcproto.MinerState_PauseMining
+		eventType = "paused"
+		var reasons []string
+		for _, pauseReason := range policies.pausing {
+			reasons = append(reasons, pauseReason)
+		}
+		sort.Strings(reasons)
+		message = fmt.Sprintf("Mining paused, %s", strings.Join(reasons, " and "))
+	}
+
+	// The controller may not be running yet, the decision is applied on
+	// the next check
+	err := miner.setMiningState(context.Background(), state)
+	if err != nil {
+		miner.log.Debugf("Unable to apply %s policy, retrying: %s", policy, err)
+		return
+	}
+	policies.paused = shouldPause
+	policies.applied = true
+
+	miner.log.Info(message)
+	err = helper.AppendEvent(filepath.Join(miner.installPath, helper.PauseHistoryFilename), helper.Event{
+		Type:    eventType,
+		Message: message,
+	})
+	if err != nil {
+		miner.log.Errorf("Unable to record pause history: %s", err)
+	}
+}
+
+// reapplyPolicies tells the controller started by supervise the combined
+// decision, retrying until it is reachable or done is closed
+func (miner *Miner) reapplyPolicies(done <-chan struct{}) {
+	miner.policies.mutex.Lock()
+	miner.policies.applied = false
+	miner.policies.mutex.Unlock()
+
+	ticker := time.NewTicker(policyRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		miner.policies.mutex.Lock()
+		applied := miner.reapplyPoliciesLocked()
+		miner.policies.mutex.Unlock()
+		if applied {
+			return
+		}
+	}
+}
+
+// reapplyPoliciesLocked pauses mining again on a restarted controller if
+// the policies paused it, the mutex must be held. It returns true once the
+// controller was told
+func (miner *Miner) reapplyPoliciesLocked() bool {
+	policies := &miner.policies
+	if policies.applied {
+		return true
+	}
+	if policies.paused {
+		err := miner.setMiningState(context.Background(), rpcproto.MinerState_PauseMining)
+		if err != nil {
+			miner.log.Debugf("Unable to pause the restarted miner controller, retrying: %s", err)
+			return false
+		}
+		miner.log.Info("Mining paused again after the miner controller restarted")
+	}
+	policies.applied = true
+	return true
+}
+
+// pausedBy checks if the policy is asking to pause mining
+func (miner *Miner) pausedBy(policy string) bool {
+	miner.policies.mutex.Lock()
+	defer miner.policies.mutex.Unlock()
+	_, pausing := miner.policies.pausing[policy]
+	return pausing
+}
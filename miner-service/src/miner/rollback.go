@@ -0,0 +1,252 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+)
+
+// versionState is persisted to track the health of controller versions
+// across restarts of the service
+type versionState struct {
+	// LastKnownGood is the newest version that ran without crash looping
+	LastKnownGood string `json:"last_known_good"`
+	// Bad lists the versions that were rolled back. They are removed
+	// whenever Unattended downloads them again
+	Bad []string `json:"bad"`
+}
+
+// VersionTracker tracks the health of the installed controller versions
+// and rolls back versions that crash loop after an update
+type VersionTracker struct {
+	// versionsPath is the Unattended versions path
+	versionsPath string
+	// installPath is the installation directory of the service
+	installPath string
+	// maxExits is the number of exits within window that is a crash loop
+	maxExits int
+	// window is the period exits are counted in. A version running longer
+	// than window is considered healthy
+	window time.Duration
+	// now returns the current time
+	now func() time.Time
+
+	// mutex guards state and exits
+	mutex sync.Mutex
+	state versionState
+	// exits holds the times each version exited within the last window
+	exits map[string][]time.Time
+}
+
+// NewVersionTracker creates a new tracker, loading the saved version
+// state from the installation directory
+func NewVersionTracker(
+	installPath string,
+	versionsPath string,
+	maxExits int,
+	window time.Duration) (*VersionTracker, error) {
+
+	tracker := VersionTracker{
+		installPath:  installPath,
+		versionsPath: versionsPath,
+		maxExits:     maxExits,
+		window:       window,
+		now:          time.Now,
+		exits:        make(map[string][]time.Time),
+	}
+
+	stateBytes, err := ioutil.ReadFile(filepath.Join(installPath, helper.ControllerVersionsFilename))
+	if err != nil && os.IsNotExist(err) == false {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(stateBytes, &tracker.state)
+		if err != nil {
+			return nil, fmt.Errorf("The controller version state is malformed: %s", err)
+		}
+	}
+	return &tracker, nil
+}
+
+// CurrentVersion returns the version Unattended will run, the newest
+// installed version
+func (tracker *VersionTracker) CurrentVersion() string {
+	versions, err := InstalledVersions(tracker.versionsPath)
+	if err != nil || len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1]
+}
+
+// RemoveBadVersions removes any version marked as bad that was
+// downloaded again. It returns the versions that were removed
+func (tracker *VersionTracker) RemoveBadVersions() []string {
+	tracker.mutex.Lock()
+	bad := append([]string{}, tracker.state.Bad...)
+	tracker.mutex.Unlock()
+
+	var removed []string
+	for _, version := range bad {
+		versionPath := filepath.Join(tracker.versionsPath, version)
+		if _, err := os.Stat(versionPath); err != nil {
+			continue
+		}
+		if os.RemoveAll(versionPath) == nil {
+			removed = append(removed, version)
+		}
+	}
+	return removed
+}
+
+// MarkHealthy records version as the last known good version
+func (tracker *VersionTracker) MarkHealthy(version string) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if version == "" || tracker.state.LastKnownGood == version {
+		return nil
+	}
+	tracker.state.LastKnownGood = version
+	return tracker.save()
+}
+
+// IsBad checks if version was rolled back
+func (tracker *VersionTracker) IsBad(version string) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	for _, bad := range tracker.state.Bad {
+		if bad == version {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordExit records that version exited. When the exits of version
+// complete a crash loop and an older version is available, version is
+// rolled back and the version that now runs is returned. It returns an
+// error if the controller is crash looping with no version to roll back to
+func (tracker *VersionTracker) RecordExit(version string, exitErr error) (string, error) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	// Exits are counted per version, an update that crashes must not be
+	// rolled back for the exits of the version before it
+	now := tracker.now()
+	var recent []time.Time
+	for _, exitTime := range append(tracker.exits[version], now) {
+		if now.Sub(exitTime) <= tracker.window {
+			recent = append(recent, exitTime)
+		}
+	}
+	tracker.exits[version] = recent
+
+	if len(recent) < tracker.maxExits {
+		return "", nil
+	}
+
+	// Crash looping, find the version to roll back to
+	if version == "" || version == tracker.state.LastKnownGood {
+		return "", fmt.Errorf(
+			"miner-controller %s exited %d times within %s and there is no older version to roll back to: %s",
+			version,
+			len(recent),
+			tracker.window,
+			exitErr)
+	}
+
+	versions, err := InstalledVersions(tracker.versionsPath)
+	if err != nil {
+		return "", err
+	}
+	rollbackTo := ""
+	for _, installed := range versions {
+		if installed == tracker.state.LastKnownGood {
+			rollbackTo = installed
+			break
+		}
+		if compareVersions(installed, version) < 0 {
+			rollbackTo = installed
+		}
+	}
+	if rollbackTo == "" {
+		return "", fmt.Errorf(
+			"miner-controller %s exited %d times within %s and no previous version is installed: %s",
+			version,
+			len(recent),
+			tracker.window,
+			exitErr)
+	}
+
+	// Remove every version newer than the one we roll back to so that
+	// Unattended runs it, only the crashing version is marked as bad
+	for _, installed := range versions {
+		if compareVersions(installed, rollbackTo) <= 0 {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(tracker.versionsPath, installed))
+		if err != nil {
+			return "", fmt.Errorf("Unable to remove miner-controller %s: %s", installed, err)
+		}
+	}
+	tracker.state.Bad = append(tracker.state.Bad, version)
+	delete(tracker.exits, version)
+
+	err = tracker.save()
+	if err != nil {
+		return rollbackTo, err
+	}
+	err = helper.AppendEvent(
+		filepath.Join(tracker.installPath, helper.RollbackHistoryFilename),
+		helper.Event{
+			Type:    "rollback",
+			Version: version,
+			Message: fmt.Sprintf(
+				"miner-controller %s crashed %d times within %s, rolled back to %s. Last error: %v",
+				version,
+				tracker.maxExits,
+				tracker.window,
+				rollbackTo,
+				exitErr),
+		})
+	return rollbackTo, err
+}
+
+// save writes the version state to the installation directory
+func (tracker *VersionTracker) save() error {
+	stateBytes, err := json.MarshalIndent(&tracker.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(
+		filepath.Join(tracker.installPath, helper.ControllerVersionsFilename),
+		stateBytes,
+		0644)
+}
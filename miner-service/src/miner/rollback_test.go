@@ -0,0 +1,239 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+)
+
+// testExit is an exit of a controller version at a time after the start
+// of a test
+type testExit struct {
+	version string
+	at      time.Duration
+}
+
+func TestRecordExit(t *testing.T) {
+	tests := []struct {
+		name string
+		// versions are installed before the exits
+		versions      []string
+		lastKnownGood string
+		exits         []testExit
+		// rollbackTo is the result of the last exit
+		rollbackTo string
+		expectErr  bool
+		// installed are the versions left installed
+		installed []string
+		// bad are the versions marked as bad
+		bad []string
+	}{
+		{
+			name:          "fewer exits than a crash loop",
+			versions:      []string{"1.0.0", "1.1.0"},
+			lastKnownGood: "1.0.0",
+			exits:         []testExit{{"1.1.0", 0}, {"1.1.0", time.Minute}},
+			installed:     []string{"1.0.0", "1.1.0"},
+		},
+		{
+			name:          "rollback to the last known good version",
+			versions:      []string{"1.0.0", "1.1.0", "1.2.0"},
+			lastKnownGood: "1.0.0",
+			exits:         []testExit{{"1.2.0", 0}, {"1.2.0", time.Minute}, {"1.2.0", time.Minute * 2}},
+			rollbackTo:    "1.0.0",
+			installed:     []string{"1.0.0"},
+			bad:           []string{"1.2.0"},
+		},
+		{
+			name:       "rollback to the next older version",
+			versions:   []string{"1.0.0", "1.1.0", "1.2.0"},
+			exits:      []testExit{{"1.2.0", 0}, {"1.2.0", time.Minute}, {"1.2.0", time.Minute * 2}},
+			rollbackTo: "1.1.0",
+			installed:  []string{"1.0.0", "1.1.0"},
+			bad:        []string{"1.2.0"},
+		},
+		{
+			name:          "numeric version order",
+			versions:      []string{"1.9.0", "1.10.0"},
+			lastKnownGood: "",
+			exits:         []testExit{{"1.10.0", 0}, {"1.10.0", time.Minute}, {"1.10.0", time.Minute * 2}},
+			rollbackTo:    "1.9.0",
+			installed:     []string{"1.9.0"},
+			bad:           []string{"1.10.0"},
+		},
+		{
+			name:          "last known good version crash loops",
+			versions:      []string{"1.0.0", "1.1.0"},
+			lastKnownGood: "1.1.0",
+			exits:         []testExit{{"1.1.0", 0}, {"1.1.0", time.Minute}, {"1.1.0", time.Minute * 2}},
+			expectErr:     true,
+			installed:     []string{"1.0.0", "1.1.0"},
+		},
+		{
+			name:      "only version crash loops",
+			versions:  []string{"1.2.0"},
+			exits:     []testExit{{"1.2.0", 0}, {"1.2.0", time.Minute}, {"1.2.0", time.Minute * 2}},
+			expectErr: true,
+			installed: []string{"1.2.0"},
+		},
+		{
+			name:          "exits spread over the window",
+			versions:      []string{"1.0.0", "1.1.0"},
+			lastKnownGood: "1.0.0",
+			exits:         []testExit{{"1.1.0", 0}, {"1.1.0", time.Minute * 6}, {"1.1.0", time.Minute * 12}},
+			installed:     []string{"1.0.0", "1.1.0"},
+		},
+		{
+			name:          "exits of other versions",
+			versions:      []string{"1.0.0", "1.1.0", "1.2.0"},
+			lastKnownGood: "1.0.0",
+			exits:         []testExit{{"1.1.0", 0}, {"1.1.0", time.Minute}, {"1.2.0", time.Minute * 2}},
+			installed:     []string{"1.0.0", "1.1.0", "1.2.0"},
+		},
+	}
+
+	start := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			installPath, err := ioutil.TempDir("", "rollback")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(installPath)
+			versionsPath := filepath.Join(installPath, "miner-controller")
+			for _, version := range append(test.versions, "miners") {
+				err = os.MkdirAll(filepath.Join(versionsPath, version), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tracker, err := NewVersionTracker(installPath, versionsPath, 3, time.Minute*10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tracker.MarkHealthy(test.lastKnownGood)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := start
+			tracker.now = func() time.Time {
+				return now
+			}
+
+			var rollbackTo string
+			for i, exit := range test.exits {
+				now = start.Add(exit.at)
+				rollbackTo, err = tracker.RecordExit(exit.version, errors.New("exit status 2"))
+				if i < len(test.exits)-1 && (rollbackTo != "" || err != nil) {
+					t.Fatalf("Expected exit %d to be recorded only, got '%s' %v", i, rollbackTo, err)
+				}
+			}
+			if test.expectErr && err == nil {
+				t.Fatal("Expected an error")
+			}
+			if test.expectErr == false && err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if rollbackTo != test.rollbackTo {
+				t.Errorf("Expected a rollback to '%s', got '%s'", test.rollbackTo, rollbackTo)
+			}
+
+			installed, err := InstalledVersions(versionsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(installed, test.installed) == false {
+				t.Errorf("Expected the installed versions %v, got %v", test.installed, installed)
+			}
+			for _, version := range test.bad {
+				if tracker.IsBad(version) == false {
+					t.Errorf("Expected %s to be marked as bad", version)
+				}
+			}
+
+			// The state and the rollback are kept across restarts
+			reloaded, err := NewVersionTracker(installPath, versionsPath, 3, time.Minute*10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(reloaded.state.Bad, tracker.state.Bad) == false {
+				t.Errorf("Expected the bad versions %v after reloading, got %v", tracker.state.Bad, reloaded.state.Bad)
+			}
+			events, err := helper.ReadEvents(filepath.Join(installPath, helper.RollbackHistoryFilename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.rollbackTo == "" && len(events) != 0 {
+				t.Errorf("Expected no rollback events, got %+v", events)
+			}
+			if test.rollbackTo != "" && (len(events) != 1 || events[0].Version != test.bad[0]) {
+				t.Errorf("Expected a rollback event for %s, got %+v", test.bad[0], events)
+			}
+		})
+	}
+}
+
+func TestRemoveBadVersions(t *testing.T) {
+	installPath, err := ioutil.TempDir("", "rollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(installPath)
+	versionsPath := filepath.Join(installPath, "miner-controller")
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		err = os.MkdirAll(filepath.Join(versionsPath, version), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracker, err := NewVersionTracker(installPath, versionsPath, 1, time.Minute*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollbackTo, err := tracker.RecordExit("1.1.0", nil)
+	if err != nil || rollbackTo != "1.0.0" {
+		t.Fatalf("Expected a rollback to 1.0.0, got '%s' %v", rollbackTo, err)
+	}
+
+	// Unattended downloads the bad version again
+	err = os.MkdirAll(filepath.Join(versionsPath, "1.1.0"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := tracker.RemoveBadVersions()
+	if reflect.DeepEqual(removed, []string{"1.1.0"}) == false {
+		t.Errorf("Expected 1.1.0 to be removed, got %v", removed)
+	}
+	installed, err := InstalledVersions(versionsPath)
+	if err != nil || reflect.DeepEqual(installed, []string{"1.0.0"}) == false {
+		t.Errorf("Expected only 1.0.0 to be installed, got %v %v", installed, err)
+	}
+}
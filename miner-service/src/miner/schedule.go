@@ -0,0 +1,84 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mininghq/miner/helper/schedule"
+)
+
+// scheduleInterval is how often the mining schedule is checked
+const scheduleInterval = time.Second * 30
+
+// applySchedule pauses and resumes mining on the rig's schedule until the
+// service stops. The schedule is reloaded when its file changes
+func (miner *Miner) applySchedule() {
+	schedulePath := filepath.Join(miner.installPath, schedule.Filename)
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	var current schedule.Schedule
+	loaded := false
+	var loadedModTime time.Time
+	for {
+		info, err := os.Stat(schedulePath)
+		modTime := time.Time{}
+		if err == nil {
+			modTime = info.ModTime()
+		}
+		if loaded == false || modTime.Equal(loadedModTime) == false {
+			reloaded, err := schedule.Load(schedulePath)
+			if err != nil {
+				miner.log.Errorf("Unable to load the mining schedule, keeping the previous schedule: %s", err)
+			} else {
+				if loaded {
+					miner.log.Info("Reloaded the mining schedule")
+				}
+				current = reloaded
+			}
+			loaded = true
+			loadedModTime = modTime
+		}
+
+		if current.Enabled {
+			action, rule := current.ActionAt(time.Now())
+			reason := "as scheduled outside of the schedule's times"
+			if rule != nil {
+				reason = fmt.Sprintf("as scheduled from %s to %s", rule.Start, rule.End)
+			}
+			miner.updatePolicy(policySchedule, action == schedule.ActionPause, reason)
+		} else {
+			miner.updatePolicy(policySchedule, false, "the mining schedule was disabled")
+		}
+
+		select {
+		case <-miner.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
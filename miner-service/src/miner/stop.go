@@ -0,0 +1,213 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/managerapi"
+	"github.com/mininghq/rpcproto/rpcproto"
+	ps "github.com/mitchellh/go-ps"
+	"google.golang.org/grpc"
+)
+
+// ControllerAddress is the address of the miner controller's manager API
+const ControllerAddress = helper.ManagerAddress
+
+// controllerRequestTimeout limits how long we wait for the controller to
+// respond to a stop request, it leaves the rest of the shutdown timeout
+// for the processes to exit
+const controllerRequestTimeout = time.Second * 5
+
+// Stop stops the controller and its miners. The controller is asked to stop
+// mining, then every child process is asked to exit. Processes still running
+// when ctx is done are killed
+func (miner *Miner) Stop(ctx context.Context) error {
+	miner.mutex.Lock()
+	miner.stopping = true
+	miner.mutex.Unlock()
+	miner.stopOnce.Do(func() {
+		close(miner.stop)
+	})
+
+	miner.log.Info("Stopping miner-controller")
+
+	return miner.stopController(ctx)
+}
+
+// stopController stops the controller and its miners without stopping the
+// service, supervise restarts the controller unless the service is stopping.
+// Processes still running when ctx is done are killed
+func (miner *Miner) stopController(ctx context.Context) error {
+	// Stopping mining first lets the miners shut down cleanly
+	err := miner.stopMining(ctx)
+	if err != nil {
+		miner.log.Warnf("Unable to ask miner-controller to stop mining: %s", err)
+	}
+
+	children, err := childProcesses(os.Getpid())
+	if err != nil {
+		return fmt.Errorf("Unable to find the miner-controller processes: %s", err)
+	}
+	for _, pid := range children {
+		process, err := os.FindProcess(pid)
+		if err != nil {
+			continue
+		}
+		// Not supported on Windows, those processes are killed below
+		process.Signal(syscall.SIGTERM)
+	}
+
+	// Wait for the processes to exit, kill them when we run out of time
+	ticker := time.NewTicker(time.Millisecond * 250)
+	defer ticker.Stop()
+	for {
+		running := runningProcesses(children)
+		if len(running) == 0 {
+			miner.log.Info("miner-controller stopped cleanly")
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+
+		miner.log.Warnf("%d processes did not exit in time, killing them", len(running))
+		var killErr error
+		for _, pid := range running {
+			// The grace period is over, kill immediately
+			_, err = helper.KillProcessTree(pid, 0)
+			if err != nil {
+				killErr = fmt.Errorf("Unable to kill process %d: %s", pid, err)
+				miner.log.Error(killErr)
+			}
+		}
+		return killErr
+	}
+}
+
+// Reload replaces the config of the running service and checks for
+// updates immediately. Update settings take effect when the controller
+// is next restarted
+func (miner *Miner) Reload(config Config) error {
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+
+	miner.mutex.Lock()
+	miner.config = config
+	miner.configChanged = true
+	updateWrapper := miner.updateWrapper
+	miner.mutex.Unlock()
+
+	miner.log.Info("Reloaded service config")
+
+	if updateWrapper == nil {
+		return nil
+	}
+	hasUpdate, err := updateWrapper.ApplyUpdates()
+	miner.recordUpdateCheck(hasUpdate, err)
+	if err != nil {
+		return fmt.Errorf("Unable to apply controller updates: %s", err)
+	}
+	if hasUpdate == false {
+		miner.log.Info("No updates available for miner-controller")
+		return nil
+	}
+	// The update only runs once the controller restarts, it is verified
+	// now so that a bad release is quarantined right away
+	return miner.verifyInstalled(filepath.Join(miner.installPath, "miner-controller"))
+}
+
+// isStopping checks if Stop has been called
+func (miner *Miner) isStopping() bool {
+	miner.mutex.Lock()
+	defer miner.mutex.Unlock()
+	return miner.stopping
+}
+
+// stopMining asks the controller to stop all miners
+func (miner *Miner) stopMining(ctx context.Context) error {
+	return miner.setMiningState(ctx, rpcproto.MinerState_StopMining)
+}
+
+// setMiningState asks the controller to change the mining state
+func (miner *Miner) setMiningState(ctx context.Context, state rpcproto.MinerState) error {
+	ctx, cancel := context.WithTimeout(ctx, controllerRequestTimeout)
+	defer cancel()
+
+	conn, err := managerapi.DialContext(ctx, miner.installPath, ControllerAddress, grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := rpcproto.NewManagerServiceClient(conn)
+	_, err = client.SetState(ctx, &rpcproto.StateRequest{
+		State: state,
+	})
+	return err
+}
+
+// childProcesses returns the PIDs of all the descendants of pid, children
+// before grandchildren
+func childProcesses(pid int) ([]int, error) {
+	processes, err := ps.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	var children []int
+	parents := []int{pid}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+		for _, process := range processes {
+			if process.PPid() == parent && process.Pid() != parent {
+				children = append(children, process.Pid())
+				parents = append(parents, process.Pid())
+			}
+		}
+	}
+	return children, nil
+}
+
+// runningProcesses returns the PIDs in pids that are still running
+func runningProcesses(pids []int) []int {
+	var running []int
+	for _, pid := range pids {
+		process, err := ps.FindProcess(pid)
+		if err == nil && process != nil {
+			running = append(running, pid)
+		}
+	}
+	return running
+}
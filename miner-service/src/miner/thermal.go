@@ -0,0 +1,281 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+)
+
+// temperatureReading is the temperature of a single sensor
+type temperatureReading struct {
+	// Sensor names the sensor, ie. 'coretemp Package id 0'
+	Sensor string
+	// Celsius is the temperature in °C
+	Celsius float64
+}
+
+// loadSampler measures the share of the CPUs used by processes other than
+// the service, the controller and the miners between samples
+type loadSampler struct {
+	// sampled is set once the first sample was taken
+	sampled bool
+	// total is the CPU time of all CPUs at the last sample
+	total uint64
+	// busy is the CPU time not spent idle at the last sample
+	busy uint64
+	// own is the CPU time used by the service and its children at the
+	// last sample
+	own uint64
+}
+
+// sample returns the share of the CPUs, from 0 to 1, used by other
+// processes since the last sample. It returns false for the first sample
+func (sampler *loadSampler) sample() (float64, bool, error) {
+	total, busy, err := readCPUTimes()
+	if err != nil {
+		return 0, false, err
+	}
+	own, err := ownCPUTime()
+	if err != nil {
+		return 0, false, err
+	}
+
+	previous := *sampler
+	*sampler = loadSampler{
+		sampled: true,
+		total:   total,
+		busy:    busy,
+		own:     own,
+	}
+	if previous.sampled == false || total <= previous.total {
+		return 0, false, nil
+	}
+
+	// Children that exited take their CPU time with them, the miners'
+	// share can't be more than all the busy time
+	busyDelta := float64(busy - previous.busy)
+	ownDelta := float64(0)
+	if own > previous.own {
+		ownDelta = float64(own - previous.own)
+	}
+	if ownDelta > busyDelta {
+		ownDelta = busyDelta
+	}
+	return (busyDelta - ownDelta) / float64(total-previous.total), true, nil
+}
+
+// thermalState is the outcome of a thermal check
+type thermalState struct {
+	// hottest is the hottest sensor, nil if temperatures are ignored or
+	// couldn't be read
+	hottest *temperatureReading
+	// load is the share of the CPUs used by other processes
+	load float64
+	// loadKnown is set if load was measured
+	loadKnown bool
+}
+
+// applyThermalPolicy throttles mining while a temperature sensor or the
+// load of other processes is at its limit until the service stops. Mining
+// resumes once every reading is back at its resume threshold, the gap
+// between the two prevents mining from flapping on and off
+func (miner *Miner) applyThermalPolicy() {
+	sampler := loadSampler{}
+	throttled := false
+	reason := ""
+	// The same error would be logged on every check, only changes are
+	// logged
+	lastErr := ""
+	for {
+		config := miner.currentConfig().Thermal
+
+		if config.Enabled {
+			state, err := miner.checkThermal(config, &sampler)
+			if err != nil {
+				if err.Error() != lastErr {
+					miner.log.Warnf("Unable to read the rig's temperatures or load: %s", err)
+				}
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+			}
+
+			if throttled == false {
+				if overLimit, limitReason := state.overLimit(config); overLimit {
+					throttled = true
+					reason = limitReason
+					miner.recordThrottle(true, fmt.Sprintf("Mining throttled, %s", reason))
+				}
+			} else if state.belowResume(config) {
+				throttled = false
+				reason = state.describe(config)
+				miner.recordThrottle(false, fmt.Sprintf("Mining unthrottled, %s", reason))
+			}
+		} else if throttled {
+			throttled = false
+			reason = "thermal throttling was disabled"
+			miner.recordThrottle(false, fmt.Sprintf("Mining unthrottled, %s", reason))
+		}
+		// Applied on every check so that a state the controller didn't
+		// accept is retried
+		miner.updatePolicy(policyThermal, throttled, reason)
+
+		select {
+		case <-miner.stop:
+			return
+		case <-time.After(time.Duration(config.Interval)):
+		}
+	}
+}
+
+// checkThermal reads the temperatures and load the config has limits for.
+// Readings that fail are left out of the state and the error is returned
+func (miner *Miner) checkThermal(config ThermalConfig, sampler *loadSampler) (thermalState, error) {
+	var state thermalState
+	var failures []string
+
+	if config.MaxTemperature > 0 {
+		readings, err := readTemperatures()
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+		for _, reading := range readings {
+			if matchesSensor(reading.Sensor, config.Sensors) == false {
+				continue
+			}
+			if state.hottest == nil || reading.Celsius > state.hottest.Celsius {
+				hottest := reading
+				state.hottest = &hottest
+			}
+		}
+		if err == nil && state.hottest == nil {
+			failures = append(failures, "no temperature sensors match the config")
+		}
+	}
+
+	if config.MaxLoad > 0 {
+		load, ok, err := sampler.sample()
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+		state.load = load
+		state.loadKnown = ok
+	}
+
+	if len(failures) > 0 {
+		return state, fmt.Errorf("%s", strings.Join(failures, ", "))
+	}
+	return state, nil
+}
+
+// overLimit checks if a reading is at its limit and describes it
+func (state thermalState) overLimit(config ThermalConfig) (bool, string) {
+	if config.MaxTemperature > 0 && state.hottest != nil && state.hottest.Celsius >= config.MaxTemperature {
+		return true, fmt.Sprintf(
+			"%s reached %.1f°C, the limit is %g°C",
+			state.hottest.Sensor,
+			state.hottest.Celsius,
+			config.MaxTemperature)
+	}
+	if config.MaxLoad > 0 && state.loadKnown && state.load >= config.MaxLoad {
+		return true, fmt.Sprintf(
+			"other processes use %.0f%% of the CPUs, the limit is %.0f%%",
+			state.load*100,
+			config.MaxLoad*100)
+	}
+	return false, ""
+}
+
+// belowResume checks if every reading is back at its resume threshold.
+// Readings that are unavailable keep mining throttled
+func (state thermalState) belowResume(config ThermalConfig) bool {
+	if config.MaxTemperature > 0 {
+		if state.hottest == nil || state.hottest.Celsius > config.ResumeTemperature {
+			return false
+		}
+	}
+	if config.MaxLoad > 0 {
+		if state.loadKnown == false || state.load > config.ResumeLoad {
+			return false
+		}
+	}
+	return true
+}
+
+// describe describes the readings the config has limits for
+func (state thermalState) describe(config ThermalConfig) string {
+	var readings []string
+	if config.MaxTemperature > 0 && state.hottest != nil {
+		readings = append(readings, fmt.Sprintf(
+			"the hottest sensor %s is at %.1f°C",
+			state.hottest.Sensor,
+			state.hottest.Celsius))
+	}
+	if config.MaxLoad > 0 && state.loadKnown {
+		readings = append(readings, fmt.Sprintf(
+			"other processes use %.0f%% of the CPUs",
+			state.load*100))
+	}
+	if len(readings) == 0 {
+		return "the limits were removed"
+	}
+	return strings.Join(readings, " and ")
+}
+
+// recordThrottle logs the throttle event and records it in the throttle
+// history the manager displays
+func (miner *Miner) recordThrottle(throttled bool, message string) {
+	eventType := "unthrottled"
+	if throttled {
+		eventType = "throttled"
+		miner.log.Warn(message)
+	} else {
+		miner.log.Info(message)
+	}
+	err := helper.AppendEvent(filepath.Join(miner.installPath, helper.ThrottleHistoryFilename), helper.Event{
+		Type:    eventType,
+		Message: message,
+	})
+	if err != nil {
+		miner.log.Errorf("Unable to record throttle history: %s", err)
+	}
+}
+
+// matchesSensor checks if the sensor name contains one of the filters, any
+// sensor matches when there are no filters
+func matchesSensor(sensor string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	sensor = strings.ToLower(sensor)
+	for _, filter := range filters {
+		if strings.Contains(sensor, strings.ToLower(strings.TrimSpace(filter))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mininghq/miner/helper"
+)
+
+// Sensors outside this range in °C are disconnected or misreporting
+const (
+	minValidTemperature = -40
+	maxValidTemperature = 150
+)
+
+// readTemperatures reads the temperature sensors exposed by the kernel in
+// /sys/class/hwmon, which includes the CPUs and most GPUs, and the thermal
+// zones in /sys/class/thermal
+func readTemperatures() ([]temperatureReading, error) {
+	var readings []temperatureReading
+
+	// Sensors such as temp1_input report millidegrees, temp1_label names them
+	inputs, _ := filepath.Glob("/sys/class/hwmon/hwmon*/temp*_input")
+	for _, input := range inputs {
+		celsius, ok := readMillidegrees(input)
+		if ok == false {
+			continue
+		}
+		device := filepath.Dir(input)
+		name := readSysFile(filepath.Join(device, "name"))
+		if name == "" {
+			name = filepath.Base(device)
+		}
+		sensor := strings.TrimSuffix(filepath.Base(input), "_input")
+		label := readSysFile(filepath.Join(device, sensor+"_label"))
+		if label == "" {
+			label = sensor
+		}
+		readings = append(readings, temperatureReading{
+			Sensor:  fmt.Sprintf("%s %s", name, label),
+			Celsius: celsius,
+		})
+	}
+
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*")
+	for _, zone := range zones {
+		celsius, ok := readMillidegrees(filepath.Join(zone, "temp"))
+		if ok == false {
+			continue
+		}
+		name := readSysFile(filepath.Join(zone, "type"))
+		if name == "" {
+			name = filepath.Base(zone)
+		}
+		readings = append(readings, temperatureReading{
+			Sensor:  name,
+			Celsius: celsius,
+		})
+	}
+
+	if len(readings) == 0 {
+		return nil, errors.New("no temperature sensors found in /sys/class/hwmon or /sys/class/thermal")
+	}
+	return readings, nil
+}
+
+// readMillidegrees reads a sysfs temperature in millidegrees as °C
+func readMillidegrees(path string) (float64, bool) {
+	millidegrees, err := strconv.ParseInt(readSysFile(path), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	celsius := float64(millidegrees) / 1000
+	if celsius <= minValidTemperature || celsius >= maxValidTemperature {
+		return 0, false
+	}
+	return celsius, true
+}
+
+// readCPUTimes returns the total CPU time of all CPUs and the time not
+// spent idle, in clock ticks from /proc/stat
+func readCPUTimes() (uint64, uint64, error) {
+	statBytes, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(statBytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		// user nice system idle iowait irq softirq steal, guest time is
+		// already counted in user and nice
+		var total, idle uint64
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			ticks, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("Unable to parse /proc/stat: %s", err)
+			}
+			total += ticks
+			if i == 3 || i == 4 {
+				idle += ticks
+			}
+		}
+		return total, total - idle, nil
+	}
+	return 0, 0, errors.New("/proc/stat has no CPU totals")
+}
+
+// ownCPUTime returns the CPU time used by the service and its children,
+// the controller and the miners, in clock ticks. The time of children
+// that exited is included through their parents
+func ownCPUTime() (uint64, error) {
+	tree, err := helper.ProcessTree(os.Getpid())
+	if err != nil {
+		return 0, err
+	}
+	var ticks uint64
+	for _, pid := range tree {
+		statBytes, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			// The process exited since the tree was read
+			continue
+		}
+		// The executable name is in brackets and may contain spaces,
+		// utime, stime, cutime and cstime are the 12th to 15th fields
+		// after it
+		stat := string(statBytes)
+		fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+		if len(fields) < 15 {
+			continue
+		}
+		for _, field := range fields[11:15] {
+			value, err := strconv.ParseInt(field, 10, 64)
+			if err == nil && value > 0 {
+				ticks += uint64(value)
+			}
+		}
+	}
+	return ticks, nil
+}
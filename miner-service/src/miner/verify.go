@@ -0,0 +1,358 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mininghq/miner/helper"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// ReleasePublicKey is the base64 encoded ed25519 public key MiningHQ signs
+// releases with. It is pinned at build time using
+//
+//	-ldflags "-X github.com/mininghq/miner/miner-service/src/miner.ReleasePublicKey=<key>"
+//
+// so that it can't be changed without replacing the service itself
+var ReleasePublicKey string
+
+// SignatureExtension is appended to a file's name to find its detached
+// signature. The signature file contains the base64 encoded ed25519
+// signature of the file's contents
+const SignatureExtension = ".sig"
+
+// QuarantineDirectory is the directory in the installation path that
+// files failing verification are moved to
+const QuarantineDirectory = "quarantine"
+
+// errNoValidVersions is returned when no installed miner-controller version
+// passed verification
+var errNoValidVersions = errors.New(
+	"No verified miner-controller version is installed, refusing to run unverified software")
+
+// errNoReleasePublicKey is returned when the service was built without a
+// release public key
+var errNoReleasePublicKey = errors.New(
+	"This build has no release public key, refusing to run unverified software. " +
+		"Build the service with RELEASE_PUBLIC_KEY set")
+
+// Verifier verifies the signatures of the miner-controller releases and the
+// miners it downloads before they are executed
+type Verifier struct {
+	// publicKey is the key releases must be signed with
+	publicKey ed25519.PublicKey
+	// installPath is the installation directory of the service
+	installPath string
+	// log is the service log
+	log *logrus.Entry
+
+	// mutex guards verified
+	mutex sync.Mutex
+	// verified maps the path of every verified file to the SHA256 checksum
+	// it had when verified. It is used to detect files changing on disk
+	verified map[string]string
+}
+
+// NewVerifier creates a new verifier for the given base64 encoded
+// ed25519 public key
+func NewVerifier(
+	publicKey string,
+	installPath string,
+	log *logrus.Entry) (*Verifier, error) {
+
+	keyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("The release public key is invalid: %s", err)
+	}
+	if len(keyBytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf(
+			"The release public key must be %d bytes, got %d",
+			ed25519.PublicKeySize,
+			len(keyBytes))
+	}
+
+	verifier := Verifier{
+		publicKey:   ed25519.PublicKey(keyBytes),
+		installPath: installPath,
+		log:         log,
+		verified:    make(map[string]string),
+	}
+	return &verifier, nil
+}
+
+// VerifyFile checks the file against its detached signature and returns
+// the SHA256 checksum of the verified contents
+func (verifier *Verifier) VerifyFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	signatureBytes, err := ioutil.ReadFile(path + SignatureExtension)
+	if err != nil {
+		return "", fmt.Errorf("No signature found for '%s': %s", path, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signatureBytes)))
+	if err != nil {
+		return "", fmt.Errorf("The signature of '%s' is malformed: %s", path, err)
+	}
+	if ed25519.Verify(verifier.publicKey, contents, signature) == false {
+		return "", fmt.Errorf("The signature of '%s' is invalid", path)
+	}
+	checksum := sha256.Sum256(contents)
+	return hex.EncodeToString(checksum[:]), nil
+}
+
+// VerifyVersions verifies every file in every installed miner-controller
+// version. Versions that fail are quarantined, the versions that passed
+// are returned from oldest to newest
+func (verifier *Verifier) VerifyVersions(versionsPath string) ([]string, error) {
+	versions, err := InstalledVersions(versionsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var valid []string
+	for _, version := range versions {
+		versionPath := filepath.Join(versionsPath, version)
+		err = verifier.verifyTree(versionPath)
+		if err != nil {
+			verifier.quarantine(versionPath, version, err)
+			continue
+		}
+		valid = append(valid, version)
+	}
+	return valid, nil
+}
+
+// VerifyMiners verifies every executable in the miners directory,
+// quarantining those that fail
+func (verifier *Verifier) VerifyMiners(minersPath string) error {
+	return filepath.Walk(minersPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() == false || isExecutable(path, info) == false {
+			return nil
+		}
+		checksum, err := verifier.VerifyFile(path)
+		if err != nil {
+			verifier.quarantine(path, "", err)
+			return nil
+		}
+		verifier.remember(path, checksum)
+		return nil
+	})
+}
+
+// Watch periodically re-verifies the installed versions and miners until
+// stop is closed. Files that changed since they were verified or that fail
+// verification are logged, recorded in the integrity history and
+// quarantined
+func (verifier *Verifier) Watch(
+	versionsPath string,
+	interval time.Duration,
+	stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		verifier.log.Debug("Re-verifying installed files")
+		verifier.detectChanges()
+
+		_, err := verifier.VerifyVersions(versionsPath)
+		if err != nil {
+			verifier.log.Errorf("Unable to verify miner-controller versions: %s", err)
+		}
+		err = verifier.VerifyMiners(filepath.Join(versionsPath, "miners"))
+		if err != nil {
+			verifier.log.Errorf("Unable to verify miners: %s", err)
+		}
+	}
+}
+
+// detectChanges compares the files verified earlier to their current
+// contents, alerting on any changes
+func (verifier *Verifier) detectChanges() {
+	verifier.mutex.Lock()
+	verified := make(map[string]string, len(verifier.verified))
+	for path, checksum := range verifier.verified {
+		verified[path] = checksum
+	}
+	verifier.mutex.Unlock()
+
+	for path, expected := range verified {
+		contents, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			// Removed by an update or quarantined
+			verifier.forget(path)
+			continue
+		}
+		if err != nil {
+			verifier.log.Warnf("Unable to read '%s' for verification: %s", path, err)
+			continue
+		}
+		checksum := sha256.Sum256(contents)
+		if hex.EncodeToString(checksum[:]) == expected {
+			continue
+		}
+
+		// The file changed after it was installed. A valid signature means it
+		// was replaced by a newer official release, anything else is tampering
+		current, err := verifier.VerifyFile(path)
+		if err != nil {
+			verifier.quarantine(path, "", fmt.Errorf("'%s' changed after it was installed: %s", path, err))
+			continue
+		}
+		verifier.log.Infof("'%s' was replaced by a validly signed release", path)
+		verifier.remember(path, current)
+	}
+}
+
+// verifyTree verifies every regular file in root, signature files
+// themselves are skipped
+func (verifier *Verifier) verifyTree(root string) error {
+
+	checksums := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() == false || strings.HasSuffix(path, SignatureExtension) {
+			return nil
+		}
+		checksum, err := verifier.VerifyFile(path)
+		if err != nil {
+			return err
+		}
+		checksums[path] = checksum
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(checksums) == 0 {
+		return fmt.Errorf("'%s' contains no files", root)
+	}
+	for path, checksum := range checksums {
+		verifier.remember(path, checksum)
+	}
+	return nil
+}
+
+// quarantine moves a file or directory that failed verification out of
+// reach of the controller and records the failure
+func (verifier *Verifier) quarantine(path string, version string, reason error) {
+	verifier.log.Errorf("Verification failed, quarantining '%s': %s", path, reason)
+
+	quarantinePath := filepath.Join(verifier.installPath, QuarantineDirectory)
+	target := filepath.Join(
+		quarantinePath,
+		fmt.Sprintf("%d-%s", time.Now().Unix(), filepath.Base(path)))
+
+	message := fmt.Sprintf("Quarantined '%s': %s", path, reason)
+	err := os.MkdirAll(quarantinePath, 0700)
+	if err == nil {
+		err = os.Rename(path, target)
+	}
+	if err != nil {
+		// If we can't move it, removing it is the only safe option left
+		verifier.log.Errorf("Unable to quarantine '%s', removing it: %s", path, err)
+		os.RemoveAll(path)
+		message = fmt.Sprintf("Removed '%s': %s", path, reason)
+	}
+	// The signature is quarantined along with a single file
+	if _, err := os.Stat(path + SignatureExtension); err == nil {
+		os.Rename(path+SignatureExtension, target+SignatureExtension)
+	}
+
+	verifier.forgetTree(path)
+
+	err = helper.AppendEvent(
+		filepath.Join(verifier.installPath, helper.IntegrityHistoryFilename),
+		helper.Event{
+			Type:    "quarantined",
+			Version: version,
+			Path:    path,
+			Message: message,
+		})
+	if err != nil {
+		verifier.log.Errorf("Unable to record integrity event: %s", err)
+	}
+}
+
+// remember records the checksum of a verified file
+func (verifier *Verifier) remember(path string, checksum string) {
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	verifier.verified[path] = checksum
+}
+
+// forget removes a file from the verified files
+func (verifier *Verifier) forget(path string) {
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	delete(verifier.verified, path)
+}
+
+// forgetTree removes a file or a directory and all its files from the
+// verified files
+func (verifier *Verifier) forgetTree(root string) {
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	prefix := root + string(filepath.Separator)
+	for path := range verifier.verified {
+		if path == root || strings.HasPrefix(path, prefix) {
+			delete(verifier.verified, path)
+		}
+	}
+}
+
+// isExecutable checks if a file can be executed on this platform
+func isExecutable(path string, info os.FileInfo) bool {
+	if strings.ToLower(runtime.GOOS) == "windows" {
+		return strings.EqualFold(filepath.Ext(path), ".exe")
+	}
+	return info.Mode().Perm()&0111 != 0
+}
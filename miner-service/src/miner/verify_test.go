@@ -0,0 +1,238 @@
+/*
+  MiningHQ Miner - The MiningHQ Miner service
+  https://mininghq.io
+
+  Copyright (C) 2018  Donovan Solms     <https://github.com/donovansolms>
+                                        <https://github.com/mininghq>
+
+  This program is free software: you can redistribute it and/or modify
+  it under the terms of the GNU General Public License as published by
+  the Free Software Foundation, either version 3 of the License, or
+  (at your option) any later version.
+
+  This program is distributed in the hope that it will be useful,
+  but WITHOUT ANY WARRANTY; without even the implied warranty of
+  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+  GNU General Public License for more details.
+
+  You should have received a copy of the GNU General Public License
+  along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package miner
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mininghq/miner/helper"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// testVerifier creates a verifier for a new key in installPath and returns
+// the key releases are signed with
+func testVerifier(t *testing.T, installPath string) (*Verifier, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	verifier, err := NewVerifier(
+		base64.StdEncoding.EncodeToString(publicKey),
+		installPath,
+		logrus.NewEntry(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier, privateKey
+}
+
+// writeSigned writes contents to path with its detached signature
+func writeSigned(t *testing.T, path string, contents string, key ed25519.PrivateKey) {
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(contents)))
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(contents), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path+SignatureExtension, []byte(signature+"\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyVersions(t *testing.T) {
+	tests := []struct {
+		name string
+		// change modifies version 1.1.0 after it was signed
+		change func(t *testing.T, versionPath string)
+		// quarantined is set when 1.1.0 must fail verification
+		quarantined bool
+	}{
+		{
+			name:   "valid signature",
+			change: func(t *testing.T, versionPath string) {},
+		},
+		{
+			name: "tampered file",
+			change: func(t *testing.T, versionPath string) {
+				err := ioutil.WriteFile(filepath.Join(versionPath, "miner-controller"), []byte("tampered"), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			quarantined: true,
+		},
+		{
+			name: "missing signature",
+			change: func(t *testing.T, versionPath string) {
+				err := os.Remove(filepath.Join(versionPath, "lib", "libminer.so"+SignatureExtension))
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			quarantined: true,
+		},
+		{
+			name: "unsigned file added",
+			change: func(t *testing.T, versionPath string) {
+				err := ioutil.WriteFile(filepath.Join(versionPath, "extra"), []byte("extra"), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			quarantined: true,
+		},
+		{
+			name: "signed with another key",
+			change: func(t *testing.T, versionPath string) {
+				_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeSigned(t, filepath.Join(versionPath, "miner-controller"), "controller 1.1.0", otherKey)
+			},
+			quarantined: true,
+		},
+		{
+			name: "malformed signature",
+			change: func(t *testing.T, versionPath string) {
+				err := ioutil.WriteFile(filepath.Join(versionPath, "miner-controller"+SignatureExtension), []byte("not base64!"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			quarantined: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			installPath, err := ioutil.TempDir("", "verify")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(installPath)
+			versionsPath := filepath.Join(installPath, "miner-controller")
+			verifier, key := testVerifier(t, installPath)
+
+			for _, version := range []string{"1.0.0", "1.1.0"} {
+				versionPath := filepath.Join(versionsPath, version)
+				writeSigned(t, filepath.Join(versionPath, "miner-controller"), "controller "+version, key)
+				writeSigned(t, filepath.Join(versionPath, "lib", "libminer.so"), "library "+version, key)
+			}
+			test.change(t, filepath.Join(versionsPath, "1.1.0"))
+
+			valid, err := verifier.VerifyVersions(versionsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []string{"1.0.0", "1.1.0"}
+			if test.quarantined {
+				expected = []string{"1.0.0"}
+			}
+			if reflect.DeepEqual(valid, expected) == false {
+				t.Fatalf("Expected the valid versions %v, got %v", expected, valid)
+			}
+
+			// A quarantined version is moved out of the versions path and
+			// recorded in the integrity history
+			installed, err := InstalledVersions(versionsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(installed, expected) == false {
+				t.Errorf("Expected the installed versions %v, got %v", expected, installed)
+			}
+			quarantined, _ := filepath.Glob(filepath.Join(installPath, QuarantineDirectory, "*-1.1.0"))
+			events, err := helper.ReadEvents(filepath.Join(installPath, helper.IntegrityHistoryFilename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.quarantined == false {
+				if len(quarantined) != 0 || len(events) != 0 {
+					t.Errorf("Expected nothing to be quarantined, got %v and %d events", quarantined, len(events))
+				}
+				return
+			}
+			if len(quarantined) != 1 {
+				t.Fatalf("Expected 1.1.0 to be moved to the quarantine directory, got %v", quarantined)
+			}
+			if _, err := os.Stat(filepath.Join(quarantined[0], "miner-controller")); err != nil {
+				t.Errorf("Expected the files of 1.1.0 in quarantine: %s", err)
+			}
+			if len(events) != 1 || events[0].Type != "quarantined" || events[0].Version != "1.1.0" {
+				t.Errorf("Expected a quarantined event for 1.1.0, got %+v", events)
+			}
+		})
+	}
+}
+
+func TestVerifyMiners(t *testing.T) {
+	installPath, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(installPath)
+	minersPath := filepath.Join(installPath, "miner-controller", "miners")
+	verifier, key := testVerifier(t, installPath)
+
+	signed := filepath.Join(minersPath, "xmrig", "xmrig.exe")
+	writeSigned(t, signed, "xmrig", key)
+	tampered := filepath.Join(minersPath, "other", "other.exe")
+	writeSigned(t, tampered, "other", key)
+	err = ioutil.WriteFile(tampered, []byte("tampered"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = verifier.VerifyMiners(minersPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(signed); err != nil {
+		t.Errorf("Expected the signed miner to be kept: %s", err)
+	}
+	if _, err := os.Stat(tampered); os.IsNotExist(err) == false {
+		t.Errorf("Expected the tampered miner to be quarantined")
+	}
+	// The signature is quarantined along with the miner
+	quarantined, _ := filepath.Glob(filepath.Join(installPath, QuarantineDirectory, "*"))
+	var names []string
+	for _, path := range quarantined {
+		names = append(names, filepath.Base(path))
+	}
+	if len(names) != 2 ||
+		strings.HasSuffix(names[0], "-other.exe") == false ||
+		strings.HasSuffix(names[1], "-other.exe"+SignatureExtension) == false {
+		t.Errorf("Expected the miner and its signature in quarantine, got %v", names)
+	}
+}
@@ -7,6 +7,12 @@ PURPLE='\033[0;35m'
 YELLOW='\033[1;33m'
 NC='\033[0m' # No Color
 
+# The miner service refuses to run without the release public key
+if [ -z "${RELEASE_PUBLIC_KEY}" ]; then
+  printf "${RED}RELEASE_PUBLIC_KEY must be set to the base64 encoded release public key${NC}\n"
+  exit 1
+fi
+
 printf "\n${LIGHTGREEN}Compiling MiningHQ Miner for Windows${NC}\n\n"
 # printf "${YELLOW}Building service installer${NC}\n"
 # cd install-service
@@ -32,13 +32,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"runtime"
-	"strings"
 
+	"github.com/mininghq/miner/helper"
+	"github.com/mininghq/miner/helper/state"
 	homedir "github.com/mitchellh/go-homedir"
 )
 
@@ -51,78 +51,52 @@ const (
 // main is the main runnable of the application
 func main() {
 
-	homeDir, err := homedir.Dir()
-	if err != nil {
-		fmt.Printf("Unable to get user home directory: %s\n", err)
-	}
+	output := flag.String("output", helper.OutputText, "Output format, 'text' or 'json' for one JSON event per step")
+	flag.Parse()
 
-	mhqInstaller, err := NewInstaller(homeDir, runtime.GOOS, apiEndpoint)
+	progress, err := helper.NewProgress(*output)
 	if err != nil {
-		fmt.Printf("Unable to create installer: %s\n", err)
-		return
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	if isInstalled() == false {
-		fmt.Println("MiningHQ is not installed.")
-		return
-
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		fmt.Fprintf(progress.Output(), "Unable to get user home directory: %s\n", err)
 	}
 
-	// Get the current installed path
-	installedCheckfilePath := filepath.Join(homeDir, ".mhqpath")
-	installedPath, err := ioutil.ReadFile(installedCheckfilePath)
+	mhqInstaller, err := NewInstaller(homeDir, runtime.GOOS, apiEndpoint)
 	if err != nil {
-		fmt.Printf(`
-We were unable to find the installed location for the MiningHQ services. Please
-remove the files manually where you installed the services.
-		`)
-		fmt.Println()
-		os.Exit(0)
+		fmt.Fprintf(progress.Output(), "Unable to create installer: %s\n", err)
+		progress.Finish(1, err)
+		os.Exit(1)
 	}
 
-	err = mhqInstaller.Uninstall(strings.TrimSpace(string(installedPath)), installedCheckfilePath)
-	if err != nil {
-		fmt.Println("ERR", err)
+	// Get the current installation, a legacy ~/.mhqpath is migrated
+	record, err := state.Load(homeDir)
+	if err == state.ErrNotInstalled || (err == nil && record.Installed() == false) {
+		fmt.Fprintln(progress.Output(), "MiningHQ is not installed.")
+		progress.Finish(0, nil)
 		return
 	}
-
-	os.Exit(0)
-
-}
-
-// isInstalled checks if the Miner Manager has been installed already.
-//
-// The Miner Manager acts as both installer and manager. We need to decide
-// which one to execute based on the installed services
-func isInstalled() bool {
-	// We created a file $USERHOME/.mhqpath containing the installation dir
-	// If the path exists in .mhqpath then the services are installed
-	homeDir, err := homedir.Dir()
+	progress.Start("find_installation", "")
 	if err != nil {
-		fmt.Printf(
-			`Unable to find your home directory: %s\n
-
-Please contact our support via our help channels listed at https://www.mininghq.io/help
-`, err)
+		progress.Fail(err, `
+We were unable to find the installed location for the MiningHQ services. Please
+remove the files manually where you installed the services.`)
+		progress.Finish(1, err)
 		os.Exit(1)
 	}
+	progress.OK(record.InstallPath)
 
-	installedCheckfilePath := filepath.Join(homeDir, ".mhqpath")
-	installedPath, err := ioutil.ReadFile(installedCheckfilePath)
-	if err != nil {
-		// if the mhqpath file doesn't exist, nothing is installed
-		return false
-	}
-	// Check if installedPath exists
-	info, err := os.Stat(strings.TrimSpace(string(installedPath)))
+	// The uninstaller reports failures to the user itself
+	err = mhqInstaller.Uninstall(record, progress)
 	if err != nil {
-		return false
+		progress.Finish(1, err)
+		os.Exit(1)
 	}
 
-	// If it is a directory, then the services should be installed
-	if info.IsDir() {
-		return true
-	}
+	progress.Finish(0, nil)
+	os.Exit(0)
 
-	return false
 }
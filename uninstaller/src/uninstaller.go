@@ -32,10 +32,9 @@ import (
 	"time"
 
 	"github.com/ProtonMail/go-autostart"
-	"github.com/fatih/color"
 	"github.com/mininghq/miner-controller/src/mhq"
 	"github.com/mininghq/miner/helper"
-	ps "github.com/mitchellh/go-ps"
+	"github.com/mininghq/miner/helper/state"
 )
 
 const (
@@ -85,16 +84,21 @@ func NewInstaller(homeDir string, os string, mhqEndpoint string) (*Installer, er
 }
 
 // Uninstall uninstalls the miner manager and services using
-// a synchronous process
+// a synchronous process. The result of every step is reported to progress
 func (installer *Installer) Uninstall(
-	installedPath string,
-	installedPathFilepath string) error {
+	record *state.Record,
+	progress *helper.Progress) error {
+
+	installedPath := record.InstallPath
+
+	// In JSON mode stdout is reserved for the progress events
+	out := progress.Output()
 
 	// Note: This will not be the prettiest code you'll ever see :)
 	// If anyone has some good advice in controlling the output for this process,
 	// feel free to let me know
 
-	fmt.Printf(`
+	fmt.Fprintf(out, `
     __  ____      _           __ ______
    /  |/  (_)__  (_)__  ___ _/ // / __ \
   / /|_/ / / _ \/ / _ \/ _ '/ _  / /_/ /
@@ -141,15 +145,7 @@ We detected the installation in '%s'
 	// 	}
 
 	// Stop the service
-	fmt.Print("Stopping services\t\t\t")
-	var processesToKill []string
-	if strings.ToLower(runtime.GOOS) == "windows" {
-		processesToKill = append(processesToKill, "miner-service.exe")
-	} else {
-		processesToKill = append(processesToKill, "miner-cont")
-		processesToKill = append(processesToKill, "miner-serv")
-	}
-
+	progress.Start("stop_services", "Stopping services\t\t\t")
 	stopError := fmt.Sprintf(`
 We were unable to stop the MiningHQ services. Please stop the
 services manually.
@@ -159,37 +155,21 @@ the issue. Support can be contacted via our help channels listed at
 https://www.mininghq.io/help
 `)
 
-	for _, processName := range processesToKill {
-		processReference, err := installer.findProcessByName(processName)
-		if err != nil {
-			color.HiYellow("NOTICE")
-			fmt.Printf(`
+	terminated, findErr, killErr := helper.StopServices()
+	if killErr != nil {
+		// If we can't stop the services, continue with the rest of the
+		// removal anyways
+		progress.Fail(killErr, stopError)
+	} else if len(terminated) == 0 && findErr != nil {
+		progress.Notice(findErr, `
 We were unable to find running MiningHQ services, they might be stopped already.
-Uninstall will continue...
-`)
-			fmt.Printf(color.HiYellowString(
-				"Include the following message if you contact support '%s'"), err.Error())
-			fmt.Println()
-			fmt.Println()
-			color.Unset()
-		} else {
-			err = helper.KillProcess(processReference.Pid())
-			if err != nil {
-				color.HiRed("FAIL")
-				fmt.Println(stopError)
-				fmt.Printf(color.HiRedString(
-					"Include the following error in your report '%s'"), err.Error())
-				fmt.Println()
-				fmt.Println()
-				color.Unset()
-			} else {
-				color.HiGreen("OK")
-			}
-		}
+Uninstall will continue...`)
+	} else {
+		progress.OK(fmt.Sprintf("Terminated processes %v", terminated))
 	}
 
 	// Remove the service
-	fmt.Print("Deregister rig\t\t\t\t")
+	progress.Start("deregister_rig", "Deregister rig\t\t\t\t")
 	miningKeyPath := filepath.Join(installedPath, "miner-controller", "mining_key")
 	rigIDPath := filepath.Join(installedPath, "miner-controller", "rig_id")
 	apiCreateError := fmt.Sprintf(`
@@ -199,39 +179,36 @@ Please check that the file '%s' and '%s' is present in your installation directo
 		miningKeyPath,
 		rigIDPath)
 	miningKeyBytes, miningKeyErr := ioutil.ReadFile(miningKeyPath)
-	rigIDBytes, rigIDErr := ioutil.ReadFile(rigIDPath)
+	// The rig ID is in the installation record, older installations only
+	// have the rig ID file
+	var rigIDBytes []byte
+	var rigIDErr error
+	if record.RigID != "" {
+		rigIDBytes = []byte(record.RigID)
+	} else {
+		rigIDBytes, rigIDErr = ioutil.ReadFile(rigIDPath)
+	}
 	if miningKeyErr != nil || rigIDErr != nil {
-		color.HiRed("FAIL")
-		fmt.Println(apiCreateError)
-		if miningKeyErr != nil {
-			fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), miningKeyErr.Error())
-		} else if rigIDErr != nil {
-			fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), rigIDErr.Error())
+		err := miningKeyErr
+		if err == nil {
+			err = rigIDErr
 		}
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
+		progress.Fail(err, apiCreateError)
+		return err
 	}
 	miningKey := strings.TrimSpace(string(miningKeyBytes))
 	rigID := strings.TrimSpace(string(rigIDBytes))
 	apiClient, err := mhq.NewClient(miningKey, installer.mhqEndpoint)
 	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Println(apiCreateError)
-		fmt.Printf(color.HiRedString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-		os.Exit(1)
+		progress.Fail(err, apiCreateError)
+		return err
 	}
 
 	err = apiClient.DeregisterRig(mhq.DeregisterRigRequest{
 		RigID: rigID,
 	})
 	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
+		progress.Fail(err, fmt.Sprintf(`
 We were unable to deregister your rig with MiningHQ. Please ensure that
 you are connected to the internet and that the file '%s' contains the same
 mining key that you can find under 'Mining' in your settings available at
@@ -241,22 +218,17 @@ If you are sure everything is in order, please contact support to resolve
 the issue. Support can be contacted via our help channels listed at
 https://www.mininghq.io/help
 `,
-			miningKeyPath)
-		fmt.Printf(color.HiRedString(
-			"Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
+			miningKeyPath))
 
 		// If we can't deregister the rig, continue with the rest of the removal
 		// anyways
 	} else {
 		// Rig removed
-		color.HiGreen("OK")
+		progress.OK("")
 	}
 
 	// Remove the service
-	fmt.Print("Removing the MiningHQ Miner service\t")
+	progress.Start("remove_service", "Removing the MiningHQ Miner service\t")
 
 	// NOTE We no longer run as a service
 	// serviceFilename := "mininghq-miner"
@@ -293,35 +265,46 @@ https://www.mininghq.io/help
 	// }
 	// END NOTE
 
-	// We now use autorun
-	app := &autostart.App{
+	// We now use autorun, older installations didn't record the
+	// autostart entries
+	apps := []*autostart.App{{
 		Name:        installer.serviceName,
 		DisplayName: installer.serviceDisplayName,
 		Exec:        []string{filepath.Join(installedPath, installer.serviceName)},
+	}}
+	if len(record.Autostart) > 0 {
+		apps = nil
+		for _, entry := range record.Autostart {
+			apps = append(apps, &autostart.App{
+				Name:        entry.Name,
+				DisplayName: entry.DisplayName,
+				Exec:        entry.Exec,
+			})
+		}
 	}
-	if app.IsEnabled(false) == true {
-		err = app.Disable(false)
+	err = nil
+	for _, app := range apps {
+		if app.IsEnabled(false) == true {
+			disableErr := app.Disable(false)
+			if disableErr != nil {
+				err = disableErr
+			}
+		}
 	}
 
 	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
+		progress.Fail(err, `
 We were unable to uninstall the miner service (it might already be uninstalled).
 `)
-		fmt.Printf(color.HiRedString(
-			"Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
 
 		// If we can't remove the service, continue with the rest of the removal
 		// anyways
 	} else {
 		// Service uninstalled
-		color.HiGreen("OK")
+		progress.OK("")
 	}
 
-	fmt.Print("Remove startup item\t\t\t")
+	progress.Start("remove_startup_item", "Remove startup item\t\t\t")
 	if strings.ToLower(runtime.GOOS) == "windows" {
 
 		app := &autostart.App{
@@ -337,53 +320,36 @@ We were unable to uninstall the miner service (it might already be uninstalled).
 		err = os.Remove(filepath.Join(installer.homeDir, ".local", "share", "applications", "MiningHQ.desktop"))
 	}
 	if err != nil {
-		color.HiRed("FAIL")
-		fmt.Printf(`
+		progress.Fail(err, `
 We were unable to remove the MiningHQ Miner Manager from your start menu.
 `)
-		fmt.Printf(color.HiRedString(
-			"Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
 
 		// If we can't remove the shortcup, continue with the rest of the removal
 		// anyways
 	} else {
-		// Service uninstalled
-		color.HiGreen("OK")
+		// Startup item removed
+		progress.OK("")
 	}
 
 	// Remove files
-	fmt.Print("Remove the files\t\t\t")
+	progress.Start("remove_files", "Remove the files\t\t\t")
 	err = os.RemoveAll(installedPath)
 	if err != nil {
-		color.HiYellow("NOTICE")
-		fmt.Printf(`
+		progress.Notice(err, fmt.Sprintf(`
 We were unable to remove the MiningHQ files from '%s'. Please remove it yourself.
-`, installedPath)
-		fmt.Printf(color.HiYellowString(
-			"Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
+`, installedPath))
 	}
-	err = os.Remove(installedPathFilepath)
-	if err != nil {
-		color.HiYellow("NOTICE")
-		fmt.Printf(`
+	removeErr := record.Remove()
+	if removeErr != nil {
+		progress.Notice(removeErr, fmt.Sprintf(`
 We were unable to remove the MiningHQ file from '%s'. Please remove it yourself.
-`, installedPathFilepath)
-		fmt.Printf(color.HiYellowString("Include the following error in your report '%s'"), err.Error())
-		fmt.Println()
-		fmt.Println()
-		color.Unset()
-	} else {
+`, record.Path()))
+	} else if err == nil {
 		// Files removed
-		color.HiGreen("OK")
+		progress.OK("")
 	}
 
-	fmt.Printf(`
+	fmt.Fprintf(out, `
 
 
 ***************************
@@ -402,29 +368,19 @@ We hope we see you again,
 The MiningHQ Team
 	`)
 
-	fmt.Println()
-	fmt.Println()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out)
+
+	if progress.JSON() {
+		// Scripts don't need to be given time to read the output
+		return nil
+	}
 
-	fmt.Println("Uninstaller will exit in 10 seconds...")
+	fmt.Fprintln(out, "Uninstaller will exit in 10 seconds...")
 	time.Sleep(time.Second * 10)
 
-	fmt.Println("Press Enter to exit")
+	fmt.Fprintln(out, "Press Enter to exit")
 	os.Stdin.Read([]byte{0})
 
 	return nil
 }
-
-// findProcessByName finds and returns the process information by name
-func (installer *Installer) findProcessByName(name string) (ps.Process, error) {
-	processes, err := ps.Processes()
-	if err != nil {
-		return nil, err
-	}
-
-	for _, process := range processes {
-		if strings.Contains(process.Executable(), name) {
-			return process, nil
-		}
-	}
-	return nil, fmt.Errorf("Unable to find process with name '%s'", name)
-}